@@ -0,0 +1,130 @@
+package ubernet
+
+import (
+	"net/http"
+	"sync"
+)
+
+// QueueFullPolicy tells Client.DoAsync what to do when its queue is full.
+type QueueFullPolicy int
+
+// Available queue full policies.
+const (
+	// QueueFullBlock waits until the request can be queued.
+	QueueFullBlock QueueFullPolicy = iota
+	// QueueFullDrop discards the request, calling its callback with
+	// ErrAsyncQueueFull.
+	QueueFullDrop
+	// QueueFullError makes DoAsync return ErrAsyncQueueFull.
+	QueueFullError
+)
+
+const (
+	defaultAsyncWorkers   = 4
+	defaultAsyncQueueSize = 128
+)
+
+// AsyncCallback receives the result of an asynchronous request.
+// The callback is responsible for closing the response body.
+type AsyncCallback func(*http.Response, error)
+
+type asyncJob struct {
+	req      *Request
+	callback AsyncCallback
+}
+
+type asyncPool struct {
+	once      sync.Once
+	closeOnce sync.Once
+	// mu guards closed, queueing is done under a read lock so that the
+	// queue is never closed while a request is being queued.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan asyncJob
+	wg     sync.WaitGroup
+}
+
+// DoAsync queues req to be performed by a pool of AsyncWorkers goroutines,
+// with retries, and calls callback with the result.
+// callback may be nil for fire-and-forget requests, then the body is closed.
+// A request dropped by QueueFullDrop has its callback called before DoAsync
+// returns. DoAsync returns ErrAsyncClosed once CloseAsync was called.
+func (c *Client) DoAsync(req *Request, callback AsyncCallback) error {
+	c.startAsync()
+	c.async.mu.RLock()
+	dropped, err := c.queueAsync(asyncJob{req, callback})
+	c.async.mu.RUnlock()
+	if dropped && callback != nil {
+		callback(nil, ErrAsyncQueueFull)
+	}
+	return err
+}
+
+func (c *Client) queueAsync(job asyncJob) (dropped bool, err error) {
+	if c.async.closed {
+		return false, ErrAsyncClosed
+	}
+	switch c.AsyncQueueFull {
+	case QueueFullDrop:
+		select {
+		case c.async.queue <- job:
+		default:
+			if c.Logger != nil {
+				c.Logger.Printf("WARNING %s: async queue is full, dropping request", c.describe(job.req))
+			}
+			return true, nil
+		}
+	case QueueFullError:
+		select {
+		case c.async.queue <- job:
+		default:
+			return false, ErrAsyncQueueFull
+		}
+	default:
+		c.async.queue <- job
+	}
+	return false, nil
+}
+
+// CloseAsync waits for the queued asynchronous requests to complete and
+// stops the workers. It may be called several times, DoAsync fails with
+// ErrAsyncClosed afterwards.
+func (c *Client) CloseAsync() {
+	c.startAsync()
+	c.async.closeOnce.Do(func() {
+		c.async.mu.Lock()
+		c.async.closed = true
+		close(c.async.queue)
+		c.async.mu.Unlock()
+	})
+	c.async.wg.Wait()
+}
+
+func (c *Client) startAsync() {
+	c.async.once.Do(func() {
+		workers, size := c.AsyncWorkers, c.AsyncQueueSize
+		if workers <= 0 {
+			workers = defaultAsyncWorkers
+		}
+		if size <= 0 {
+			size = defaultAsyncQueueSize
+		}
+		c.async.queue = make(chan asyncJob, size)
+		c.async.wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go c.asyncWorker()
+		}
+	})
+}
+
+func (c *Client) asyncWorker() {
+	defer c.async.wg.Done()
+	for job := range c.async.queue {
+		resp, err := c.Do(job.req)
+		if job.callback != nil {
+			job.callback(resp, err)
+		} else if resp != nil {
+			c.drainBody(resp.Body)
+		}
+	}
+}
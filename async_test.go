@@ -0,0 +1,65 @@
+package ubernet
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoAsyncDropCallsCallback(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.Logger = nil
+	c.AsyncWorkers = 1
+	c.AsyncQueueSize = 1
+	c.AsyncQueueFull = QueueFullDrop
+	dropped := make(chan error, 1)
+	for i := 0; i < 10; i++ {
+		req, err := NewRequest("GET", srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.DoAsync(req, func(resp *http.Response, err error) {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if errors.Is(err, ErrAsyncQueueFull) {
+				select {
+				case dropped <- err:
+				default:
+				}
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-dropped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the callback of no dropped request was called")
+	}
+	close(release)
+	c.CloseAsync()
+}
+
+func TestCloseAsyncTwice(t *testing.T) {
+	c := NewClient()
+	c.CloseAsync()
+	c.CloseAsync()
+
+	req, err := NewRequest("GET", "http://127.0.0.1/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DoAsync(req, nil); !errors.Is(err, ErrAsyncClosed) {
+		t.Fatalf("DoAsync after CloseAsync = %v, want ErrAsyncClosed", err)
+	}
+}
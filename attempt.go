@@ -0,0 +1,88 @@
+package ubernet
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on responses when Client.AttemptHeaders is enabled.
+const (
+	HeaderAttempts = "X-Ubernet-Attempts"
+	HeaderElapsed  = "X-Ubernet-Elapsed"
+	HeaderBackoff  = "X-Ubernet-Backoff"
+	HeaderTLS      = "X-Ubernet-TLS"
+)
+
+// AttemptInfo describes the cost of the last Client.Do call of a Request.
+type AttemptInfo struct {
+	// Attempts is the number of attempts made, including the first one.
+	Attempts int
+	// Elapsed is the total time spent in Do.
+	Elapsed time.Duration
+	// Backoff is the time spent waiting between attempts.
+	Backoff time.Duration
+	// TLS describes the connection of the last response, nil if it was
+	// not encrypted.
+	TLS *TLSInfo
+}
+
+// LastAttemptInfo returns the AttemptInfo of the last Client.Do call of r.
+func (r *Request) LastAttemptInfo() AttemptInfo {
+	return r.lastAttempt
+}
+
+func setAttemptHeaders(resp *http.Response, info AttemptInfo) {
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	resp.Header.Set(HeaderAttempts, strconv.Itoa(info.Attempts))
+	resp.Header.Set(HeaderElapsed, info.Elapsed.String())
+	resp.Header.Set(HeaderBackoff, info.Backoff.String())
+	if info.TLS != nil {
+		resp.Header.Set(HeaderTLS, info.TLS.String())
+	}
+}
+
+// AttemptError describes a failed attempt of a request.
+type AttemptError struct {
+	// Attempt is the 1-based number of the attempt.
+	Attempt    int
+	StartedAt  time.Time
+	Duration   time.Duration
+	StatusCode int
+	// Err is nil if the attempt failed because of its status code only.
+	Err error
+}
+
+func (e *AttemptError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("attempt %d at %s (%s): %v", e.Attempt, e.StartedAt.Format(time.RFC3339Nano), e.Duration, e.Err)
+	}
+	return fmt.Sprintf("attempt %d at %s (%s): status %d", e.Attempt, e.StartedAt.Format(time.RFC3339Nano), e.Duration, e.StatusCode)
+}
+
+func (e *AttemptError) Unwrap() error { return e.Err }
+
+// AttemptErrors is the history of failed attempts, wrapped in the error
+// returned by Client.Do when giving up. Retrieve it with errors.As.
+type AttemptErrors []*AttemptError
+
+func (e AttemptErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ae := range e {
+		msgs[i] = ae.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap allows errors.Is and errors.As to inspect every attempt.
+func (e AttemptErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, ae := range e {
+		errs[i] = ae
+	}
+	return errs
+}
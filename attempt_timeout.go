@@ -0,0 +1,33 @@
+package ubernet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// withAttemptTimeout bounds the context of the attempt of req by the
+// AttemptTimeout of c, returning the function to pass the result of the
+// attempt through, nil if there is no timeout. The timeout covers reading
+// the response body too, except for streaming responses.
+func (c *Client) withAttemptTimeout(req *Request) func(*http.Response, error) (*http.Response, error) {
+	if c.AttemptTimeout <= 0 || req.streamingResponse {
+		return nil
+	}
+	parent := req.Context()
+	ctx, cancel := context.WithTimeout(parent, c.AttemptTimeout)
+	req.Request = req.Request.WithContext(ctx)
+
+	return func(resp *http.Response, err error) (*http.Response, error) {
+		req.Request = req.Request.WithContext(parent)
+		if err != nil {
+			cancel()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+				err = &ErrAttemptTimeout{After: c.AttemptTimeout, Err: err}
+			}
+			return resp, err
+		}
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+}
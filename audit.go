@@ -0,0 +1,144 @@
+package ubernet
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const maxAuditLeaks = 32
+
+// Audit tracks resources the users of a Client or Checker may leak:
+// requests still in progress, response bodies garbage collected without
+// being closed, and checker pipes not put back.
+// Set it on Client.Audit, and attach Checkers with AuditChecker.
+type Audit struct {
+	// CaptureStacks records where leaked bodies were returned from Do.
+	// It is expensive, enable it while investigating only.
+	CaptureStacks bool
+
+	inflight     int64
+	openBodies   int64
+	leakedBodies int64
+	pipes        int64
+
+	mu     sync.Mutex
+	leaks  []string
+	leakAt int
+}
+
+// AuditSnapshot is the state of an Audit.
+type AuditSnapshot struct {
+	InflightRequests int64 `json:"inflight_requests"`
+	OpenBodies       int64 `json:"open_bodies"`
+	LeakedBodies     int64 `json:"leaked_bodies"`
+	OutstandingPipes int64 `json:"outstanding_pipes"`
+	// LeakStacks holds the stacks of the last leaked bodies, if captured.
+	LeakStacks []string `json:"leak_stacks,omitempty"`
+}
+
+// Snapshot returns the current state of a.
+func (a *Audit) Snapshot() AuditSnapshot {
+	a.mu.Lock()
+	stacks := append([]string(nil), a.leaks...)
+	a.mu.Unlock()
+	return AuditSnapshot{
+		InflightRequests: atomic.LoadInt64(&a.inflight),
+		OpenBodies:       atomic.LoadInt64(&a.openBodies),
+		LeakedBodies:     atomic.LoadInt64(&a.leakedBodies),
+		OutstandingPipes: atomic.LoadInt64(&a.pipes),
+		LeakStacks:       stacks,
+	}
+}
+
+// ServeHTTP serves the snapshot of a as JSON.
+func (a *Audit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Snapshot())
+}
+
+// Publish exports the snapshot of a as the expvar name.
+// Like expvar.Publish, it panics if name is already in use.
+func (a *Audit) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return a.Snapshot()
+	}))
+}
+
+// AuditChecker makes a count the pipes of c. It must be called before c
+// is used.
+func (a *Audit) AuditChecker(c *Checker) {
+	c.pipes = &auditedPipePool{c.pipes, a}
+}
+
+func (a *Audit) requestStarted() { atomic.AddInt64(&a.inflight, 1) }
+func (a *Audit) requestDone()    { atomic.AddInt64(&a.inflight, -1) }
+
+// trackBody wraps the body of resp to notice when it is never closed.
+func (a *Audit) trackBody(resp *http.Response) {
+	body := &auditedBody{ReadCloser: resp.Body, audit: a}
+	if a.CaptureStacks {
+		buf := make([]byte, 4096)
+		body.stack = string(buf[:runtime.Stack(buf, false)])
+	}
+	atomic.AddInt64(&a.openBodies, 1)
+	runtime.SetFinalizer(body, (*auditedBody).finalize)
+	resp.Body = body
+}
+
+func (a *Audit) recordLeak(stack string) {
+	atomic.AddInt64(&a.leakedBodies, 1)
+	if stack == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.leaks) < maxAuditLeaks {
+		a.leaks = append(a.leaks, stack)
+	} else {
+		a.leaks[a.leakAt] = stack
+		a.leakAt = (a.leakAt + 1) % maxAuditLeaks
+	}
+}
+
+type auditedBody struct {
+	io.ReadCloser
+	audit  *Audit
+	stack  string
+	closed int32
+}
+
+func (b *auditedBody) Close() error {
+	if atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		atomic.AddInt64(&b.audit.openBodies, -1)
+		runtime.SetFinalizer(b, nil)
+	}
+	return b.ReadCloser.Close()
+}
+
+func (b *auditedBody) finalize() {
+	if atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		atomic.AddInt64(&b.audit.openBodies, -1)
+		b.audit.recordLeak(b.stack)
+		b.ReadCloser.Close()
+	}
+}
+
+type auditedPipePool struct {
+	PipePool
+	audit *Audit
+}
+
+func (p *auditedPipePool) GetPipe() chan error {
+	atomic.AddInt64(&p.audit.pipes, 1)
+	return p.PipePool.GetPipe()
+}
+
+func (p *auditedPipePool) PutBackPipe(pipe chan error) {
+	atomic.AddInt64(&p.audit.pipes, -1)
+	p.PipePool.PutBackPipe(pipe)
+}
@@ -0,0 +1,238 @@
+package ubernet
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// AuthProvider authorizes outgoing requests of a Client.
+type AuthProvider interface {
+	// Authorize is called right before every attempt is sent.
+	Authorize(req *http.Request) error
+
+	// Challenge is called when the server answered with 401 Unauthorized.
+	// It reports whether the request should be sent again with the
+	// credentials refreshed from the response.
+	Challenge(req *http.Request, resp *http.Response) (bool, error)
+}
+
+// DigestAuth is an AuthProvider implementing RFC 7616 Digest access
+// authentication (MD5 and SHA-256, qop=auth).
+// Server challenges are cached per host, so only the first request to a host
+// costs an extra round trip.
+type DigestAuth struct {
+	Username string
+	Password string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// NewDigestAuth returns a DigestAuth with given credentials.
+func NewDigestAuth(username, password string) *DigestAuth {
+	return &DigestAuth{
+		Username:   username,
+		Password:   password,
+		challenges: make(map[string]*digestChallenge),
+	}
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+	nc        uint32
+}
+
+// Authorize sets the Authorization header if a challenge of the host is cached.
+func (a *DigestAuth) Authorize(req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	chal, ok := a.challenges[req.URL.Host]
+	if !ok {
+		return nil
+	}
+	chal.nc++
+	header, err := a.authorization(chal, req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// Challenge caches the Digest challenge of resp.
+// It refuses to retry if the request already carried a response to a
+// non-stale challenge, which means the credentials were rejected.
+func (a *DigestAuth) Challenge(req *http.Request, resp *http.Response) (bool, error) {
+	chal := parseDigestChallenges(resp.Header.Values("WWW-Authenticate"))
+	if chal == nil {
+		return false, nil
+	}
+	if strings.HasPrefix(req.Header.Get("Authorization"), "Digest ") && !chal.stale {
+		return false, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.challenges == nil {
+		a.challenges = make(map[string]*digestChallenge)
+	}
+	a.challenges[req.URL.Host] = chal
+	return true, nil
+}
+
+func (a *DigestAuth) authorization(chal *digestChallenge, req *http.Request) (string, error) {
+	newHash := digestHash(chal.algorithm)
+	if newHash == nil {
+		return "", fmt.Errorf("unsupported digest algorithm %q", chal.algorithm)
+	}
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	cnonce, err := newCnonce()
+	if err != nil {
+		return "", err
+	}
+	nc := fmt.Sprintf("%08x", chal.nc)
+	uri := req.URL.RequestURI()
+
+	ha1 := h(a.Username + ":" + chal.realm + ":" + a.Password)
+	if strings.HasSuffix(strings.ToUpper(chal.algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + chal.nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	var response string
+	if chal.qop == "" {
+		response = h(ha1 + ":" + chal.nonce + ":" + ha2)
+	} else {
+		response = h(strings.Join([]string{ha1, chal.nonce, nc, cnonce, chal.qop, ha2}, ":"))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s", realm="%s", nonce="%s", uri="%s"`, a.Username, chal.realm, chal.nonce, uri)
+	if chal.algorithm != "" {
+		fmt.Fprintf(&b, ", algorithm=%s", chal.algorithm)
+	}
+	if chal.qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce="%s"`, chal.qop, nc, cnonce)
+	}
+	fmt.Fprintf(&b, `, response="%s"`, response)
+	if chal.opaque != "" {
+		fmt.Fprintf(&b, `, opaque="%s"`, chal.opaque)
+	}
+	return b.String(), nil
+}
+
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5", "MD5-SESS":
+		return md5.New
+	case "SHA-256", "SHA-256-SESS":
+		return sha256.New
+	}
+	return nil
+}
+
+func newCnonce() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// parseDigestChallenges picks the strongest supported Digest challenge
+// among given WWW-Authenticate header values.
+func parseDigestChallenges(headers []string) *digestChallenge {
+	var best *digestChallenge
+	for _, header := range headers {
+		if len(header) < 7 || !strings.EqualFold(header[:7], "Digest ") {
+			continue
+		}
+		params := parseAuthParams(header[7:])
+		chal := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+			stale:     strings.EqualFold(params["stale"], "true"),
+		}
+		if chal.nonce == "" || digestHash(chal.algorithm) == nil {
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			for _, q := range strings.Split(qop, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					chal.qop = "auth"
+				}
+			}
+			if chal.qop == "" {
+				// Only qop=auth is supported.
+				continue
+			}
+		}
+		if best == nil || strings.HasPrefix(strings.ToUpper(chal.algorithm), "SHA-256") {
+			best = chal
+		}
+	}
+	return best
+}
+
+// parseAuthParams parses a comma separated list of auth-params,
+// whose values may be quoted strings.
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"ubernet"
+)
+
+// newClient returns a pooled Client retrying immediately, so only the
+// retry machinery is measured.
+func newClient() *ubernet.Client {
+	c := ubernet.NewClient()
+	c.HTTPClient = ubernet.DefaultPooledClient()
+	c.Logger = nil
+	c.RetryWaitMin = 0
+	c.RetryWaitMax = 0
+	c.Backoff = func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration { return 0 }
+	return c
+}
+
+// flakyHandler fails every request with 503 until it has failed failures
+// times in a row, then succeeds.
+func flakyHandler(failures int) http.Handler {
+	var n int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if failures > 0 && atomic.AddInt64(&n, 1)%int64(failures+1) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func do(b *testing.B, c *ubernet.Client, req *ubernet.Request) {
+	resp, err := c.Do(req)
+	if err != nil {
+		b.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b.Fatalf("unexpected status %s", resp.Status)
+	}
+}
+
+func benchRetryLoop(failures int) func(b *testing.B) {
+	return func(b *testing.B) {
+		srv := httptest.NewServer(flakyHandler(failures))
+		defer srv.Close()
+		c := newClient()
+		c.RetryMax = failures
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			req, err := ubernet.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			do(b, c, req)
+		}
+	}
+}
+
+// benchBodyReplay sends a body of size bytes, replayed once for a retry.
+func benchBodyReplay(size int) func(b *testing.B) {
+	return func(b *testing.B) {
+		srv := httptest.NewServer(flakyHandler(1))
+		defer srv.Close()
+		c := newClient()
+		c.RetryMax = 1
+		body := bytes.Repeat([]byte("x"), size)
+
+		b.SetBytes(int64(size))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			req, err := ubernet.NewRequest(http.MethodPut, srv.URL, bytes.NewReader(body))
+			if err != nil {
+				b.Fatal(err)
+			}
+			do(b, c, req)
+		}
+	}
+}
+
+// listen returns a listener accepting and closing connections until the
+// benchmark ends.
+func listen(b *testing.B) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln
+}
+
+// benchChecker measures checks per second with fds checks in flight.
+func benchChecker(fds int) func(b *testing.B) {
+	return func(b *testing.B) {
+		ln := listen(b)
+		defer ln.Close()
+		addr := ln.Addr().String()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		checker := ubernet.NewChecker()
+		go func() {
+			if err := checker.CheckingLoop(ctx); err != nil && ctx.Err() == nil {
+				log.Print("Checking loop failed: ", err)
+			}
+		}()
+		<-checker.WaitReady()
+
+		var next int64
+		var wg sync.WaitGroup
+		b.ResetTimer()
+		start := time.Now()
+		for w := 0; w < fds; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for atomic.AddInt64(&next, 1) <= int64(b.N) {
+					if err := checker.CheckAddr(addr, time.Second); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "checks/s")
+	}
+}
+
+func benchDialer(b *testing.B) {
+	ln := listen(b)
+	defer ln.Close()
+	addr := ln.Addr().String()
+	var d ubernet.Dialer
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn, err := d.DialTCP(context.Background(), "tcp", addr)
+		if err != nil {
+			b.Fatal(err)
+		}
+		conn.Close()
+	}
+}
+
+// benchResultPipes registers and pops pipes from every CPU, as the checks
+// and the polling loop of a busy Checker do.
+func benchResultPipes(newPipes func() ubernet.ResultPipes) func(b *testing.B) {
+	return func(b *testing.B) {
+		pipes := newPipes()
+		var nextFd int64
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			pipe := make(chan error, 1)
+			for pb.Next() {
+				// Keep FDs low and dense like the kernel allocates them.
+				fd := int(atomic.AddInt64(&nextFd, 1) % 65536)
+				pipes.RegisterResultPipe(fd, pipe)
+				pipes.PopResultPipe(fd)
+				pipes.DeregisterResultPipe(fd)
+			}
+		})
+	}
+}
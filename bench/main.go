@@ -0,0 +1,172 @@
+// Command bench measures the hot paths of ubernet: the retry loop, body
+// replay, checker throughput, result pipes and dialer connect latency,
+// against local servers only.
+//
+// It prints results in the format of go test -bench, so they can be
+// compared with benchstat, and fails when a benchmark is slower than its
+// baseline by more than the threshold, or makes more allocations:
+//
+//	go run ./bench -count 5 > new.txt
+//	benchstat bench/baseline.txt new.txt
+//	go run ./bench -baseline bench/baseline.txt -threshold 0.2
+//
+// Baselines only make sense on the machine they were recorded on; record
+// them again with -count 5 > bench/baseline.txt when it changes.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"ubernet"
+)
+
+type benchmark struct {
+	name string
+	fn   func(b *testing.B)
+}
+
+var benchmarks = []benchmark{
+	{"RetryLoop/success", benchRetryLoop(0)},
+	{"RetryLoop/retries=2", benchRetryLoop(2)},
+	{"BodyReplay/size=1KiB", benchBodyReplay(1 << 10)},
+	{"BodyReplay/size=1MiB", benchBodyReplay(1 << 20)},
+	{"CheckerThroughput/fds=1", benchChecker(1)},
+	{"CheckerThroughput/fds=16", benchChecker(16)},
+	{"CheckerThroughput/fds=256", benchChecker(256)},
+	{"DialerConnect", benchDialer},
+	{"ResultPipes/syncmap", benchResultPipes(ubernet.NewSyncMapResultPipes)},
+	{"ResultPipes/sharded", benchResultPipes(func() ubernet.ResultPipes { return ubernet.NewShardedResultPipes(0) })},
+}
+
+func main() {
+	log.SetFlags(0)
+	var (
+		run       = flag.String("run", ".", "Run only the benchmarks matching this regular expression")
+		count     = flag.Int("count", 1, "Run each benchmark this many times")
+		baseline  = flag.String("baseline", "", "Compare with the results in this file")
+		threshold = flag.Float64("threshold", 0.1, "Tolerated slowdown over the baseline, as a fraction")
+	)
+	flag.Parse()
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		log.Fatalf("Invalid -run: %s", err)
+	}
+
+	var base map[string]result
+	if *baseline != "" {
+		if base, err = readResults(*baseline); err != nil {
+			log.Fatalf("Can not read baseline: %s", err)
+		}
+	}
+
+	samples := make(map[string][]result)
+	fmt.Printf("goos: %s\ngoarch: %s\npkg: ubernet/bench\n", runtime.GOOS, runtime.GOARCH)
+	for _, bm := range benchmarks {
+		if !filter.MatchString(bm.name) {
+			continue
+		}
+		for i := 0; i < *count; i++ {
+			r := testing.Benchmark(bm.fn)
+			fmt.Printf("Benchmark%s-%d\t%s\t%s\n", bm.name, runtime.GOMAXPROCS(0), r.String(), r.MemString())
+			samples[bm.name] = append(samples[bm.name], result{float64(r.NsPerOp()), float64(r.AllocsPerOp())})
+		}
+	}
+
+	if base == nil {
+		return
+	}
+	regressed := false
+	for name, s := range samples {
+		old, ok := base[name]
+		if !ok {
+			continue
+		}
+		cur := medians(s)
+		if cur.ns > old.ns*(1+*threshold) {
+			regressed = true
+			log.Printf("REGRESSION %s: %.0f ns/op, baseline %.0f ns/op (+%.1f%%)", name, cur.ns, old.ns, (cur.ns/old.ns-1)*100)
+		}
+		// Allocations are deterministic, any increase is a regression.
+		if cur.allocs > old.allocs {
+			regressed = true
+			log.Printf("REGRESSION %s: %.0f allocs/op, baseline %.0f allocs/op", name, cur.allocs, old.allocs)
+		}
+	}
+	if regressed {
+		os.Exit(1)
+	}
+}
+
+// result is the outcome of a benchmark run.
+type result struct {
+	ns     float64
+	allocs float64
+}
+
+var (
+	resultLine = regexp.MustCompile(`^Benchmark(\S+?)(-\d+)?\s+\d+\s+([\d.]+) ns/op`)
+	allocsCol  = regexp.MustCompile(`\s(\d+) allocs/op`)
+)
+
+// readResults returns the median results of every benchmark in path.
+func readResults(path string) (map[string]result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	samples := make(map[string][]result)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := resultLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		var r result
+		if r.ns, err = strconv.ParseFloat(m[3], 64); err != nil {
+			return nil, err
+		}
+		if a := allocsCol.FindStringSubmatch(scanner.Text()); a != nil {
+			if r.allocs, err = strconv.ParseFloat(a[1], 64); err != nil {
+				return nil, err
+			}
+		}
+		samples[m[1]] = append(samples[m[1]], r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	results := make(map[string]result, len(samples))
+	for name, s := range samples {
+		results[name] = medians(s)
+	}
+	return results, nil
+}
+
+func medians(samples []result) result {
+	ns := make([]float64, len(samples))
+	allocs := make([]float64, len(samples))
+	for i, r := range samples {
+		ns[i], allocs[i] = r.ns, r.allocs
+	}
+	return result{median(ns), median(allocs)}
+}
+
+func median(samples []float64) float64 {
+	sorted := append([]float64(nil), samples...)
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j] < sorted[j-1]; j-- {
+			sorted[j], sorted[j-1] = sorted[j-1], sorted[j]
+		}
+	}
+	return sorted[len(sorted)/2]
+}
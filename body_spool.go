@@ -0,0 +1,179 @@
+package ubernet
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// RequestSpoolThreshold is the size beyond which request bodies given as
+// an io.Reader are spooled to a temporary file of RequestSpoolDir, rather
+// than kept in memory to be replayed by retries. Zero disables spooling.
+// The file is closed once Client.Do returns, so that such requests can not
+// be sent again.
+var (
+	RequestSpoolThreshold int64
+	RequestSpoolDir       string
+)
+
+// heldBody is the storage of a request body read ahead, released when the
+// request is closed.
+type heldBody struct {
+	file   *os.File
+	buffer *pooledBody
+	// seeker is not released, it is the reader of the body when it can
+	// only be replayed by seeking it back.
+	seeker io.Seeker
+}
+
+func (h heldBody) holdBy(r *Request) {
+	r.spooled = h.file
+	r.buffer = h.buffer
+	r.seeker = h.seeker
+}
+
+func (h heldBody) release() error {
+	if h.buffer != nil {
+		h.buffer.release()
+	}
+	if h.file != nil {
+		return h.file.Close()
+	}
+	return nil
+}
+
+// spoolRequestBody reads r whole, keeping it in a pooled buffer up to
+// RequestSpoolThreshold bytes and in a temporary file beyond. The file is
+// unlinked right away and read with ReadAt, so every replay is independent.
+func spoolRequestBody(r io.Reader) (ReaderFunc, int64, heldBody, error) {
+	buf := getBuffer()
+	threshold := RequestSpoolThreshold
+	if threshold <= 0 {
+		if _, err := buf.ReadFrom(r); err != nil {
+			putBuffer(buf)
+			return nil, 0, heldBody{}, err
+		}
+		pb := &pooledBody{buf: buf}
+		return pb.reader, int64(buf.Len()), heldBody{buffer: pb}, nil
+	}
+
+	n, err := io.CopyN(buf, r, threshold+1)
+	if err != nil && err != io.EOF {
+		putBuffer(buf)
+		return nil, 0, heldBody{}, err
+	}
+	if n <= threshold {
+		pb := &pooledBody{buf: buf}
+		return pb.reader, n, heldBody{buffer: pb}, nil
+	}
+	defer putBuffer(buf)
+
+	f, err := os.CreateTemp(RequestSpoolDir, "ubernet-request-")
+	if err != nil {
+		return nil, 0, heldBody{}, err
+	}
+	os.Remove(f.Name())
+	size, err := io.Copy(f, io.MultiReader(buf, r))
+	if err != nil {
+		f.Close()
+		return nil, 0, heldBody{}, err
+	}
+	bodyReader := func() (io.Reader, error) {
+		return io.NewSectionReader(f, 0, size), nil
+	}
+	return bodyReader, size, heldBody{file: f}, nil
+}
+
+// pooledBody replays a body from a pooled buffer, put back once released
+// and every reader handed out is closed. The transport may still read a
+// body after Client.Do returned, until it closes it.
+type pooledBody struct {
+	buf *bytes.Buffer
+	// data is a copy of the body, replayed once the buffer was detached.
+	data []byte
+
+	mu       sync.Mutex
+	readers  int
+	released bool
+}
+
+func (p *pooledBody) reader() (io.Reader, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.data != nil {
+		return bytes.NewReader(p.data), nil
+	}
+	if p.released {
+		return errReader{ErrBodyNotReplayable}, nil
+	}
+	p.readers++
+	return &pooledBodyReader{Reader: bytes.NewReader(p.buf.Bytes()), body: p}, nil
+}
+
+func (p *pooledBody) readerClosed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers--
+	if p.released && p.readers == 0 {
+		putBuffer(p.buf)
+	}
+}
+
+func (p *pooledBody) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.released {
+		return
+	}
+	p.released = true
+	if p.readers == 0 {
+		putBuffer(p.buf)
+	}
+}
+
+// detach releases the buffer, copying the body out of it first, so that
+// the body can still be replayed.
+func (p *pooledBody) detach() {
+	p.mu.Lock()
+	if !p.released {
+		p.data = append([]byte{}, p.buf.Bytes()...)
+	}
+	p.mu.Unlock()
+	p.release()
+}
+
+type pooledBodyReader struct {
+	*bytes.Reader
+	body *pooledBody
+	once sync.Once
+}
+
+func (r *pooledBodyReader) Close() error {
+	r.once.Do(r.body.readerClosed)
+	return nil
+}
+
+// releaseBody releases the storage of the body of r once Client.Do is
+// done: the pooled buffer, whose content is copied out so that r can be
+// sent again, and the temporary file, see RequestSpoolThreshold.
+func (r *Request) releaseBody() error {
+	if r.buffer != nil {
+		r.buffer.detach()
+		r.buffer = nil
+	}
+	return r.Close()
+}
+
+// Close releases the buffer or temporary file holding the body of r, if
+// it was read ahead. Requests never sent should be closed by the caller.
+// Client.Do releases them once done, and requests whose body was spooled
+// to a temporary file can then not be sent again.
+func (r *Request) Close() error {
+	if r.spooled == nil && r.buffer == nil {
+		return nil
+	}
+	err := heldBody{file: r.spooled, buffer: r.buffer}.release()
+	r.spooled, r.buffer = nil, nil
+	return err
+}
@@ -0,0 +1,50 @@
+package ubernet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRequestResentAfterDo(t *testing.T) {
+	const payload = "request body"
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		got, _ := io.ReadAll(r.Body)
+		if string(got) != payload {
+			t.Errorf("server got body %q, want %q", got, payload)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.Logger = nil
+	// A plain io.Reader, buffered in a pooled buffer.
+	req, err := NewRequest("POST", srv.URL, io.MultiReader(strings.NewReader(payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("Do #%d: %v", i+1, err)
+		}
+		resp.Body.Close()
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("%d requests, want 3", n)
+	}
+}
+
+func TestBodyNotReplayableNotRetried(t *testing.T) {
+	retry, err := defaultRetryPolicy(context.Background(), nil, wrapError(ErrBodyNotReplayable, "request"))
+	if retry || !errors.Is(err, ErrBodyNotReplayable) {
+		t.Fatalf("defaultRetryPolicy = %v, %v; want false, ErrBodyNotReplayable", retry, err)
+	}
+}
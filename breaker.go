@@ -0,0 +1,232 @@
+package ubernet
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// CircuitState is the state of the circuit of a host.
+type CircuitState int
+
+// States of a circuit.
+const (
+	// CircuitClosed lets the requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails the requests with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen lets probes through to test whether the host recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker makes the Client fail fast with ErrCircuitOpen to hosts
+// which failed Failures times in a row, rather than burning RetryMax
+// attempts on each request. After Cooldown, the circuit is half-open:
+// HalfOpenProbes attempts at a time are let through, closing the circuit
+// once Successes of them succeeded, opening it again when one fails.
+//
+// Unlike Degradation, which reduces retries from a failure rate, it stops
+// sending altogether.
+type CircuitBreaker struct {
+	// Failures is the number of consecutive failed attempts opening the
+	// circuit of a host, 5 by default.
+	Failures int
+	// Cooldown is how long the circuit stays open, 30s by default.
+	Cooldown time.Duration
+	// HalfOpenProbes is the number of concurrent attempts let through by
+	// a half-open circuit, 1 by default.
+	HalfOpenProbes int
+	// Successes is the number of successful probes closing the circuit,
+	// 1 by default.
+	Successes int
+
+	// OnStateChange, if set, is called when the circuit of host changes
+	// state. It must not block.
+	OnStateChange func(host string, from, to CircuitState)
+
+	hosts sync.Map
+}
+
+// circuit is the state of a host.
+type circuit struct {
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	successes int
+	probes    int
+	openUntil time.Time
+}
+
+func (b *CircuitBreaker) circuit(host string) *circuit {
+	if c, ok := b.hosts.Load(host); ok {
+		return c.(*circuit)
+	}
+	c, _ := b.hosts.LoadOrStore(host, &circuit{})
+	return c.(*circuit)
+}
+
+func (b *CircuitBreaker) failures() int {
+	if b.Failures > 0 {
+		return b.Failures
+	}
+	return defaultBreakerFailures
+}
+
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown > 0 {
+		return b.Cooldown
+	}
+	return defaultBreakerCooldown
+}
+
+func (b *CircuitBreaker) halfOpenProbes() int {
+	if b.HalfOpenProbes > 0 {
+		return b.HalfOpenProbes
+	}
+	return 1
+}
+
+func (b *CircuitBreaker) successes() int {
+	if b.Successes > 0 {
+		return b.Successes
+	}
+	return 1
+}
+
+// State returns the state of the circuit of host.
+func (b *CircuitBreaker) State(host string) CircuitState {
+	c := b.circuit(host)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == CircuitOpen && !time.Now().Before(c.openUntil) {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// Reset closes the circuit of host.
+func (b *CircuitBreaker) Reset(host string) {
+	c := b.circuit(host)
+	c.mu.Lock()
+	from := c.state
+	*c = circuit{}
+	c.mu.Unlock()
+	b.changed(host, from, CircuitClosed)
+}
+
+func (b *CircuitBreaker) changed(host string, from, to CircuitState) {
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(host, from, to)
+	}
+}
+
+// allow returns whether an attempt to host may be sent, and whether it is
+// a probe of a half-open circuit, to be passed to record.
+func (b *CircuitBreaker) allow(host string) (probe bool, err error) {
+	c := b.circuit(host)
+	c.mu.Lock()
+	from := c.state
+	switch c.state {
+	case CircuitOpen:
+		if time.Now().Before(c.openUntil) {
+			until := c.openUntil
+			c.mu.Unlock()
+			return false, &ErrCircuitOpen{Host: host, Until: until}
+		}
+		c.state, c.successes, c.probes = CircuitHalfOpen, 0, 0
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= b.halfOpenProbes() {
+			c.mu.Unlock()
+			b.changed(host, from, CircuitHalfOpen)
+			return false, &ErrCircuitOpen{Host: host, HalfOpen: true}
+		}
+		c.probes++
+		probe = true
+	}
+	to := c.state
+	c.mu.Unlock()
+	b.changed(host, from, to)
+	return probe, nil
+}
+
+// record feeds the outcome of an attempt to host.
+func (b *CircuitBreaker) record(host string, probe, failed bool) {
+	c := b.circuit(host)
+	c.mu.Lock()
+	from := c.state
+	if probe && c.probes > 0 {
+		c.probes--
+	}
+	switch {
+	case c.state == CircuitOpen:
+		// Attempts sent before the circuit opened do not extend it.
+	case failed && (c.state == CircuitHalfOpen || c.failures+1 >= b.failures()):
+		c.state, c.failures = CircuitOpen, 0
+		c.openUntil = time.Now().Add(b.cooldown())
+	case failed:
+		c.failures++
+	case c.state == CircuitHalfOpen:
+		if probe {
+			c.successes++
+		}
+		if c.successes >= b.successes() {
+			c.state, c.failures = CircuitClosed, 0
+		}
+	default:
+		c.failures = 0
+	}
+	to := c.state
+	c.mu.Unlock()
+	b.changed(host, from, to)
+}
+
+// release frees the probe slot of an attempt to host without outcome.
+func (b *CircuitBreaker) release(host string) {
+	c := b.circuit(host)
+	c.mu.Lock()
+	if c.probes > 0 {
+		c.probes--
+	}
+	c.mu.Unlock()
+}
+
+// breakerAllow checks the circuit of the host of req before an attempt.
+func (c *Client) breakerAllow(req *Request) (probe bool, err error) {
+	if c.Breaker == nil || req.URL == nil {
+		return false, nil
+	}
+	return c.Breaker.allow(req.URL.Host)
+}
+
+// breakerRecord feeds the circuit of the host of req with an attempt.
+func (c *Client) breakerRecord(req *Request, probe bool, resp *http.Response, err error) {
+	if c.Breaker == nil || req.URL == nil {
+		return
+	}
+	if req.isCanceled() {
+		if probe {
+			c.Breaker.release(req.URL.Host)
+		}
+		return
+	}
+	failed := err != nil || resp == nil || resp.StatusCode >= 500
+	c.Breaker.record(req.URL.Host, probe, failed)
+}
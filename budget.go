@@ -0,0 +1,61 @@
+package ubernet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// SetTotalTimeout overrides Client.TotalTimeout for r, a negative timeout
+// disabling it.
+func (r *Request) SetTotalTimeout(timeout time.Duration) *Request {
+	r.totalTimeout = timeout
+	return r
+}
+
+// totalTimeout returns the total timeout of req, zero if it has none.
+func (c *Client) totalTimeout(req *Request) time.Duration {
+	switch {
+	case req.totalTimeout < 0:
+		return 0
+	case req.totalTimeout > 0:
+		return req.totalTimeout
+	}
+	return c.TotalTimeout
+}
+
+// withBudget bounds the context of req by its total timeout, returning
+// the function to pass the result of Do through, nil if it has none.
+// The budget covers reading the response body too, like http.Client's
+// Timeout.
+func (c *Client) withBudget(req *Request) func(*http.Response, error) (*http.Response, error) {
+	timeout := c.totalTimeout(req)
+	if timeout <= 0 {
+		return nil
+	}
+	parent := req.Context()
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	req.Request = req.Request.WithContext(ctx)
+	req.budgetDeadline, _ = ctx.Deadline()
+
+	return func(resp *http.Response, err error) (*http.Response, error) {
+		req.budgetDeadline = time.Time{}
+		if err != nil {
+			cancel()
+			var totalErr *ErrTotalTimeout
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil && !errors.As(err, &totalErr) {
+				err = &ErrTotalTimeout{After: timeout, Attempts: req.lastAttempt.Attempts, Err: err}
+			}
+			return resp, err
+		}
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+}
+
+// exceedsBudget reports whether waiting wait before the next attempt of
+// req would exceed its total timeout.
+func (req *Request) exceedsBudget(wait time.Duration) bool {
+	return !req.budgetDeadline.IsZero() && time.Now().Add(wait).After(req.budgetDeadline)
+}
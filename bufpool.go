@@ -0,0 +1,68 @@
+package ubernet
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBuffer is the capacity beyond which buffers are not pooled, so a
+// few large bodies do not pin memory for good.
+const maxPooledBuffer = 1 << 20
+
+// BufferStats holds the counters of the buffer pool used to buffer request
+// bodies and drain responses, for tuning.
+type BufferStats struct {
+	// Gets counts the buffers taken from the pool.
+	Gets uint64 `json:"gets"`
+	// News counts the buffers allocated because the pool was empty.
+	News uint64 `json:"news"`
+	// Puts counts the buffers put back.
+	Puts uint64 `json:"puts"`
+	// Dropped counts the buffers not put back for being too large.
+	Dropped uint64 `json:"dropped"`
+}
+
+var (
+	bufferStats BufferStats
+	bufferPool  = sync.Pool{
+		New: func() interface{} {
+			atomic.AddUint64(&bufferStats.News, 1)
+			return new(bytes.Buffer)
+		},
+	}
+)
+
+// BufferPoolStats returns the counters of the buffer pool.
+func BufferPoolStats() BufferStats {
+	return BufferStats{
+		Gets:    atomic.LoadUint64(&bufferStats.Gets),
+		News:    atomic.LoadUint64(&bufferStats.News),
+		Puts:    atomic.LoadUint64(&bufferStats.Puts),
+		Dropped: atomic.LoadUint64(&bufferStats.Dropped),
+	}
+}
+
+func getBuffer() *bytes.Buffer {
+	atomic.AddUint64(&bufferStats.Gets, 1)
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		atomic.AddUint64(&bufferStats.Dropped, 1)
+		return
+	}
+	atomic.AddUint64(&bufferStats.Puts, 1)
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// drain reads and discards up to limit bytes of r through a pooled buffer.
+func drain(r io.Reader, limit int64) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	_, err := buf.ReadFrom(io.LimitReader(r, limit))
+	return err
+}
@@ -0,0 +1,92 @@
+package ubernet
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"net/url"
+)
+
+// CanaryOptions configures CanaryMiddleware.
+type CanaryOptions struct {
+	// BaseURL replaces the scheme and host of the requests routed to the
+	// canary, and is prepended to their path.
+	BaseURL string
+	// Percent is the percentage of requests routed to the canary, from 0
+	// to 100.
+	Percent float64
+	// Header and Cookie route the requests carrying them to the canary,
+	// whatever Percent is. Their value must match HeaderValue and
+	// CookieValue, or be non-empty if those are empty.
+	Header      string
+	HeaderValue string
+	Cookie      string
+	CookieValue string
+	// StickyHeader and StickyCookie name a request header or cookie, e.g.
+	// holding a user ID. Requests with the same value are consistently
+	// routed to the same side of the split. Requests without it are routed
+	// at random.
+	StickyHeader string
+	StickyCookie string
+}
+
+// CanaryMiddleware routes a percentage of the requests, or the requests
+// matching a header or cookie, to another base URL. The route is chosen on
+// the first attempt and kept by retries.
+func CanaryMiddleware(opts CanaryOptions) (Middleware, error) {
+	base, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*http.Response, error) {
+			if req.lastAttempt.Attempts == 1 && opts.toCanary(req.Request) {
+				req.URL = mirrorURL(base, req.URL)
+				req.Host = ""
+			}
+			return next(req)
+		}
+	}, nil
+}
+
+func (opts *CanaryOptions) toCanary(req *http.Request) bool {
+	if opts.Header != "" && matches(req.Header.Get(opts.Header), opts.HeaderValue) {
+		return true
+	}
+	if opts.Cookie != "" {
+		if cookie, err := req.Cookie(opts.Cookie); err == nil && matches(cookie.Value, opts.CookieValue) {
+			return true
+		}
+	}
+	if opts.Percent <= 0 {
+		return false
+	}
+	if key := opts.stickyKey(req); key != "" {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		return float64(h.Sum32()%10000) < opts.Percent*100
+	}
+	return rand.Float64()*100 < opts.Percent
+}
+
+func (opts *CanaryOptions) stickyKey(req *http.Request) string {
+	if opts.StickyHeader != "" {
+		if v := req.Header.Get(opts.StickyHeader); v != "" {
+			return v
+		}
+	}
+	if opts.StickyCookie != "" {
+		if cookie, err := req.Cookie(opts.StickyCookie); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// matches reports whether value equals want, or is set if want is empty.
+func matches(value, want string) bool {
+	if want == "" {
+		return value != ""
+	}
+	return value == want
+}
@@ -0,0 +1,35 @@
+package ubernet
+
+import "context"
+
+// Cancel aborts the in-flight attempt and any pending backoff of r.
+// Client.Do then returns ErrCanceledByCaller.
+// It is safe to call Cancel from another goroutine, and before Do is called.
+func (r *Request) Cancel() {
+	r.cancelMu.Lock()
+	defer r.cancelMu.Unlock()
+	r.canceled = true
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+func (r *Request) isCanceled() bool {
+	r.cancelMu.Lock()
+	defer r.cancelMu.Unlock()
+	return r.canceled
+}
+
+// bindCancel returns a child of ctx which is canceled by r.Cancel, and the
+// func releasing it once the request is done.
+func (r *Request) bindCancel(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r.cancelMu.Lock()
+	defer r.cancelMu.Unlock()
+	r.cancel = cancel
+	if r.canceled {
+		cancel()
+	}
+	return ctx, cancel
+}
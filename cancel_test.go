@@ -0,0 +1,57 @@
+package ubernet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type transportFunc func(*http.Request) (*http.Response, error)
+
+func (f transportFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestDoReleasesContext(t *testing.T) {
+	var ctx context.Context
+	ok := transportFunc(func(r *http.Request) (*http.Response, error) {
+		ctx = r.Context()
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("ok")), Request: r}, nil
+	})
+	failed := transportFunc(func(r *http.Request) (*http.Response, error) {
+		ctx = r.Context()
+		return nil, errors.New("refused")
+	})
+
+	c := NewClient()
+	c.Logger = nil
+	c.RetryMax = 0
+
+	req, err := NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req.WithTransport(ok))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("context canceled before the response body was closed")
+	}
+	resp.Body.Close()
+	if ctx.Err() == nil {
+		t.Fatal("context not canceled once the response body was closed")
+	}
+
+	req, err = NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do(req.WithTransport(failed)); err == nil {
+		t.Fatal("Do succeeded, want an error")
+	}
+	if ctx.Err() == nil {
+		t.Fatal("context not canceled once Do failed")
+	}
+}
@@ -6,89 +6,113 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
 
 // Checker ..
 type Checker struct {
-	pipePool
+	pipes      PipePool
 	pollerLock sync.Mutex
-	resultPipes
-	pollerFd int32
-	isReady  chan struct{}
+	results    ResultPipes
+	poller     atomic.Value // pollerRef
+	isReady    chan struct{}
+	opts       checkerOptions
+}
+
+// pollerRef holds the poller of a Checker, nil when it is not started.
+type pollerRef struct {
+	poller
 }
 
 // NewChecker ..
-func NewChecker() *Checker {
-	return &Checker{
-		pipePool:    newPipePoolSyncPool(),
-		resultPipes: newResultPipesSyncMap(),
-		pollerFd:    -1,
-		isReady:     make(chan struct{}),
+func NewChecker(opts ...CheckerOption) *Checker {
+	c := &Checker{
+		isReady: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	switch {
+	case c.opts.pipePool != nil:
+		c.pipes = c.opts.pipePool
+	case c.opts.pipePoolSize > 0:
+		c.pipes = NewChanPipePool(c.opts.pipePoolSize)
+	default:
+		c.pipes = NewSyncPoolPipePool()
 	}
+	c.results = c.opts.resultPipes
+	if c.results == nil {
+		c.results = NewSyncMapResultPipes()
+	}
+	c.poller.Store(pollerRef{})
+	return c
 }
 
-func (c *Checker) createPoller() (pollerFd int, err error) {
+func (c *Checker) createPoller() (p poller, err error) {
 	c.pollerLock.Lock()
 	defer c.pollerLock.Unlock()
 
-	if c.pollerFD() > 0 {
-		return -1, ErrCheckerAlreadyStarted
+	if c.loadPoller() != nil {
+		return nil, ErrCheckerAlreadyStarted
 	}
 
-	pollerFd, err = createPoller()
+	p, err = newPoller(c.opts.backend)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 
-	c.setPollerFD(pollerFd)
+	c.poller.Store(pollerRef{p})
 
 	return
 }
 
-func (c *Checker) pollerFD() int {
-	return int(atomic.LoadInt32(&c.pollerFd))
-}
-
-func (c *Checker) setPollerFD(fd int) {
-	atomic.StoreInt32(&c.pollerFd, int32(fd))
+func (c *Checker) loadPoller() poller {
+	return c.poller.Load().(pollerRef).poller
 }
 
 // CheckingLoop must be called before anything else.
 // NOTE: this function blocks until ctx got canceled.
 func (c *Checker) CheckingLoop(ctx context.Context) error {
-	pollerFd, err := c.createPoller()
+	if c.opts.raiseFDLimit {
+		// Failures are logged, the Checker still works with a lower limit.
+		RaiseFDLimit(c.opts.logger)
+	}
+
+	p, err := c.createPoller()
 	if err != nil {
-		return errors.Wrap(err, "error creating poller")
+		return wrapError(err, "error creating poller")
 	}
 	defer c.closePoller()
 
 	c.setReady()
 	defer c.resetReady()
 
-	return c.pollingLoop(ctx, pollerFd)
+	return c.pollingLoop(ctx, p)
 }
 
 func (c *Checker) setReady() {
+	c.pollerLock.Lock()
+	defer c.pollerLock.Unlock()
 	close(c.isReady)
 }
 
 func (c *Checker) resetReady() {
+	c.pollerLock.Lock()
+	defer c.pollerLock.Unlock()
 	c.isReady = make(chan struct{})
 }
 
 const pollerTimeout = time.Second
 
-func (c *Checker) pollingLoop(ctx context.Context, pollerFd int) error {
+func (c *Checker) pollingLoop(ctx context.Context, p poller) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
-			events, err := pollEvents(pollerFd, pollerTimeout)
+			events, err := p.wait(pollerTimeout)
 			if err != nil {
-				return errors.Wrap(err, "error during polling loop")
+				return wrapError(err, "error during polling loop")
 			}
 
 			c.handlePollerEvents(events)
@@ -98,7 +122,7 @@ func (c *Checker) pollingLoop(ctx context.Context, pollerFd int) error {
 
 func (c *Checker) handlePollerEvents(events []event) {
 	for _, event := range events {
-		if pipe, exists := c.resultPipes.popResultPipe(event.Fd); exists {
+		if pipe, exists := c.results.PopResultPipe(event.Fd); exists {
 			pipe <- event.Err
 		}
 		// error pipe not found
@@ -111,18 +135,41 @@ func (c *Checker) closePoller() error {
 	defer c.pollerLock.Unlock()
 
 	var err error
-	if c.pollerFD() > 0 {
-		err = unix.Close(c.pollerFD())
+	if p := c.loadPoller(); p != nil {
+		err = p.close()
 	}
-	c.setPollerFD(-1)
+	c.poller.Store(pollerRef{})
 	return err
 }
 
 // CheckAddr ..
-func (c *Checker) CheckAddr(addr string, timeout time.Duration) error {
+// A timeout of zero or less stands for the default timeout of the Checker.
+func (c *Checker) CheckAddr(addr string, timeout time.Duration) (err error) {
+	if timeout <= 0 {
+		timeout = c.opts.defaultTimeout
+	}
+	if c.opts.metrics != nil {
+		start := time.Now()
+		defer func() {
+			c.opts.metrics.ObserveCheck(addr, time.Since(start), err)
+		}()
+	}
+	return c.checkAddr(addr, timeout)
+}
+
+func (c *Checker) checkAddr(addr string, timeout time.Duration) error {
 	// Set deadline
 	deadline := time.Now().Add(timeout)
 
+	// Resolve the host name with the resolver of the Checker, if any
+	if c.opts.resolver != nil {
+		resolved, err := resolveAddr(c.opts.resolver, addr, deadline)
+		if err != nil {
+			return err
+		}
+		addr = resolved
+	}
+
 	// Parse address
 	rAddr, err := parseSockAddr(addr)
 	if err != nil {
@@ -130,7 +177,7 @@ func (c *Checker) CheckAddr(addr string, timeout time.Duration) error {
 	}
 
 	// Create socket with options set
-	fd, err := createSocket()
+	fd, err := createSocket(c.opts.socketProfile)
 	if err != nil {
 		return err
 	}
@@ -153,16 +200,21 @@ func (c *Checker) CheckAddr(addr string, timeout time.Duration) error {
 
 func (c *Checker) waitConnectResult(fd int, timeout time.Duration) error {
 	// get a pipe of connect result
-	resultPipe := c.getPipe()
+	p := c.loadPoller()
+	if p == nil {
+		return ErrCheckerNotStarted
+	}
+	resultPipe := c.pipes.GetPipe()
 	defer func() {
-		c.resultPipes.deregisterResultPipe(fd)
-		c.putBackPipe(resultPipe)
+		p.deregister(fd)
+		c.results.DeregisterResultPipe(fd)
+		c.pipes.PutBackPipe(resultPipe)
 	}()
 
-	// this must be done before registerEvents
-	c.resultPipes.registerResultPipe(fd, resultPipe)
-	// Register to epoll for later error checking
-	if err := registerEvents(c.pollerFD(), fd); err != nil {
+	// this must be done before registering to the poller
+	c.results.RegisterResultPipe(fd, resultPipe)
+	// Register to the poller for later error checking
+	if err := p.register(fd); err != nil {
 		return err
 	}
 
@@ -181,5 +233,28 @@ func (c *Checker) waitPipeTimeout(pipe chan error, timeout time.Duration) error
 
 // WaitReady returns a chan which is closed when the Checker is ready for use.
 func (c *Checker) WaitReady() <-chan struct{} {
+	c.pollerLock.Lock()
+	defer c.pollerLock.Unlock()
 	return c.isReady
 }
+
+// WaitReadyContext blocks until the Checker is ready for use or ctx is done,
+// in which case it returns the error of ctx.
+func (c *Checker) WaitReadyContext(ctx context.Context) error {
+	select {
+	case <-c.WaitReady():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ready reports whether the Checker is ready for use.
+func (c *Checker) Ready() bool {
+	select {
+	case <-c.WaitReady():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,114 @@
+package ubernet
+
+import "time"
+
+// SocketProfile holds the options set on the sockets of a Checker.
+type SocketProfile struct {
+	// QuickAck enables TCP_QUICKACK. It is disabled by default, so the
+	// handshake is not acknowledged before the socket is closed.
+	QuickAck bool
+	// ZeroLinger resets connections on close instead of shutting them down
+	// gracefully, which leaves no socket in TIME_WAIT behind.
+	ZeroLinger bool
+	// Mark sets SO_MARK, which requires CAP_NET_ADMIN.
+	Mark int
+}
+
+// CheckerMetrics receives the outcome of every check of a Checker.
+type CheckerMetrics interface {
+	ObserveCheck(addr string, duration time.Duration, err error)
+}
+
+type checkerOptions struct {
+	backend        PollerBackend
+	defaultTimeout time.Duration
+	pipePoolSize   int
+	pipePool       PipePool
+	resultPipes    ResultPipes
+	socketProfile  SocketProfile
+	maxConcurrency int
+	raiseFDLimit   bool
+	logger         Logger
+	metrics        CheckerMetrics
+	resolver       HostResolver
+}
+
+// CheckerOption configures a Checker created by NewChecker.
+type CheckerOption func(*checkerOptions)
+
+// WithPoller selects the poller backend, PollerEpoll by default.
+func WithPoller(backend PollerBackend) CheckerOption {
+	return func(o *checkerOptions) {
+		o.backend = backend
+	}
+}
+
+// WithDefaultTimeout sets the timeout of the checks given no timeout.
+func WithDefaultTimeout(timeout time.Duration) CheckerOption {
+	return func(o *checkerOptions) {
+		o.defaultTimeout = timeout
+	}
+}
+
+// WithPipePoolSize preallocates size result pipes, which bounds the pipes
+// kept for reuse. By default pipes are pooled with a sync.Pool.
+func WithPipePoolSize(size int) CheckerOption {
+	return func(o *checkerOptions) {
+		o.pipePoolSize = size
+	}
+}
+
+// WithPipePool sets the pool of result pipes, overriding WithPipePoolSize.
+func WithPipePool(pool PipePool) CheckerOption {
+	return func(o *checkerOptions) {
+		o.pipePool = pool
+	}
+}
+
+// WithResultPipes sets the map of the sockets being checked to their
+// result pipe, NewSyncMapResultPipes by default. NewShardedResultPipes
+// suits Checkers registering sockets at high rates.
+func WithResultPipes(pipes ResultPipes) CheckerOption {
+	return func(o *checkerOptions) {
+		o.resultPipes = pipes
+	}
+}
+
+// WithSocketProfile sets the options of the sockets used by the checks.
+func WithSocketProfile(profile SocketProfile) CheckerOption {
+	return func(o *checkerOptions) {
+		o.socketProfile = profile
+	}
+}
+
+// WithMaxConcurrency sets the expected peak of concurrent checks, which
+// Validate makes sure the FD limit allows.
+func WithMaxConcurrency(n int) CheckerOption {
+	return func(o *checkerOptions) {
+		o.maxConcurrency = n
+	}
+}
+
+// WithRaiseFDLimit raises the soft FD limit to the hard limit when
+// CheckingLoop starts, logging the change to logger, which may be nil.
+func WithRaiseFDLimit(logger Logger) CheckerOption {
+	return func(o *checkerOptions) {
+		o.raiseFDLimit = true
+		o.logger = logger
+	}
+}
+
+// WithMetrics reports the outcome of every check to metrics.
+func WithMetrics(metrics CheckerMetrics) CheckerOption {
+	return func(o *checkerOptions) {
+		o.metrics = metrics
+	}
+}
+
+// WithResolver resolves the host names of the checked addresses with r,
+// e.g. a ResolverChain, rather than with the system resolver.
+func WithResolver(r HostResolver) CheckerOption {
+	return func(o *checkerOptions) {
+		o.resolver = r
+	}
+}
@@ -0,0 +1,120 @@
+package ubernet
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fdReserve is the number of FDs Validate keeps aside for the rest of the
+// process, e.g. listeners, log files and client connections.
+const fdReserve = 64
+
+// Validate checks the Checker can work in this environment: its poller
+// backend is available, enough FDs are left for the expected concurrency,
+// its socket profile can be applied, and a non-blocking connect to
+// localhost is reported by the poller. It is meant to be called at startup,
+// it does not need CheckingLoop to run.
+func (c *Checker) Validate() error {
+	p, err := newPoller(c.opts.backend)
+	if err != nil {
+		return &ErrCheckerValidation{"poller", err, "the poller backend is not available, try WithPoller(PollerPoll)"}
+	}
+	defer p.close()
+
+	if err := c.validateFDLimit(); err != nil {
+		return err
+	}
+
+	fd, err := createSocket(c.opts.socketProfile)
+	if err != nil {
+		hint := "check the socket profile"
+		if c.opts.socketProfile.Mark != 0 && (os.IsPermission(err) || err == unix.EPERM) {
+			hint = "setting a mark requires CAP_NET_ADMIN"
+		}
+		return &ErrCheckerValidation{"socket", err, hint}
+	}
+	defer unix.Close(fd)
+
+	if err := validateConnect(p, fd); err != nil {
+		return &ErrCheckerValidation{"connect", err, "non-blocking connect to localhost failed, check the loopback interface and local firewall"}
+	}
+	return nil
+}
+
+func (c *Checker) validateFDLimit() error {
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		return &ErrCheckerValidation{"fd limit", os.NewSyscallError("getrlimit", err), ""}
+	}
+	open, err := openFDs()
+	if err != nil {
+		return &ErrCheckerValidation{"fd limit", err, "/proc/self/fd must be readable"}
+	}
+	// Every check holds one socket.
+	need := uint64(open + c.opts.maxConcurrency + fdReserve)
+	if limit.Cur < need {
+		return &ErrCheckerValidation{
+			"fd limit",
+			fmt.Errorf("RLIMIT_NOFILE is %d, %d FDs are open and %d checks are expected", limit.Cur, open, c.opts.maxConcurrency),
+			fmt.Sprintf("raise the limit to at least %d, e.g. ulimit -n %d", need, need),
+		}
+	}
+	return nil
+}
+
+func openFDs() (int, error) {
+	f, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	return len(names), nil
+}
+
+// validateConnect connects fd to a local listener and waits for p to
+// report the result.
+func validateConnect(p poller, fd int) error {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	addr, err := parseSockAddr(ln.Addr().String())
+	if err != nil {
+		return err
+	}
+	success, err := connect(fd, addr)
+	if err != nil {
+		return &ErrConnect{err}
+	}
+	if success {
+		return nil
+	}
+
+	if err := p.register(fd); err != nil {
+		return err
+	}
+	defer p.deregister(fd)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		events, err := p.wait(100 * time.Millisecond)
+		if err != nil {
+			return err
+		}
+		for _, evt := range events {
+			if evt.Fd == fd {
+				return evt.Err
+			}
+		}
+	}
+	return fmt.Errorf("no connect result reported within a second: %w", ErrTimeout)
+}
@@ -0,0 +1,139 @@
+package ubernet
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ChecksumOptions configures ChecksumMiddleware.
+type ChecksumOptions struct {
+	// MD5 sets the Content-MD5 header.
+	MD5 bool
+	// SHA256 sets the Content-Digest header (RFC 9530).
+	SHA256 bool
+	// VerifyETag compares a strong ETag holding a hex MD5 digest, as
+	// returned by object stores, with the MD5 of the body.
+	VerifyETag bool
+	// EchoHeaders maps response headers echoing a base64 checksum of the
+	// body to their algorithm, "md5" or "sha256",
+	// e.g. "X-Amz-Checksum-Sha256": "sha256".
+	EchoHeaders map[string]string
+}
+
+// ChecksumMiddleware computes checksums of request bodies, streaming them
+// from their ReaderFunc, sets the matching headers and verifies the
+// checksums echoed by the server.
+// Checksums are computed once per request and reused by retries.
+func ChecksumMiddleware(opts ChecksumOptions) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*http.Response, error) {
+			if req.body == nil || req.streamed {
+				return next(req)
+			}
+			sums, err := opts.checksums(req)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := next(req)
+			if err != nil {
+				return resp, err
+			}
+			if err := opts.verify(resp, sums); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+}
+
+// checksums returns the base64 checksums of the body by algorithm,
+// computing them and setting the request headers on the first attempt of
+// Do, and reusing them on retries.
+func (opts *ChecksumOptions) checksums(req *Request) (map[string]string, error) {
+	if req.checksums != nil && req.lastAttempt.Attempts > 1 {
+		return req.checksums, nil
+	}
+	sums := make(map[string]string)
+	if v := req.Header.Get("Content-MD5"); v != "" {
+		sums["md5"] = v
+	}
+	if v := req.Header.Get("Content-Digest"); strings.HasPrefix(v, "sha-256=:") {
+		sums["sha256"] = strings.TrimSuffix(strings.TrimPrefix(v, "sha-256=:"), ":")
+	}
+
+	hashes := make(map[string]hash.Hash)
+	if _, ok := sums["md5"]; !ok && (opts.MD5 || opts.VerifyETag || opts.echoes("md5")) {
+		hashes["md5"] = md5.New()
+	}
+	if _, ok := sums["sha256"]; !ok && (opts.SHA256 || opts.echoes("sha256")) {
+		hashes["sha256"] = sha256.New()
+	}
+	if len(hashes) == 0 {
+		req.checksums = sums
+		return sums, nil
+	}
+
+	body, err := req.readBody()
+	if err != nil {
+		return nil, err
+	}
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	_, err = io.Copy(io.MultiWriter(writers...), body)
+	if c, ok := body.(io.Closer); ok {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for algo, h := range hashes {
+		sums[algo] = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+	if opts.MD5 {
+		req.Header.Set("Content-MD5", sums["md5"])
+	}
+	if opts.SHA256 {
+		req.Header.Set("Content-Digest", "sha-256=:"+sums["sha256"]+":")
+	}
+	req.checksums = sums
+	return sums, nil
+}
+
+func (opts *ChecksumOptions) echoes(algo string) bool {
+	for _, a := range opts.EchoHeaders {
+		if a == algo {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts *ChecksumOptions) verify(resp *http.Response, sums map[string]string) error {
+	if opts.VerifyETag {
+		etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+		if raw, err := hex.DecodeString(etag); err == nil && len(raw) == md5.Size {
+			if got := base64.StdEncoding.EncodeToString(raw); got != sums["md5"] {
+				return &ErrChecksumMismatch{Header: "ETag", Expected: sums["md5"], Got: got}
+			}
+		}
+	}
+	for header, algo := range opts.EchoHeaders {
+		got := resp.Header.Get(header)
+		if got != "" && got != sums[algo] {
+			return &ErrChecksumMismatch{Header: header, Expected: sums[algo], Got: got}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package ubernet
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// seekOnly is an io.ReadSeeker which is not an io.ReaderAt, so that its
+// replays share it.
+type seekOnly struct{ r *strings.Reader }
+
+func (s seekOnly) Read(p []byte) (int, error)                   { return s.r.Read(p) }
+func (s seekOnly) Seek(offset int64, whence int) (int64, error) { return s.r.Seek(offset, whence) }
+
+func TestChecksumMiddlewareReadSeekerBody(t *testing.T) {
+	const payload = "hello"
+	sum := sha256.Sum256([]byte(payload))
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	bodies := map[string]func() interface{}{
+		"strings.Reader": func() interface{} { return strings.NewReader(payload) },
+		"ReadSeeker":     func() interface{} { return seekOnly{strings.NewReader(payload)} },
+	}
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ := io.ReadAll(r.Body)
+				if string(got) != payload {
+					t.Errorf("server got body %q, want %q", got, payload)
+				}
+				if got := r.Header.Get("Content-Digest"); got != digest {
+					t.Errorf("Content-Digest = %q, want %q", got, digest)
+				}
+				if atomic.AddInt32(&calls, 1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer srv.Close()
+
+			c := NewClient()
+			c.Logger = nil
+			c.RetryWaitMin = time.Millisecond
+			c.RetryWaitMax = time.Millisecond
+			c.Middleware = []Middleware{ChecksumMiddleware(ChecksumOptions{SHA256: true})}
+			req, err := NewRequest("PUT", srv.URL, body())
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200", resp.StatusCode)
+			}
+			if n := atomic.LoadInt32(&calls); n != 2 {
+				t.Fatalf("%d attempts, want 2", n)
+			}
+		})
+	}
+}
@@ -3,9 +3,9 @@ package ubernet
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"math"
 	"math/rand"
@@ -14,7 +14,9 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -77,6 +79,42 @@ type LenReader interface {
 type Request struct {
 	body ReaderFunc
 	*http.Request
+	lastAttempt AttemptInfo
+	// retryMax overrides the retry settings of the Client if not nil.
+	retryMax *int
+	// prepare is called before every attempt.
+	prepare  func(*Request) error
+	trailers map[string]Trailer
+	// streamed is set if body can only be read once.
+	streamed bool
+	// streamingResponse is set for long-lived responses, see
+	// SetStreamingResponse.
+	streamingResponse bool
+	transport         http.RoundTripper
+	// label is the logical operation of the request, see SetLabel.
+	label string
+	// id is the request ID, see RequestIDOptions.
+	id string
+	// credentials overrides the Credentials of the Client if not nil.
+	credentials CredentialsProvider
+	// totalTimeout overrides the TotalTimeout of the Client if not zero,
+	// budgetDeadline is the resulting deadline during Do.
+	totalTimeout   time.Duration
+	budgetDeadline time.Time
+	// spooled holds the body when it was spooled to a temporary file,
+	// buffer when it was buffered in a pooled buffer.
+	spooled *os.File
+	buffer  *pooledBody
+	// seeker is the reader every replay of the body seeks back and reads,
+	// see readBody.
+	seeker io.Seeker
+	// checksums are the checksums of the body by algorithm, see
+	// ChecksumMiddleware.
+	checksums map[string]string
+
+	cancelMu sync.Mutex
+	canceled bool
+	cancel   context.CancelFunc
 }
 
 // WithContext ..
@@ -85,15 +123,25 @@ func (r *Request) WithContext(ctx context.Context) *Request {
 	return r
 }
 
+// WithTransport makes r be sent through t instead of the transport of the
+// Client. The settings of the Client altering its transport do not apply.
+func (r *Request) WithTransport(t http.RoundTripper) *Request {
+	r.transport = t
+	return r
+}
+
 // BodyBytes ..
 func (r *Request) BodyBytes() ([]byte, error) {
 	if r.body == nil {
 		return nil, nil
 	}
-	body, err := r.body()
+	body, err := r.readBody()
 	if err != nil {
 		return nil, err
 	}
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close()
+	}
 	buf := new(bytes.Buffer)
 	_, err = buf.ReadFrom(body)
 	if err != nil {
@@ -102,9 +150,50 @@ func (r *Request) BodyBytes() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func getBodyReaderAndContentLength(rawBody interface{}) (ReaderFunc, int64, error) {
+// readBody returns a reader of the body of r for readers other than the
+// transport. It must be closed, which seeks a reader shared with the body
+// sent back to its start.
+func (r *Request) readBody() (io.Reader, error) {
+	body, err := r.body()
+	if err != nil || r.seeker == nil {
+		return body, err
+	}
+	return rewindOnClose{Reader: body, seeker: r.seeker}, nil
+}
+
+// rewindOnClose seeks the reader it reads back to its start when closed.
+type rewindOnClose struct {
+	io.Reader
+	seeker io.Seeker
+}
+
+func (b rewindOnClose) Close() error {
+	_, err := b.seeker.Seek(0, io.SeekStart)
+	return err
+}
+
+// rewindBody sets a fresh body reader on the underlying http.Request.
+func (r *Request) rewindBody() error {
+	if r.body == nil {
+		return nil
+	}
+	body, err := r.body()
+	if err != nil {
+		return err
+	}
+	if c, ok := body.(io.ReadCloser); ok {
+		r.Body = c
+	} else {
+		r.Body = io.NopCloser(body)
+	}
+	r.wrapTrailers()
+	return nil
+}
+
+func getBodyReaderAndContentLength(rawBody interface{}) (ReaderFunc, int64, heldBody, error) {
 	var bodyReader ReaderFunc
 	var contentLength int64
+	var held heldBody
 
 	if rawBody != nil {
 		switch body := rawBody.(type) {
@@ -112,7 +201,7 @@ func getBodyReaderAndContentLength(rawBody interface{}) (ReaderFunc, int64, erro
 			bodyReader = body
 			tmp, err := body()
 			if err != nil {
-				return nil, 0, err
+				return nil, 0, heldBody{}, err
 			}
 			if lr, ok := tmp.(LenReader); ok {
 				contentLength = int64(lr.Len())
@@ -125,7 +214,7 @@ func getBodyReaderAndContentLength(rawBody interface{}) (ReaderFunc, int64, erro
 			bodyReader = body
 			tmp, err := body()
 			if err != nil {
-				return nil, 0, err
+				return nil, 0, heldBody{}, err
 			}
 			if lr, ok := tmp.(LenReader); ok {
 				contentLength = int64(lr.Len())
@@ -149,65 +238,82 @@ func getBodyReaderAndContentLength(rawBody interface{}) (ReaderFunc, int64, erro
 			contentLength = int64(buf.Len())
 
 		case *bytes.Reader:
-			buf, err := ioutil.ReadAll(body)
-			if err != nil {
-				return nil, 0, err
-			}
+			// Replay the unread part of the reader without copying it.
+			raw := body
+			offset := raw.Size() - int64(raw.Len())
 			bodyReader = func() (io.Reader, error) {
-				return bytes.NewReader(buf), nil
+				return io.NewSectionReader(raw, offset, raw.Size()-offset), nil
 			}
-			contentLength = int64(len(buf))
+			contentLength = int64(raw.Len())
 
 		case io.ReadSeeker:
 			raw := body
-			bodyReader = func() (io.Reader, error) {
-				_, err := raw.Seek(0, 0)
-				return ioutil.NopCloser(raw), err
-			}
 			if lr, ok := raw.(LenReader); ok {
 				contentLength = int64(lr.Len())
 			}
+			if at, ok := raw.(io.ReaderAt); ok {
+				// Replay the reader from its start without seeking it, so
+				// that every replay is independent.
+				size, err := raw.Seek(0, io.SeekEnd)
+				if err == nil {
+					_, err = raw.Seek(0, io.SeekStart)
+				}
+				if err != nil {
+					return nil, 0, heldBody{}, err
+				}
+				bodyReader = func() (io.Reader, error) {
+					return io.NewSectionReader(at, 0, size), nil
+				}
+				break
+			}
+			bodyReader = func() (io.Reader, error) {
+				_, err := raw.Seek(0, 0)
+				return io.NopCloser(raw), err
+			}
+			held = heldBody{seeker: raw}
 
 		case io.Reader:
-			buf, err := ioutil.ReadAll(body)
+			var err error
+			bodyReader, contentLength, held, err = spoolRequestBody(body)
 			if err != nil {
-				return nil, 0, err
-			}
-			bodyReader = func() (io.Reader, error) {
-				return bytes.NewReader(buf), nil
+				return nil, 0, heldBody{}, err
 			}
-			contentLength = int64(len(buf))
 
 		default:
-			return nil, 0, fmt.Errorf("cannot handle type %T", rawBody)
+			return nil, 0, heldBody{}, fmt.Errorf("cannot handle type %T", rawBody)
 		}
 	}
-	return bodyReader, contentLength, nil
+	return bodyReader, contentLength, held, nil
 }
 
 // FromRequest ..
 func FromRequest(r *http.Request) (*Request, error) {
-	bodyReader, _, err := getBodyReaderAndContentLength(r.Body)
+	bodyReader, _, held, err := getBodyReaderAndContentLength(r.Body)
 	if err != nil {
 		return nil, err
 	}
-	return &Request{bodyReader, r}, nil
+	req := &Request{body: bodyReader, Request: r}
+	held.holdBy(req)
+	return req, nil
 }
 
 // NewRequest ..
 func NewRequest(method, url string, rawBody interface{}) (*Request, error) {
-	bodyReader, contentLength, err := getBodyReaderAndContentLength(rawBody)
+	bodyReader, contentLength, held, err := getBodyReaderAndContentLength(rawBody)
 	if err != nil {
 		return nil, err
 	}
 
 	httpReq, err := http.NewRequest(method, url, nil)
 	if err != nil {
+		held.release()
 		return nil, err
 	}
 	httpReq.ContentLength = contentLength
 
-	return &Request{bodyReader, httpReq}, nil
+	req := &Request{body: bodyReader, Request: httpReq}
+	held.holdBy(req)
+	return req, nil
 }
 
 // Logger ..
@@ -227,6 +333,10 @@ type RetryPolicy func(ctx context.Context, resp *http.Response, err error) (bool
 // Backoff ..
 type Backoff func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration
 
+// PrepareRetry is called with the request before every retry, to refresh
+// what must not be resent as is, e.g. a token, a signature or a timestamp.
+type PrepareRetry func(req *http.Request) error
+
 // ErrorHandler ..
 type ErrorHandler func(resp *http.Response, err error, numTries int) (*http.Response, error)
 
@@ -242,6 +352,195 @@ type Client struct {
 	RetryPolicy     RetryPolicy
 	Backoff         Backoff
 	ErrorHandler    ErrorHandler
+	Auth            AuthProvider
+
+	// Credentials, if set, provides the Authorization header of every
+	// request, see Request.SetCredentials. Auth has the last word.
+	// Without credentials, Post, Put and Patch still send the
+	// AUTHORIZATION_KEY environment variable for one more release; this
+	// is deprecated, use EnvCredentials("AUTHORIZATION_KEY") instead.
+	Credentials CredentialsProvider
+
+	// Middleware wraps every attempt, see Use.
+	Middleware []Middleware
+
+	// ResponseHooks rewrite the responses returned by Do, see OnResponse.
+	ResponseHooks []ResponseHook
+
+	// StrictStatus makes Do return an *HTTPError instead of responses
+	// with a status of 400 or above, once retries are exhausted.
+	StrictStatus bool
+
+	// MaxURLLength, MaxRequestBodySize and MaxResponseBodySize guard
+	// against oversized requests and responses. Zero means no limit.
+	MaxURLLength        int
+	MaxRequestBodySize  int64
+	MaxResponseBodySize int64
+
+	// RedactHeaders overrides DefaultRedactHeaders, and Redactor replaces
+	// the default "[REDACTED]" placeholder.
+	RedactHeaders []string
+	Redactor      Redactor
+
+	// Policies overrides TLS, timeout and retry settings per destination.
+	Policies    *PolicyRegistry
+	httpClients sync.Map
+
+	// Dedupe caches successful responses of POST requests with an
+	// Idempotency-Key header.
+	Dedupe *DedupeCache
+
+	// SpoolThreshold makes response bodies io.ReadSeekCloser, spooled to a
+	// temporary file of SpoolDir beyond this size. See SpoolResponse.
+	SpoolThreshold int64
+	SpoolDir       string
+
+	// RequestID, if set, sends every request with an ID, the same for all
+	// its attempts, which are numbered. Logs and errors mention the ID.
+	RequestID *RequestIDOptions
+
+	// RateLimiter and HostRateLimiter, if set, pace every attempt, for all
+	// the hosts and per host respectively.
+	RateLimiter     RateLimiter
+	HostRateLimiter *HostRateLimiter
+
+	// RetryStatusCodes are retried, and NoRetryStatusCodes are not, whatever
+	// RetryPolicy decides for them, e.g. to retry 408 or not to retry 503
+	// without rewriting the policy.
+	RetryStatusCodes   []int
+	NoRetryStatusCodes []int
+
+	// Maintenance, if set, stops retrying the responses of a status among
+	// MaintenanceStatusCodes, 503 by default, from hosts in a maintenance
+	// window, failing with ErrMaintenance rather than hammering them.
+	Maintenance            MaintenanceCalendar
+	MaintenanceStatusCodes []int
+
+	// PreRetryGate, if set, may delay or veto every retry.
+	PreRetryGate PreRetryGate
+
+	// PrepareRetry, if set, may change the request before every retry,
+	// failing the request with ErrPrepareRetry if it returns an error.
+	PrepareRetry PrepareRetry
+
+	// RetryBudget, if set, caps the retries to a share of the requests.
+	RetryBudget *RetryBudget
+
+	// AttemptTimeout, if positive, bounds every attempt with a deadline of
+	// its own, so that a hung attempt fails with ErrAttemptTimeout and is
+	// retried, rather than consuming the whole context of the caller.
+	AttemptTimeout time.Duration
+
+	// TotalTimeout, if positive, bounds a request as a whole, attempts and
+	// backoffs included, which then fails with ErrTotalTimeout. Retries
+	// whose backoff would exceed it are not attempted. See SetTotalTimeout.
+	TotalTimeout time.Duration
+
+	// Degradation, if set, makes the Client fail fast to unhealthy hosts.
+	Degradation *Degradation
+
+	// Breaker, if set, fails the requests to the hosts failing repeatedly
+	// with ErrCircuitOpen.
+	Breaker *CircuitBreaker
+
+	// Audit, if set, tracks in-flight requests and leaked response bodies.
+	Audit *Audit
+
+	// AttemptHeaders adds the X-Ubernet-* attempt headers to responses.
+	AttemptHeaders bool
+
+	// ExpectContinueThreshold is the body size from which requests are sent
+	// with "Expect: 100-continue", zero disables it. ExpectContinueTimeout
+	// overrides the wait for the server agreement of the transport.
+	ExpectContinueThreshold int64
+	ExpectContinueTimeout   time.Duration
+	noExpectHosts           sync.Map
+
+	// ValidateIdleConns checks pooled connections are still alive before
+	// reusing them, and silently discards dead ones.
+	ValidateIdleConns bool
+
+	// MaxConnAge and MaxConnRequests rotate connections once they are older
+	// or served more requests, so that long-lived processes spread across
+	// load balancers and follow DNS changes. Zero means no limit.
+	MaxConnAge      time.Duration
+	MaxConnRequests int
+
+	// WatchDNSHosts are the hosts resolved by WatchDNS every
+	// WatchDNSInterval, 30 seconds by default.
+	WatchDNSHosts    []string
+	WatchDNSInterval time.Duration
+	conns            sync.Map
+
+	counters clientCounters
+
+	// ReresolveOnFailure makes the attempt following a connection level
+	// failure resolve the host again, preferring addresses not tried yet.
+	ReresolveOnFailure bool
+
+	// ResolveTimeout limits the resolution of host names, which then fails
+	// with ErrResolveTimeout rather than consuming the dial timeout.
+	ResolveTimeout time.Duration
+
+	// HostAlias maps host names, or "host:port", to the IP addresses to
+	// connect to in their place, bypassing DNS like curl --resolve. The URL,
+	// and so the Host header and TLS server name, are left untouched.
+	HostAlias map[string][]string
+
+	// SessionCache, if set, is shared by the TLS connections of the Client
+	// to resume sessions. Policy.DisableResumption opts destinations out.
+	SessionCache *TLSSessionCache
+
+	// ECH, if set, encrypts the Client Hello of the TLS connections.
+	ECH *ECHOptions
+
+	// HTTPSRecords, if set, looks up the HTTPS DNS records of the hosts
+	// of https URLs, whose alternative endpoints and ports are dialed
+	// before the host itself.
+	HTTPSRecords HTTPSLookup
+
+	// Throttle, if set, limits the bandwidth of the connections.
+	Throttle *ThrottleOptions
+
+	// TrafficAccounting counts the bytes exchanged by host and by request
+	// label, see Traffic.
+	TrafficAccounting bool
+	traffic           clientTraffic
+
+	// LabelLimits limits the requests by label, see Request.SetLabel.
+	LabelLimits map[string]LabelLimit
+	limiters    labelLimiters
+
+	// GzipThreshold, if positive, gzips the bodies of at least as many
+	// bytes sent by Post, PostForm, Put and Patch, when their size is
+	// known. GzipLevel is the compression level, by default favoring
+	// speed over size for bodies of 4MiB or more.
+	GzipThreshold int64
+	GzipLevel     int
+
+	// ReplayLog, if set, saves the requests failing in Do, to be replayed
+	// later by a Replayer.
+	ReplayLog *ReplayWriter
+
+	// HAR, if set, records the attempts while enabled, to be exported as
+	// an HTTP Archive.
+	HAR *HARRecorder
+
+	// Tracer, if set, traces the requests and their attempts.
+	Tracer Tracer
+
+	// Metrics, if set, records the requests, their attempts and backoffs.
+	Metrics Metrics
+
+	// DryRun, if set, records the requests instead of sending them.
+	DryRun *DryRun
+
+	// AsyncWorkers and AsyncQueueSize size the pool used by DoAsync,
+	// AsyncQueueFull tells what to do when its queue is full.
+	AsyncWorkers   int
+	AsyncQueueSize int
+	AsyncQueueFull QueueFullPolicy
+	async          asyncPool
 }
 
 // NewClient ..
@@ -263,17 +562,51 @@ func defaultRetryPolicy(ctx context.Context, resp *http.Response, err error) (bo
 	}
 
 	if err != nil {
+		var tooLarge *ErrRequestBodyTooLarge
+		var violation *ErrSchemaViolation
+		if errors.As(err, &tooLarge) || errors.As(err, &violation) || errors.Is(err, ErrBodyNotReplayable) {
+			return false, err
+		}
 		return true, err
 	}
 
 	if resp.StatusCode == 0 || (resp.StatusCode >= 500 && resp.StatusCode != 501) {
 		return true, nil
 	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// Only when the server tells when to come back.
+		_, ok := retryAfter(resp, time.Now())
+		return ok, nil
+	}
 
 	return false, nil
 }
 
+// retryStatus returns whether to retry a response of status code, retry
+// being the decision of the RetryPolicy.
+func (c *Client) retryStatus(code int, retry bool) bool {
+	for _, s := range c.NoRetryStatusCodes {
+		if s == code {
+			return false
+		}
+	}
+	for _, s := range c.RetryStatusCodes {
+		if s == code {
+			return true
+		}
+	}
+	return retry
+}
+
+// defaultBackoff waits exponentially longer from min to max, or as long as
+// the Retry-After header of 429 and 503 responses asks, up to max.
 func defaultBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if wait, ok := retryAfter(resp, time.Now()); ok {
+		if wait > max {
+			wait = max
+		}
+		return wait
+	}
 	mult := math.Pow(2, float64(attemptNum)) * float64(min)
 	sleep := time.Duration(mult)
 	if float64(sleep) != mult || sleep > max {
@@ -282,6 +615,49 @@ func defaultBackoff(min, max time.Duration, attemptNum int, resp *http.Response)
 	return sleep
 }
 
+// DefaultRetryPolicy is the RetryPolicy of NewClient: it retries
+// connection errors, 5xx responses other than 501, and 429 responses with
+// a valid Retry-After header.
+func DefaultRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	return defaultRetryPolicy(ctx, resp, err)
+}
+
+// DefaultBackoff is the Backoff of NewClient: it waits exponentially
+// longer from min to max, or as long as the Retry-After header of 429 and
+// 503 responses asks, up to max.
+func DefaultBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	return defaultBackoff(min, max, attemptNum, resp)
+}
+
+// retryAfter returns the wait the Retry-After header of a 429 or 503
+// response asks for, in seconds or as an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(math.MaxInt64/time.Second) {
+			return time.Duration(math.MaxInt64), true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
 // LinearJitterBackoff ..
 func LinearJitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
 	attemptNum++
@@ -302,47 +678,231 @@ func PassthroughErrorHandler(resp *http.Response, err error, _ int) (*http.Respo
 }
 
 // Do ..
-func (c *Client) Do(req *Request) (*http.Response, error) {
+func (c *Client) Do(req *Request) (resp *http.Response, err error) {
+	if req.isCanceled() {
+		return nil, ErrCanceledByCaller
+	}
+	if c.Audit != nil {
+		c.Audit.requestStarted()
+		defer c.Audit.requestDone()
+	}
+
+	origReq := req.Request
+	ctx, cancel := req.bindCancel(req.Context())
+	req.Request = req.Request.WithContext(ctx)
+	defer func() {
+		req.Request = origReq
+		req.releaseBody()
+		// The context lives until the body of the response is closed.
+		if resp != nil && resp.Body != nil {
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		} else {
+			cancel()
+		}
+	}()
+
+	req.lastAttempt = AttemptInfo{}
+	if c.RequestID != nil {
+		c.assignRequestID(req)
+	}
+	var endSpan func(*http.Response, error)
+	if c.Tracer != nil {
+		endSpan = c.traceRequest(req)
+	}
+	var startedAt time.Time
+	if c.Metrics != nil {
+		startedAt = time.Now()
+	}
+	budget := c.withBudget(req)
+	resp, err = c.dispatch(req)
+	if budget != nil {
+		resp, err = budget(resp, err)
+	}
+	if err != nil && req.id != "" {
+		err = wrapError(err, "request "+req.id)
+	}
+	if endSpan != nil {
+		endSpan(resp, err)
+	}
+	if c.Metrics != nil {
+		c.Metrics.ObserveRequest(req, resp, err, time.Since(startedAt))
+	}
+	if err != nil && c.ReplayLog != nil && !req.isCanceled() {
+		c.logReplay(req, err)
+	}
+	if err != nil && req.isCanceled() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, ErrCanceledByCaller
+	}
+	if len(c.ResponseHooks) > 0 && err == nil {
+		if resp, err = c.transformResponse(req, resp); err != nil {
+			return nil, err
+		}
+	}
+	if c.StrictStatus && err == nil && resp.StatusCode >= 400 {
+		return nil, c.newHTTPError(req, resp)
+	}
+	if c.SpoolThreshold > 0 && err == nil && !req.streamingResponse {
+		if err := SpoolResponse(resp, c.SpoolThreshold, c.SpoolDir); err != nil {
+			return nil, err
+		}
+	}
+	if c.AttemptHeaders && resp != nil {
+		setAttemptHeaders(resp, req.lastAttempt)
+	}
+	if c.Audit != nil && resp != nil {
+		c.Audit.trackBody(resp)
+	}
+	return resp, err
+}
+
+// dispatch performs req once the limits of its label let it go.
+func (c *Client) dispatch(req *Request) (*http.Response, error) {
+	if len(c.LabelLimits) > 0 && req.label != "" {
+		release, err := c.acquireLabel(req.Context(), req)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	if c.Dedupe != nil {
+		return c.doDedupe(req)
+	}
+	return c.do(req)
+}
 
+func (c *Client) do(req *Request) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 
+	if err := c.checkRequestLimits(req); err != nil {
+		return nil, err
+	}
+
+	retryWaitMin, retryWaitMax, retryMax := c.retrySettings(c.policyFor(req))
+	if req.retryMax != nil {
+		retryMax = *req.retryMax
+	}
+	c.updateDegradation(req)
+	retryMax = c.degradeRetryMax(req, retryMax)
+
+	startedAt := time.Now()
+	defer func() {
+		req.lastAttempt.Elapsed = time.Since(startedAt)
+	}()
+
+	var dns *reresolveState
+	if c.ReresolveOnFailure {
+		dns = withReresolve(req)
+	}
+
+	var attemptErrs AttemptErrors
+	var wait time.Duration
+	if c.RetryBudget != nil {
+		c.RetryBudget.deposit()
+	}
+
 	for i := 0; ; i++ {
 		var code int
 
-		if req.body != nil {
-			body, err := req.body()
-			if err != nil {
+		if err := c.rewindBody(req); err != nil {
+			return resp, err
+		}
+		if req.prepare != nil {
+			if err := req.prepare(req); err != nil {
 				return resp, err
 			}
-			if c, ok := body.(io.ReadCloser); ok {
-				req.Body = c
-			} else {
-				req.Body = ioutil.NopCloser(body)
+		}
+		if i > 0 {
+			c.updateDegradation(req)
+		}
+		if i > 0 && c.PrepareRetry != nil {
+			if err := c.PrepareRetry(req.Request); err != nil {
+				c.countGiveUp(req)
+				return nil, &ErrPrepareRetry{Attempts: i, Err: err}
+			}
+		}
+
+		if c.RateLimiter != nil || c.HostRateLimiter != nil {
+			if err := c.waitRateLimit(req); err != nil {
+				return nil, err
 			}
 		}
 
+		probe, breakerErr := c.breakerAllow(req)
+		if breakerErr != nil {
+			return nil, breakerErr
+		}
+
 		if c.RequestLogHook != nil {
-			c.RequestLogHook(c.Logger, req.Request, i)
+			c.RequestLogHook(c.Logger, c.redactRequest(req.Request), i)
 		}
 
-		resp, err = c.HTTPClient.Do(req.Request)
+		req.lastAttempt.Attempts++
+		if c.RequestID != nil {
+			c.setAttemptHeader(req, i+1)
+		}
+		if c.TrafficAccounting {
+			c.accountRequest(req)
+		}
+		var endSpan func(*http.Response, error)
+		if c.Tracer != nil {
+			endSpan = c.traceAttempt(req, i+1, wait)
+		}
+		attemptStart := time.Now()
+		endAttempt := c.withAttemptTimeout(req)
+		resp, err = c.roundTrip(req)
+		if endAttempt != nil {
+			resp, err = endAttempt(resp, err)
+		}
+		if endSpan != nil {
+			endSpan(resp, err)
+		}
+		err = c.redactError(err)
+		c.recordOutcome(req, resp, err)
+		c.breakerRecord(req, probe, resp, err)
+		c.countAttempt(req, resp, err)
+		if c.Metrics != nil {
+			c.Metrics.ObserveAttempt(req, resp, err, time.Since(attemptStart))
+		}
+		if c.HAR.Enabled() {
+			c.recordHAR(req, resp, err, attemptStart)
+		}
+		if err == nil {
+			if c.TrafficAccounting {
+				c.accountResponse(req, resp)
+			}
+			if resp, err = c.limitResponse(resp); err != nil {
+				return nil, err
+			}
+		}
 		if resp != nil {
 			code = resp.StatusCode
+			req.lastAttempt.TLS = NewTLSInfo(resp.TLS)
 		}
 
 		checkOK, checkErr := c.RetryPolicy(req.Context(), resp, err)
+		if err == nil && checkErr == nil && (c.RetryStatusCodes != nil || c.NoRetryStatusCodes != nil) {
+			checkOK = c.retryStatus(resp.StatusCode, checkOK)
+		}
 
 		if err != nil {
 			if c.Logger != nil {
-				c.Logger.Printf("ERROR %s %s request failed: %v", req.Method, req.URL, err)
+				c.Logger.Printf("ERROR %s request failed: %v", c.describe(req), err)
 			}
 		} else {
 			if c.ResponseLogHook != nil {
-				c.ResponseLogHook(c.Logger, resp)
+				c.ResponseLogHook(c.Logger, c.redactResponse(resp))
 			}
 		}
 
+		// Long-lived responses are not retried once they started.
+		if req.streamingResponse && err == nil {
+			return resp, nil
+		}
+
 		if !checkOK {
 			if checkErr != nil {
 				err = checkErr
@@ -350,21 +910,54 @@ func (c *Client) Do(req *Request) (*http.Response, error) {
 			return resp, err
 		}
 
-		remain := c.RetryMax - i
+		attemptErrs = append(attemptErrs, &AttemptError{
+			Attempt:    i + 1,
+			StartedAt:  attemptStart,
+			Duration:   time.Since(attemptStart),
+			StatusCode: code,
+			Err:        err,
+		})
+
+		remain := retryMax - i
 		if remain <= 0 {
 			break
 		}
 
+		if c.Maintenance != nil {
+			if w, ok := c.maintenanceWindow(req, code); ok {
+				c.drainBody(resp.Body)
+				c.countGiveUp(req)
+				return nil, &ErrMaintenance{Host: req.URL.Hostname(), Window: w, Err: attemptErrs}
+			}
+		}
+
+		if c.PreRetryGate != nil {
+			if retry, resp, err := c.gateRetry(req, i+1, resp, err, attemptErrs); !retry {
+				c.countGiveUp(req)
+				return resp, err
+			}
+		}
+
+		c.prepareReresolve(dns, req, err)
+
 		if err == nil && resp != nil {
 			c.drainBody(resp.Body)
 		}
 
-		wait := c.Backoff(c.RetryWaitMin, c.RetryWaitMax, i, resp)
-		desc := fmt.Sprintf("%s %s", req.Method, req.URL)
-		if code > 0 {
-			desc = fmt.Sprintf("%s (status: %d)", desc, code)
+		wait = c.Backoff(retryWaitMin, retryWaitMax, i, resp)
+		if req.exceedsBudget(wait) {
+			c.countGiveUp(req)
+			return nil, &ErrTotalTimeout{After: c.totalTimeout(req), Attempts: i + 1, Err: attemptErrs}
+		}
+		if c.RetryBudget != nil && !c.RetryBudget.withdraw() {
+			c.countGiveUp(req)
+			return nil, &ErrRetryBudgetExhausted{Attempts: i + 1, Err: attemptErrs}
 		}
 		if c.Logger != nil {
+			desc := c.describe(req)
+			if code > 0 {
+				desc = fmt.Sprintf("%s (status: %d)", desc, code)
+			}
 			c.Logger.Printf("WARNING %s: retrying in %s (%d left)", desc, wait, remain)
 		}
 		select {
@@ -372,22 +965,67 @@ func (c *Client) Do(req *Request) (*http.Response, error) {
 			return nil, req.Context().Err()
 		case <-time.After(wait):
 		}
+		req.lastAttempt.Backoff += wait
+		c.countRetry(req)
+		if c.Metrics != nil {
+			c.Metrics.ObserveBackoff(req, wait)
+		}
 	}
 
+	c.countGiveUp(req)
 	if c.ErrorHandler != nil {
-		return c.ErrorHandler(resp, err, c.RetryMax+1)
+		return c.ErrorHandler(resp, err, retryMax+1)
 	}
 
 	if resp != nil {
 		resp.Body.Close()
 	}
-	return nil, fmt.Errorf("%s %s giving up after %d attempts", req.Method, req.URL, c.RetryMax+1)
+	return nil, fmt.Errorf("%s %s giving up after %d attempts: %w", req.Method, c.redactURL(req.URL), retryMax+1, attemptErrs)
+}
+
+// sendAuthorized sends req, answering an authentication challenge if needed.
+func (c *Client) sendAuthorized(req *Request) (*http.Response, error) {
+	if req.credentials != nil || c.Credentials != nil {
+		if err := c.applyCredentials(req); err != nil {
+			return nil, err
+		}
+	}
+	send := func(req *Request) (*http.Response, error) {
+		return c.degradeHTTPClient(req, c.httpClientFor(req)).Do(req.Request)
+	}
+	if c.DryRun != nil {
+		send = c.sendDryRun
+	}
+	if c.Auth == nil {
+		return send(req)
+	}
+
+	if err := c.Auth.Authorize(req.Request); err != nil {
+		return nil, err
+	}
+	resp, err := send(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	retry, err := c.Auth.Challenge(req.Request, resp)
+	if err != nil || !retry {
+		return resp, err
+	}
+	c.drainBody(resp.Body)
+
+	if err := c.rewindBody(req); err != nil {
+		return nil, err
+	}
+	if err := c.Auth.Authorize(req.Request); err != nil {
+		return nil, err
+	}
+	return send(req)
 }
 
 func (c *Client) drainBody(body io.ReadCloser) {
 	defer body.Close()
-	_, err := io.Copy(ioutil.Discard, io.LimitReader(body, respReadLimit))
-	if err != nil {
+	if err := drain(body, respReadLimit); err != nil {
 		if c.Logger != nil {
 			c.Logger.Printf("ERROR error reading response body: %v", err)
 		}
@@ -429,12 +1067,84 @@ func Post(url, bodyType string, body interface{}) (*http.Response, error) {
 
 // Post ..
 func (c *Client) Post(url, bodyType string, body interface{}) (*http.Response, error) {
-	req, err := NewRequest("POST", url, body)
+	return c.doWithBody("POST", url, bodyType, body)
+}
+
+// Put ..
+func Put(url, bodyType string, body interface{}) (*http.Response, error) {
+	return defaultClient.Put(url, bodyType, body)
+}
+
+// Put ..
+func (c *Client) Put(url, bodyType string, body interface{}) (*http.Response, error) {
+	return c.doWithBody("PUT", url, bodyType, body)
+}
+
+// Patch ..
+func Patch(url, bodyType string, body interface{}) (*http.Response, error) {
+	return defaultClient.Patch(url, bodyType, body)
+}
+
+// Patch ..
+func (c *Client) Patch(url, bodyType string, body interface{}) (*http.Response, error) {
+	return c.doWithBody("PATCH", url, bodyType, body)
+}
+
+func (c *Client) doWithBody(method, url, bodyType string, body interface{}) (*http.Response, error) {
+	req, err := c.newRequestWithBody(method, url, bodyType, body)
+	if err != nil {
+		return nil, err
+	}
+	c.applyLegacyCredentials(req)
+	return c.Do(req)
+}
+
+// newRequestWithBody returns a request of body of type bodyType, gzipped
+// according to GzipThreshold.
+func (c *Client) newRequestWithBody(method, url, bodyType string, body interface{}) (*Request, error) {
+	var gzipped bool
+	if c.GzipThreshold > 0 {
+		var err error
+		if body, gzipped, err = c.compressBody(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", bodyType)
-	req.Header.Add("authorization", os.Getenv("AUTHORIZATION_KEY"))
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, nil
+}
+
+// Delete ..
+func Delete(url string) (*http.Response, error) {
+	return defaultClient.Delete(url)
+}
+
+// Delete ..
+func (c *Client) Delete(url string) (*http.Response, error) {
+	req, err := NewRequest("DELETE", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Options ..
+func Options(url string) (*http.Response, error) {
+	return defaultClient.Options(url)
+}
+
+// Options ..
+func (c *Client) Options(url string) (*http.Response, error) {
+	req, err := NewRequest("OPTIONS", url, nil)
+	if err != nil {
+		return nil, err
+	}
 	return c.Do(req)
 }
 
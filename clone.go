@@ -0,0 +1,57 @@
+package ubernet
+
+import (
+	"context"
+	"io"
+)
+
+// Clone returns a deep copy of r with its context changed to ctx, which can
+// be sent concurrently with r, e.g. to mirror traffic. The body is read
+// once and replayed from a private copy, spooled to disk like the bodies
+// of NewRequest, so streamed bodies can not be cloned. The attempt info
+// and cancellation of r are not copied.
+// Trailers are shared unless they implement interface{ Clone() Trailer }.
+func (r *Request) Clone(ctx context.Context) (*Request, error) {
+	if r.streamed {
+		return nil, ErrBodyNotReplayable
+	}
+	clone := &Request{
+		Request:   r.Request.Clone(ctx),
+		prepare:   r.prepare,
+		transport: r.transport,
+
+		streamingResponse: r.streamingResponse,
+		label:             r.label,
+		totalTimeout:      r.totalTimeout,
+		credentials:       r.credentials,
+	}
+	if r.body != nil {
+		body, err := r.readBody()
+		if err != nil {
+			return nil, err
+		}
+		var held heldBody
+		clone.body, _, held, err = spoolRequestBody(body)
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		held.holdBy(clone)
+	}
+	if r.retryMax != nil {
+		retryMax := *r.retryMax
+		clone.retryMax = &retryMax
+	}
+	if r.trailers != nil {
+		clone.trailers = make(map[string]Trailer, len(r.trailers))
+		for name, t := range r.trailers {
+			if cloner, ok := t.(interface{ Clone() Trailer }); ok {
+				t = cloner.Clone()
+			}
+			clone.trailers[name] = t
+		}
+	}
+	return clone, nil
+}
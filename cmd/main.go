@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -126,7 +127,9 @@ func (cc *ConcurrentChecker) Launch(ctx context.Context) error {
 	if cc.conf.Verbose {
 		fmt.Println("Waiting for checker to be ready")
 	}
-	<-cc.checker.WaitReady()
+	if err := cc.checker.WaitReadyContext(ctx); err != nil {
+		return err
+	}
 
 	go func() {
 		for i := 0; i < cc.conf.Requests; i++ {
@@ -139,16 +142,17 @@ func (cc *ConcurrentChecker) Launch(ctx context.Context) error {
 func (cc *ConcurrentChecker) doCheck() {
 	err := cc.checker.CheckAddr(cc.conf.Addr, cc.conf.Timeout)
 	cc.counter.Inc(CRequest)
-	switch err {
-	case ubernet.ErrTimeout:
+	var connectErr *ubernet.ErrConnect
+	switch {
+	case errors.Is(err, ubernet.ErrTimeout):
 		cc.counter.Inc(CErrTimeout)
-	case nil:
+	case err == nil:
 		cc.counter.Inc(CSucceed)
 	default:
 		if cc.conf.Verbose {
 			fmt.Println(err)
 		}
-		if _, ok := err.(*ubernet.ErrConnect); ok {
+		if errors.As(err, &connectErr) {
 			cc.counter.Inc(CErrConnect)
 		} else {
 			cc.counter.Inc(CErrOther)
@@ -0,0 +1,73 @@
+package ubernet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// bodyBytes returns the content of body if its size is known in advance
+// and it can be read from memory, ok reporting whether it could.
+func bodyBytes(body interface{}) (data []byte, ok bool, err error) {
+	switch b := body.(type) {
+	case []byte:
+		return b, true, nil
+	case *bytes.Buffer:
+		return b.Bytes(), true, nil
+	case LenReader:
+		r, isReader := body.(io.Reader)
+		if !isReader {
+			return nil, false, nil
+		}
+		data = make([]byte, 0, b.Len())
+		buf := bytes.NewBuffer(data)
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, false, err
+		}
+		return buf.Bytes(), true, nil
+	}
+	return nil, false, nil
+}
+
+// compressBody returns body gzipped if its size reaches GzipThreshold,
+// gzipped reporting whether it was. Bodies of unknown size, and the ones
+// gzip does not make smaller, are sent as is.
+func (c *Client) compressBody(body interface{}) (_ interface{}, gzipped bool, err error) {
+	data, ok, err := bodyBytes(body)
+	if err != nil || !ok {
+		return body, false, err
+	}
+	if int64(len(data)) < c.GzipThreshold {
+		return data, false, nil
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, c.gzipLevel(len(data)))
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, false, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false, err
+	}
+	if buf.Len() >= len(data) {
+		return data, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+// gzipLevelSpeedSize is the size from which bodies are compressed for
+// speed rather than size.
+const gzipLevelSpeedSize = 4 << 20
+
+func (c *Client) gzipLevel(size int) int {
+	if c.GzipLevel != 0 {
+		return c.GzipLevel
+	}
+	if size >= gzipLevelSpeedSize {
+		return gzip.BestSpeed
+	}
+	return gzip.DefaultCompression
+}
@@ -0,0 +1,248 @@
+package ubernet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config holds the Client settings which can be tuned without recompiling.
+// It is serialized by a ConfigCodec, JSON by default.
+type Config struct {
+	// Timeout limits a whole attempt, zero means no limit.
+	Timeout      Duration `json:"timeout" yaml:"timeout"`
+	RetryWaitMin Duration `json:"retry_wait_min" yaml:"retry_wait_min"`
+	RetryWaitMax Duration `json:"retry_wait_max" yaml:"retry_wait_max"`
+	RetryMax     int      `json:"retry_max" yaml:"retry_max"`
+	// RetryPolicy and Backoff are names registered with RegisterRetryPolicy
+	// and RegisterBackoff.
+	RetryPolicy string `json:"retry_policy" yaml:"retry_policy"`
+	Backoff     string `json:"backoff" yaml:"backoff"`
+	// Proxy is the proxy URL, the environment is used if empty.
+	Proxy string    `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	TLS   TLSConfig `json:"tls" yaml:"tls"`
+	// KeepAlive enables connection pooling.
+	KeepAlive bool `json:"keep_alive" yaml:"keep_alive"`
+	// RaiseFDLimit raises the soft FD limit to the hard limit when the
+	// Client is created.
+	RaiseFDLimit bool `json:"raise_fd_limit,omitempty" yaml:"raise_fd_limit,omitempty"`
+}
+
+// TLSConfig holds the paths of TLS material of a Config.
+type TLSConfig struct {
+	CAFile             string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+// Duration is a time.Duration serialized as a string like "1m30s".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ConfigCodec serializes a Config, e.g. to YAML with a third party package.
+type ConfigCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.MarshalIndent(v, "", "  ") }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// JSONCodec is the ConfigCodec used when none is given.
+var JSONCodec ConfigCodec = jsonCodec{}
+
+var (
+	namedMu       sync.RWMutex
+	retryPolicies = map[string]RetryPolicy{
+		"default": defaultRetryPolicy,
+	}
+	backoffs = map[string]Backoff{
+		"default":       defaultBackoff,
+		"exponential":   defaultBackoff,
+		"linear-jitter": LinearJitterBackoff,
+	}
+)
+
+// RegisterRetryPolicy makes policy available to Config by name.
+func RegisterRetryPolicy(name string, policy RetryPolicy) {
+	namedMu.Lock()
+	defer namedMu.Unlock()
+	retryPolicies[name] = policy
+}
+
+// RegisterBackoff makes backoff available to Config by name.
+func RegisterBackoff(name string, backoff Backoff) {
+	namedMu.Lock()
+	defer namedMu.Unlock()
+	backoffs[name] = backoff
+}
+
+// DefaultConfig returns the Config matching NewClient.
+func DefaultConfig() *Config {
+	return &Config{
+		RetryWaitMin: Duration(defaultRetryWaitMin),
+		RetryWaitMax: Duration(defaultRetryWaitMax),
+		RetryMax:     defaultRetryMax,
+		RetryPolicy:  "default",
+		Backoff:      "default",
+	}
+}
+
+// Validate checks the settings of conf.
+func (conf *Config) Validate() error {
+	if conf.Timeout < 0 || conf.RetryWaitMin < 0 || conf.RetryWaitMax < 0 {
+		return fmt.Errorf("config: durations must not be negative")
+	}
+	if conf.RetryWaitMax < conf.RetryWaitMin {
+		return fmt.Errorf("config: retry_wait_max %s is lower than retry_wait_min %s",
+			time.Duration(conf.RetryWaitMax), time.Duration(conf.RetryWaitMin))
+	}
+	if conf.RetryMax < 0 {
+		return fmt.Errorf("config: retry_max must not be negative")
+	}
+
+	namedMu.RLock()
+	_, okPolicy := retryPolicies[conf.RetryPolicy]
+	_, okBackoff := backoffs[conf.Backoff]
+	namedMu.RUnlock()
+	if !okPolicy {
+		return fmt.Errorf("config: unknown retry_policy %q", conf.RetryPolicy)
+	}
+	if !okBackoff {
+		return fmt.Errorf("config: unknown backoff %q", conf.Backoff)
+	}
+
+	if conf.Proxy != "" {
+		if _, err := url.Parse(conf.Proxy); err != nil {
+			return fmt.Errorf("config: invalid proxy: %w", err)
+		}
+	}
+	if (conf.TLS.CertFile == "") != (conf.TLS.KeyFile == "") {
+		return fmt.Errorf("config: tls cert_file and key_file must be set together")
+	}
+	return nil
+}
+
+// LoadConfig reads a Config from r, filling missing settings with the
+// defaults, and validates it. codec may be nil for JSON.
+func LoadConfig(r io.Reader, codec ConfigCodec) (*Config, error) {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	conf := DefaultConfig()
+	if err := codec.Unmarshal(data, conf); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// SaveConfig writes conf to w. codec may be nil for JSON.
+func SaveConfig(w io.Writer, conf *Config, codec ConfigCodec) error {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	data, err := codec.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// NewClientFromConfig returns a Client with the settings of conf.
+func NewClientFromConfig(conf *Config) (*Client, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	var transport *http.Transport
+	if conf.KeepAlive {
+		transport = defaultPooledTransport()
+	} else {
+		transport = defaultTransport()
+	}
+	if conf.Proxy != "" {
+		proxy, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	tlsConf, err := conf.TLS.load()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConf
+
+	namedMu.RLock()
+	defer namedMu.RUnlock()
+
+	c := NewClient()
+	c.HTTPClient = &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(conf.Timeout),
+	}
+	c.RetryWaitMin = time.Duration(conf.RetryWaitMin)
+	c.RetryWaitMax = time.Duration(conf.RetryWaitMax)
+	c.RetryMax = conf.RetryMax
+	c.RetryPolicy = retryPolicies[conf.RetryPolicy]
+	c.Backoff = backoffs[conf.Backoff]
+	if conf.RaiseFDLimit {
+		RaiseFDLimit(c.Logger)
+	}
+	return c, nil
+}
+
+func (t *TLSConfig) load() (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("config: no certificate found in %s", t.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
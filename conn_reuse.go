@@ -0,0 +1,105 @@
+package ubernet
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// connReuseTrace records whether an attempt was sent on a pooled connection
+// and whether any byte of the response was read.
+type connReuseTrace struct {
+	reused      int32
+	gotResponse int32
+	trace       httptrace.ClientTrace
+}
+
+func (t *connReuseTrace) clientTrace() *httptrace.ClientTrace {
+	t.trace.GotConn = func(info httptrace.GotConnInfo) {
+		if info.Reused {
+			atomic.StoreInt32(&t.reused, 1)
+		}
+	}
+	t.trace.GotFirstResponseByte = func() {
+		atomic.StoreInt32(&t.gotResponse, 1)
+	}
+	return &t.trace
+}
+
+// isReuseRace reports whether err was caused by the server closing a pooled
+// keep-alive connection right before the request was written on it.
+func (t *connReuseTrace) isReuseRace(req *http.Request, err error) bool {
+	if atomic.LoadInt32(&t.reused) == 0 || atomic.LoadInt32(&t.gotResponse) != 0 {
+		return false
+	}
+	if !isIdempotent(req) {
+		return false
+	}
+	return errors.Is(err, ErrStaleConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		strings.Contains(err.Error(), "server closed idle connection")
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// send performs a single attempt.
+// If it failed on a dead pooled connection it is sent again right away,
+// without consuming a retry or waiting for backoff.
+func (c *Client) send(req *Request) (*http.Response, error) {
+	if req.streamed || !isIdempotent(req.Request) {
+		return c.sendTraced(req, nil)
+	}
+	var trace connReuseTrace
+	resp, err := c.sendTraced(req, trace.clientTrace())
+	if err == nil || !trace.isReuseRace(req.Request, err) {
+		return resp, err
+	}
+
+	if c.Logger != nil {
+		c.Logger.Printf("DEBUG %s: pooled connection was closed by server, resending", c.describe(req))
+	}
+	if err := c.rewindBody(req); err != nil {
+		return nil, err
+	}
+	return c.sendTraced(req, nil)
+}
+
+// sendTraced sends req with trace and the tracing needed by the Client
+// attached to the context of its http.Request, restored once sent.
+func (c *Client) sendTraced(req *Request, trace *httptrace.ClientTrace) (*http.Response, error) {
+	managed := c.managesConns()
+	if trace == nil && !managed {
+		return c.sendAuthorized(req)
+	}
+
+	ctx := req.Context()
+	if trace != nil {
+		ctx = httptrace.WithClientTrace(ctx, trace)
+	}
+	if managed {
+		// WithClientTrace composes the given trace with the ones already
+		// in ctx by modifying it, so the shared trace is copied.
+		mt := *managedConnTrace
+		ctx = httptrace.WithClientTrace(ctx, &mt)
+	}
+	orig := req.Request
+	req.Request = orig.WithContext(ctx)
+	defer func() {
+		req.Request = orig
+	}()
+	return c.sendAuthorized(req)
+}
@@ -0,0 +1,134 @@
+package ubernet
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// managesConns reports whether connections must be dialed as managedConn.
+func (c *Client) managesConns() bool {
+	return c.ValidateIdleConns || c.MaxConnAge > 0 || c.MaxConnRequests > 0 || len(c.WatchDNSHosts) > 0 || c.ReresolveOnFailure
+}
+
+// managedConn is a connection dialed by the transport of a Client, which
+// can refuse to be reused.
+type managedConn struct {
+	net.Conn
+	client    *Client
+	host      string
+	createdAt time.Time
+
+	mu        sync.Mutex
+	requests  int
+	rejectErr error
+}
+
+func (c *Client) managedDialContext(dial dialContextFunc) dialContextFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		mc := &managedConn{Conn: conn, client: c, host: host, createdAt: time.Now()}
+		c.conns.Store(mc, struct{}{})
+		return mc, nil
+	}
+}
+
+func (mc *managedConn) Close() error {
+	mc.client.conns.Delete(mc)
+	return mc.Conn.Close()
+}
+
+func (mc *managedConn) Write(p []byte) (int, error) {
+	mc.mu.Lock()
+	err := mc.rejectErr
+	mc.mu.Unlock()
+	if err != nil {
+		mc.Close()
+		return 0, err
+	}
+	return mc.Conn.Write(p)
+}
+
+// reject makes the next write fail with err.
+func (mc *managedConn) reject(err error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.rejectErr == nil {
+		mc.rejectErr = err
+	}
+}
+
+// gotConn is called when the transport picked mc for a request.
+// Connections past their lifetime or request count are rotated.
+func (mc *managedConn) gotConn(reused bool) {
+	mc.mu.Lock()
+	mc.requests++
+	requests := mc.requests
+	mc.mu.Unlock()
+	if !reused {
+		return
+	}
+
+	c := mc.client
+	switch {
+	case c.MaxConnAge > 0 && time.Since(mc.createdAt) > c.MaxConnAge,
+		c.MaxConnRequests > 0 && requests > c.MaxConnRequests,
+		c.ValidateIdleConns && !isConnAlive(mc.Conn):
+		mc.reject(ErrStaleConn)
+	}
+}
+
+// isConnAlive peeks at the socket without blocking: a pooled connection
+// is expected to have nothing to read, while EOF or an error means the
+// server closed or reset it.
+func isConnAlive(conn net.Conn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return true
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return true
+	}
+	alive := true
+	// Control does not wait for the read lock held by the transport.
+	raw.Control(func(fd uintptr) {
+		var buf [1]byte
+		n, _, err := unix.Recvfrom(int(fd), buf[:], unix.MSG_PEEK|unix.MSG_DONTWAIT)
+		switch {
+		case err == unix.EAGAIN || err == unix.EWOULDBLOCK:
+		case err != nil, n == 0:
+			alive = false
+		}
+	})
+	return alive
+}
+
+// managedConnTrace lets managed connections check themselves before reuse.
+var managedConnTrace = &httptrace.ClientTrace{
+	GotConn: func(info httptrace.GotConnInfo) {
+		conn := info.Conn
+		if tc, ok := conn.(*tls.Conn); ok {
+			conn = tc.NetConn()
+		}
+		if mc, ok := conn.(*managedConn); ok {
+			mc.gotConn(info.Reused)
+		}
+	},
+}
@@ -0,0 +1,384 @@
+package ubernet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const defaultContractMaxBodySize = 1 << 20
+
+// ResponseShape is the contract of a response: its status, its media type
+// and, for JSON bodies, the JSON types of its values by path, e.g.
+// "$.items[].id": "number". The types are "object", "array", "string",
+// "number", "boolean" and "null", values of several types, such as the
+// elements of mixed arrays, having them all separated by "|".
+type ResponseShape struct {
+	StatusCode  int               `json:"status"`
+	ContentType string            `json:"content_type,omitempty"`
+	JSON        map[string]string `json:"json,omitempty"`
+}
+
+// NewResponseShape returns the shape of a response of status code and
+// header with body, which is not parsed unless it is JSON.
+func NewResponseShape(code int, header http.Header, body []byte) *ResponseShape {
+	shape := &ResponseShape{StatusCode: code}
+	if ct := header.Get("Content-Type"); ct != "" {
+		shape.ContentType = ct
+		if mt, _, err := mime.ParseMediaType(ct); err == nil {
+			shape.ContentType = mt
+		}
+	}
+	if isJSONMediaType(shape.ContentType) && len(bytes.TrimSpace(body)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var v interface{}
+		if dec.Decode(&v) == nil {
+			types := make(map[string]map[string]bool)
+			walkJSONShape(v, "$", types)
+			shape.JSON = make(map[string]string, len(types))
+			for path, set := range types {
+				shape.JSON[path] = joinTypes(set)
+			}
+		}
+	}
+	return shape
+}
+
+func isJSONMediaType(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+func walkJSONShape(v interface{}, path string, types map[string]map[string]bool) {
+	var t string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		t = "object"
+		for k, child := range v {
+			walkJSONShape(child, path+"."+k, types)
+		}
+	case []interface{}:
+		t = "array"
+		for _, child := range v {
+			walkJSONShape(child, path+"[]", types)
+		}
+	case string:
+		t = "string"
+	case json.Number:
+		t = "number"
+	case bool:
+		t = "boolean"
+	default:
+		t = "null"
+	}
+	if types[path] == nil {
+		types[path] = make(map[string]bool)
+	}
+	types[path][t] = true
+}
+
+func joinTypes(set map[string]bool) string {
+	list := make([]string, 0, len(set))
+	for t := range set {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return strings.Join(list, "|")
+}
+
+// DriftKind is the kind of a ContractDrift.
+type DriftKind string
+
+// Kinds of ContractDrift.
+const (
+	DriftStatus      DriftKind = "status"
+	DriftContentType DriftKind = "content-type"
+	// DriftRemoved is a JSON value recorded, and missing now.
+	DriftRemoved DriftKind = "removed"
+	// DriftType is a JSON value of a type not recorded.
+	DriftType DriftKind = "type"
+	// DriftAdded is a JSON value not recorded. It does not break the
+	// contract.
+	DriftAdded DriftKind = "added"
+)
+
+// ContractDrift is a difference between a recorded response and the
+// response to the same request now.
+type ContractDrift struct {
+	Kind DriftKind
+	// Path is the path of the JSON value, empty for the other kinds.
+	Path     string
+	Recorded string
+	Got      string
+}
+
+// Breaking reports whether d breaks the contract, that is any drift but
+// DriftAdded.
+func (d ContractDrift) Breaking() bool {
+	return d.Kind != DriftAdded
+}
+
+func (d ContractDrift) String() string {
+	switch d.Kind {
+	case DriftRemoved:
+		return fmt.Sprintf("%s: removed, was %s", d.Path, d.Recorded)
+	case DriftAdded:
+		return fmt.Sprintf("%s: added, %s", d.Path, d.Got)
+	case DriftType:
+		return fmt.Sprintf("%s: type %s, was %s", d.Path, d.Got, d.Recorded)
+	}
+	return fmt.Sprintf("%s %s, was %s", d.Kind, d.Got, d.Recorded)
+}
+
+// Diff returns how got drifted from the recorded shape s. Values which were
+// null may be missing, null values are compatible with any type, and the
+// elements of arrays empty on either side are not compared. Only the
+// outermost of nested values removed or added is reported.
+func (s *ResponseShape) Diff(got *ResponseShape) []ContractDrift {
+	var drift []ContractDrift
+	if s.StatusCode != got.StatusCode {
+		drift = append(drift, ContractDrift{Kind: DriftStatus, Recorded: fmt.Sprint(s.StatusCode), Got: fmt.Sprint(got.StatusCode)})
+	}
+	if s.ContentType != got.ContentType {
+		drift = append(drift, ContractDrift{Kind: DriftContentType, Recorded: s.ContentType, Got: got.ContentType})
+	}
+	if s.JSON == nil || got.JSON == nil {
+		return drift
+	}
+
+	for _, path := range sortedKeys(s.JSON) {
+		recorded := s.JSON[path]
+		types, ok := got.JSON[path]
+		switch {
+		case !ok:
+			if recorded == "null" || strings.HasSuffix(path, "[]") {
+				continue
+			}
+			if _, ok := got.JSON[parentPath(path)]; !ok {
+				continue
+			}
+			drift = append(drift, ContractDrift{Kind: DriftRemoved, Path: path, Recorded: recorded})
+		case !compatibleTypes(recorded, types):
+			drift = append(drift, ContractDrift{Kind: DriftType, Path: path, Recorded: recorded, Got: types})
+		}
+	}
+	for _, path := range sortedKeys(got.JSON) {
+		if _, ok := s.JSON[path]; ok || strings.HasSuffix(path, "[]") {
+			continue
+		}
+		if _, ok := s.JSON[parentPath(path)]; !ok {
+			continue
+		}
+		drift = append(drift, ContractDrift{Kind: DriftAdded, Path: path, Got: got.JSON[path]})
+	}
+	return drift
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parentPath returns the path of the object or array holding path.
+func parentPath(path string) string {
+	if strings.HasSuffix(path, "[]") {
+		return strings.TrimSuffix(path, "[]")
+	}
+	if i := strings.LastIndexByte(path, '.'); i > 0 {
+		return path[:i]
+	}
+	return "$"
+}
+
+func compatibleTypes(recorded, got string) bool {
+	if recorded == "null" {
+		return true
+	}
+	known := strings.Split(recorded, "|")
+	for _, t := range strings.Split(got, "|") {
+		if t == "null" {
+			continue
+		}
+		found := false
+		for _, k := range known {
+			found = found || k == t
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ContractOptions configures ContractMiddleware.
+type ContractOptions struct {
+	// Writer receives the requests with the shape of their responses.
+	Writer *ReplayWriter
+	// MaxBodySize caps the bytes of the bodies parsed, 1MiB by default.
+	// The shape of larger bodies has no JSON part.
+	MaxBodySize int64
+	// OnError is called when a request can not be recorded, e.g. to log it.
+	OnError func(req *http.Request, err error)
+}
+
+// ContractMiddleware records the requests of a Client along with the shape
+// of their responses, as ReplayRecords with a Response, to be verified
+// later by a ContractVerifier. Only the attempts getting a response below
+// 500 are recorded, requests with streamed bodies or responses are not.
+// Like for Client.ReplayLog, the headers redacted from logs are dropped
+// unless the Writer keeps credentials.
+func ContractMiddleware(opts ContractOptions) Middleware {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultContractMaxBodySize
+	}
+	redact := &Client{}
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*http.Response, error) {
+			resp, err := next(req)
+			if err != nil || resp.StatusCode >= 500 || req.streamed || req.streamingResponse {
+				return resp, err
+			}
+			rec, recErr := NewReplayRecord(req, nil)
+			if recErr == nil {
+				var head bytes.Buffer
+				n, readErr := io.CopyN(&head, resp.Body, opts.MaxBodySize+1)
+				// The head is read again by the caller.
+				resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(head.Bytes()), resp.Body), Closer: resp.Body}
+				switch {
+				case readErr != nil && !errors.Is(readErr, io.EOF):
+					recErr = readErr
+				case n > opts.MaxBodySize:
+					rec.Response = NewResponseShape(resp.StatusCode, resp.Header, nil)
+				default:
+					rec.Response = NewResponseShape(resp.StatusCode, resp.Header, head.Bytes())
+				}
+			}
+			if recErr == nil {
+				if !opts.Writer.KeepCredentials {
+					for name := range rec.Header {
+						if redact.shouldRedact(name) {
+							delete(rec.Header, name)
+						}
+					}
+				}
+				recErr = opts.Writer.Write(rec)
+			}
+			if recErr != nil && opts.OnError != nil {
+				opts.OnError(req.Request, recErr)
+			}
+			return resp, nil
+		}
+	}
+}
+
+// ContractVerifier sends the requests recorded by ContractMiddleware again
+// through a Client, comparing the shapes of their responses with the
+// recorded ones to report contract drift.
+type ContractVerifier struct {
+	Client *Client
+	// MaxBodySize caps the bytes of the bodies parsed, 1MiB by default.
+	MaxBodySize int64
+	// OnResult, if set, is called with the outcome of every record.
+	OnResult func(rec *ReplayRecord, drift []ContractDrift, err error)
+}
+
+// ContractReport sums up a verification.
+type ContractReport struct {
+	Verified int
+	// Drifted counts the requests whose responses broke their contract,
+	// Failed those which got no response.
+	Drifted int
+	Failed  int
+	Drift   []RecordDrift
+}
+
+// RecordDrift is the drift of the response to a recorded request.
+type RecordDrift struct {
+	Method string
+	URL    string
+	Drift  []ContractDrift
+}
+
+// Verify verifies the records read from r in order, until the end of the
+// file or ctx is done, skipping the records without Response. Drift and
+// failed requests do not stop the verification.
+func (v *ContractVerifier) Verify(ctx context.Context, r io.Reader) (ContractReport, error) {
+	var report ContractReport
+	client := v.Client
+	if client == nil {
+		client = defaultClient
+	}
+	limit := v.MaxBodySize
+	if limit <= 0 {
+		limit = defaultContractMaxBodySize
+	}
+	records := NewReplayReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		rec, err := records.Next()
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		if rec.Response == nil {
+			continue
+		}
+
+		report.Verified++
+		drift, err := v.verify(ctx, client, rec, limit)
+		if v.OnResult != nil {
+			v.OnResult(rec, drift, err)
+		}
+		if err != nil {
+			report.Failed++
+			continue
+		}
+		if len(drift) > 0 {
+			report.Drift = append(report.Drift, RecordDrift{Method: rec.Method, URL: rec.URL, Drift: drift})
+		}
+		for _, d := range drift {
+			if d.Breaking() {
+				report.Drifted++
+				break
+			}
+		}
+	}
+}
+
+func (v *ContractVerifier) verify(ctx context.Context, client *Client, rec *ReplayRecord, limit int64) ([]ContractDrift, error) {
+	req, err := rec.Request(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer client.drainBody(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		// Too large to be parsed, only the status and media type are
+		// compared.
+		body = nil
+	}
+	shape := NewResponseShape(resp.StatusCode, resp.Header, body)
+	return rec.Response.Diff(shape), nil
+}
@@ -0,0 +1,100 @@
+package ubernet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// CredentialsProvider provides the credentials of the requests of a Client.
+type CredentialsProvider interface {
+	// Token returns the value of the Authorization header, e.g. "Bearer "
+	// followed by a token, or an empty string to send none. It is called
+	// before every attempt, so that rotated credentials are picked up by
+	// retries, and should cache what is costly to get.
+	Token(ctx context.Context) (string, error)
+}
+
+// CredentialsFunc is a function implementing CredentialsProvider.
+type CredentialsFunc func(ctx context.Context) (string, error)
+
+// Token implements CredentialsProvider.
+func (f CredentialsFunc) Token(ctx context.Context) (string, error) { return f(ctx) }
+
+// NoCredentials sends no credentials, e.g. to opt a request out of the
+// credentials of its Client with SetCredentials.
+var NoCredentials CredentialsProvider = CredentialsFunc(func(context.Context) (string, error) {
+	return "", nil
+})
+
+// StaticCredentials sends the same Authorization header value with every
+// request.
+type StaticCredentials string
+
+// Token implements CredentialsProvider.
+func (s StaticCredentials) Token(context.Context) (string, error) { return string(s), nil }
+
+// EnvCredentials sends the value of the environment variable name, read
+// again for every attempt.
+func EnvCredentials(name string) CredentialsProvider {
+	return CredentialsFunc(func(context.Context) (string, error) {
+		return os.Getenv(name), nil
+	})
+}
+
+// SetCredentials overrides Client.Credentials for r.
+func (r *Request) SetCredentials(p CredentialsProvider) *Request {
+	r.credentials = p
+	return r
+}
+
+// applyCredentials sets the Authorization header of req from its
+// credentials, or those of the Client.
+func (c *Client) applyCredentials(req *Request) error {
+	p := req.credentials
+	if p == nil {
+		p = c.Credentials
+	}
+	if p == nil {
+		return nil
+	}
+	token, err := p.Token(req.Context())
+	if err != nil {
+		return fmt.Errorf("getting credentials: %w", err)
+	}
+	if token == "" {
+		req.Header.Del("Authorization")
+		return nil
+	}
+	req.Header.Set("Authorization", token)
+	return nil
+}
+
+// legacyCredentialsEnv is the environment variable Post, Put and Patch used
+// to send as Authorization header.
+const legacyCredentialsEnv = "AUTHORIZATION_KEY"
+
+var legacyCredentialsWarning sync.Once
+
+// applyLegacyCredentials sets the Authorization header of req from
+// AUTHORIZATION_KEY when neither req nor c has credentials, as Post, Put
+// and Patch used to, warning once that it is deprecated.
+//
+// Deprecated: kept for one release, set Client.Credentials to
+// EnvCredentials("AUTHORIZATION_KEY") instead.
+func (c *Client) applyLegacyCredentials(req *Request) {
+	if req.credentials != nil || c.Credentials != nil {
+		return
+	}
+	token := os.Getenv(legacyCredentialsEnv)
+	if token == "" {
+		return
+	}
+	req.Header.Set("Authorization", token)
+	legacyCredentialsWarning.Do(func() {
+		if c.Logger != nil {
+			c.Logger.Printf(`WARNING sending AUTHORIZATION_KEY is deprecated and will be removed in the next release, set Client.Credentials to EnvCredentials("AUTHORIZATION_KEY")`)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package ubernet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestLegacyAuthorizationKey(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	old, had := os.LookupEnv("AUTHORIZATION_KEY")
+	os.Setenv("AUTHORIZATION_KEY", "Bearer legacy")
+	defer func() {
+		if had {
+			os.Setenv("AUTHORIZATION_KEY", old)
+		} else {
+			os.Unsetenv("AUTHORIZATION_KEY")
+		}
+	}()
+
+	c := NewClient()
+	c.Logger = nil
+	post := func() {
+		resp, err := c.Post(srv.URL, "text/plain", []byte("x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	post()
+	if got != "Bearer legacy" {
+		t.Fatalf("Authorization = %q, want the AUTHORIZATION_KEY fallback", got)
+	}
+	c.Credentials = StaticCredentials("Bearer new")
+	post()
+	if got != "Bearer new" {
+		t.Fatalf("Authorization = %q, want the Credentials of the Client", got)
+	}
+}
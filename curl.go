@@ -0,0 +1,75 @@
+package ubernet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxCurlInlineBody is the size up to which text bodies are inlined in
+// curl commands.
+const maxCurlInlineBody = 16 << 10
+
+// CurlBodyFile is the file referenced by curl commands for the bodies too
+// large or binary to be inlined, to be saved from Request.BodyBytes.
+const CurlBodyFile = "request.body"
+
+// AsCurl renders a curl command equivalent to r, with the sensitive
+// headers and query parameters redacted as in the logs of a Client with
+// default settings.
+func (r *Request) AsCurl() (string, error) {
+	return (&Client{}).AsCurl(r)
+}
+
+// AsCurl renders a curl command equivalent to r, with the sensitive
+// headers and query parameters redacted according to the settings of c.
+// Text bodies up to 16KiB are inlined, the others are read from
+// CurlBodyFile.
+func (c *Client) AsCurl(r *Request) (string, error) {
+	var b strings.Builder
+	b.WriteString("curl")
+
+	var body []byte
+	if r.body != nil && !r.streamed {
+		var err error
+		if body, err = r.BodyBytes(); err != nil {
+			return "", err
+		}
+	}
+	if r.Method != "GET" || len(body) > 0 {
+		fmt.Fprintf(&b, " -X %s", shellQuote(r.Method))
+	}
+
+	header := c.redactHeader(r.Header)
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if r.Host != "" && r.Host != r.URL.Host {
+		fmt.Fprintf(&b, " -H %s", shellQuote("Host: "+r.Host))
+	}
+	for _, name := range names {
+		for _, v := range header[name] {
+			fmt.Fprintf(&b, " -H %s", shellQuote(name+": "+v))
+		}
+	}
+
+	switch {
+	case r.streamed:
+		b.WriteString(" --data-binary @- # streamed body, not replayable")
+	case len(body) == 0:
+	case len(body) <= maxCurlInlineBody && utf8.Valid(body):
+		fmt.Fprintf(&b, " --data-binary %s", shellQuote(string(body)))
+	default:
+		fmt.Fprintf(&b, " --data-binary @%s", CurlBodyFile)
+	}
+	fmt.Fprintf(&b, " %s", shellQuote(c.redactURL(r.URL)))
+	return b.String(), nil
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,169 @@
+package ubernet
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeadlineFormat is the encoding of a deadline header.
+type DeadlineFormat int
+
+// Formats of a deadline header.
+const (
+	// DeadlineRemaining is the time remaining, in milliseconds.
+	DeadlineRemaining DeadlineFormat = iota
+	// DeadlineGRPC is the time remaining in the grpc-timeout format, e.g.
+	// "1500m" or "30S".
+	DeadlineGRPC
+	// DeadlineUnixMillis is the deadline itself, in milliseconds since the
+	// Unix epoch. Unlike the other formats it depends on synchronized clocks.
+	DeadlineUnixMillis
+)
+
+// DeadlineOptions configures DeadlineMiddleware and the parsing of the
+// deadline headers.
+type DeadlineOptions struct {
+	// Header is the name of the header, "Grpc-Timeout" for DeadlineGRPC,
+	// "X-Request-Deadline" otherwise.
+	Header string
+	Format DeadlineFormat
+	// Margin is subtracted from the time remaining when sending, leaving
+	// room for the response to travel back.
+	Margin time.Duration
+}
+
+func (opts DeadlineOptions) header() string {
+	switch {
+	case opts.Header != "":
+		return opts.Header
+	case opts.Format == DeadlineGRPC:
+		return "Grpc-Timeout"
+	}
+	return "X-Request-Deadline"
+}
+
+// DeadlineMiddleware sends the deadline of the context of every attempt in
+// a header, so that downstream services can honor the budget of the
+// caller. Requests without deadline are sent without the header.
+func DeadlineMiddleware(opts DeadlineOptions) Middleware {
+	header := opts.header()
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*http.Response, error) {
+			deadline, ok := req.Context().Deadline()
+			if !ok {
+				req.Header.Del(header)
+				return next(req)
+			}
+			if err := req.Context().Err(); err != nil {
+				return nil, err
+			}
+			deadline = deadline.Add(-opts.Margin)
+			req.Header.Set(header, opts.format(deadline, time.Now()))
+			return next(req)
+		}
+	}
+}
+
+func (opts DeadlineOptions) format(deadline, now time.Time) string {
+	remaining := deadline.Sub(now)
+	if remaining < time.Millisecond {
+		remaining = time.Millisecond
+	}
+	switch opts.Format {
+	case DeadlineGRPC:
+		return formatGRPCTimeout(remaining)
+	case DeadlineUnixMillis:
+		return strconv.FormatInt(deadline.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return strconv.FormatInt(int64(remaining/time.Millisecond), 10)
+}
+
+// grpcUnits are the units of grpc-timeout, from the finest.
+var grpcUnits = [...]struct {
+	unit byte
+	d    time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// formatGRPCTimeout encodes d in the finest unit fitting the 8 digits
+// allowed by grpc-timeout, rounding up.
+func formatGRPCTimeout(d time.Duration) string {
+	const maxValue = 99999999
+	for _, u := range grpcUnits {
+		if v := (d + u.d - 1) / u.d; v <= maxValue {
+			return strconv.FormatInt(int64(v), 10) + string(u.unit)
+		}
+	}
+	return strconv.Itoa(maxValue) + "H"
+}
+
+func parseGRPCTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+	for _, u := range grpcUnits {
+		if u.unit == s[len(s)-1] {
+			return time.Duration(v) * u.d, true
+		}
+	}
+	return 0, false
+}
+
+// Deadline returns the deadline encoded in h, relative to now for the
+// formats sending the time remaining, ok being false if h has none.
+func (opts DeadlineOptions) Deadline(h http.Header, now time.Time) (deadline time.Time, ok bool) {
+	value := h.Get(opts.header())
+	if value == "" {
+		return time.Time{}, false
+	}
+	switch opts.Format {
+	case DeadlineGRPC:
+		d, ok := parseGRPCTimeout(value)
+		if !ok {
+			return time.Time{}, false
+		}
+		return now.Add(d), true
+	case DeadlineUnixMillis:
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, ms*int64(time.Millisecond)), true
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return time.Time{}, false
+	}
+	return now.Add(time.Duration(ms) * time.Millisecond), true
+}
+
+// FromRequest is like the FromRequest function, for servers calling other
+// services on behalf of r: the context of the Request is bounded by the
+// deadline sent in the headers of r, if any, so that the budget of the
+// caller carries over. cancel must be called once the Request is done.
+func (opts DeadlineOptions) FromRequest(r *http.Request) (req *Request, cancel context.CancelFunc, err error) {
+	cancel = func() {}
+	if deadline, ok := opts.Deadline(r.Header, time.Now()); ok {
+		var ctx context.Context
+		ctx, cancel = context.WithDeadline(r.Context(), deadline)
+		r = r.WithContext(ctx)
+	}
+	req, err = FromRequest(r)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return req, cancel, nil
+}
@@ -0,0 +1,263 @@
+package ubernet
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// hostCounters are the counters of a destination host, or of a label.
+type hostCounters struct {
+	attempts int64
+	retries  int64
+	failures int64
+	giveUps  int64
+}
+
+// clientCounters are the counters of a Client, by host and by label.
+// Maps are used rather than sync.Map, whose interface keys would make
+// every lookup allocate.
+type clientCounters struct {
+	mu     sync.RWMutex
+	hosts  map[string]*hostCounters
+	labels map[string]*hostCounters
+}
+
+func (cc *clientCounters) get(m *map[string]*hostCounters, key string) *hostCounters {
+	cc.mu.RLock()
+	h, ok := (*m)[key]
+	cc.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if h, ok := (*m)[key]; ok {
+		return h
+	}
+	if *m == nil {
+		*m = make(map[string]*hostCounters)
+	}
+	h = &hostCounters{}
+	(*m)[key] = h
+	return h
+}
+
+func (cc *clientCounters) host(host string) *hostCounters {
+	return cc.get(&cc.hosts, host)
+}
+
+// label returns the counters of the label of req, nil if it has none.
+func (cc *clientCounters) label(req *Request) *hostCounters {
+	if req.label == "" {
+		return nil
+	}
+	return cc.get(&cc.labels, req.label)
+}
+
+func (c *Client) countAttempt(req *Request, resp *http.Response, err error) {
+	failed := err != nil || resp == nil || resp.StatusCode >= 500
+	for _, h := range [...]*hostCounters{c.counters.host(req.URL.Host), c.counters.label(req)} {
+		if h == nil {
+			continue
+		}
+		atomic.AddInt64(&h.attempts, 1)
+		if failed {
+			atomic.AddInt64(&h.failures, 1)
+		}
+	}
+}
+
+func (c *Client) countRetry(req *Request) {
+	atomic.AddInt64(&c.counters.host(req.URL.Host).retries, 1)
+	if h := c.counters.label(req); h != nil {
+		atomic.AddInt64(&h.retries, 1)
+	}
+}
+
+func (c *Client) countGiveUp(req *Request) {
+	atomic.AddInt64(&c.counters.host(req.URL.Host).giveUps, 1)
+	if h := c.counters.label(req); h != nil {
+		atomic.AddInt64(&h.giveUps, 1)
+	}
+}
+
+// ConfigSnapshot is the configuration part of ClientStats.
+type ConfigSnapshot struct {
+	RetryWaitMin       string `json:"retry_wait_min"`
+	RetryWaitMax       string `json:"retry_wait_max"`
+	RetryMax           int    `json:"retry_max"`
+	Timeout            string `json:"timeout"`
+	MaxConnAge         string `json:"max_conn_age,omitempty"`
+	MaxConnRequests    int    `json:"max_conn_requests,omitempty"`
+	ValidateIdleConns  bool   `json:"validate_idle_conns,omitempty"`
+	ReresolveOnFailure bool   `json:"reresolve_on_failure,omitempty"`
+	Policies           bool   `json:"policies,omitempty"`
+	Degradation        bool   `json:"degradation,omitempty"`
+	Breaker            bool   `json:"breaker,omitempty"`
+	DryRun             bool   `json:"dry_run,omitempty"`
+}
+
+// HostStats are the statistics of a destination host.
+type HostStats struct {
+	Attempts int64 `json:"attempts"`
+	Retries  int64 `json:"retries"`
+	Failures int64 `json:"failures"`
+	GiveUps  int64 `json:"give_ups"`
+	// OpenConns is only known when the Client manages its connections,
+	// see ValidateIdleConns, MaxConnAge, MaxConnRequests, WatchDNSHosts
+	// and ReresolveOnFailure.
+	OpenConns int  `json:"open_conns"`
+	Degraded  bool `json:"degraded,omitempty"`
+	// Circuit is only known when the Client has a Breaker.
+	Circuit string `json:"circuit,omitempty"`
+}
+
+// LabelStats are the statistics of a request label.
+type LabelStats struct {
+	Attempts int64 `json:"attempts"`
+	Retries  int64 `json:"retries"`
+	Failures int64 `json:"failures"`
+	GiveUps  int64 `json:"give_ups"`
+	// InFlight is only known when the label has a concurrency limit.
+	InFlight int `json:"in_flight,omitempty"`
+}
+
+// ClientThrottleStats are the statistics of the shared throttles of a Client.
+type ClientThrottleStats struct {
+	Read  *ThrottleStats `json:"read,omitempty"`
+	Write *ThrottleStats `json:"write,omitempty"`
+}
+
+// ClientStats is a snapshot of the internals of a Client.
+type ClientStats struct {
+	Config ConfigSnapshot         `json:"config"`
+	Hosts  map[string]*HostStats  `json:"hosts"`
+	Labels map[string]*LabelStats `json:"labels,omitempty"`
+	Audit  *AuditSnapshot         `json:"audit,omitempty"`
+	// TLSSessions is only known when the Client has a SessionCache.
+	TLSSessions *TLSSessionStats `json:"tls_sessions,omitempty"`
+	// Throttle is only known when the Client has shared throttles.
+	Throttle *ClientThrottleStats `json:"throttle,omitempty"`
+	// Traffic is only known when TrafficAccounting is enabled.
+	Traffic *TrafficReport `json:"traffic,omitempty"`
+	// Buffers is shared by all the Clients.
+	Buffers BufferStats `json:"buffers"`
+}
+
+// Stats returns a snapshot of the internals of c.
+func (c *Client) Stats() ClientStats {
+	stats := ClientStats{
+		Config: ConfigSnapshot{
+			RetryWaitMin:       c.RetryWaitMin.String(),
+			RetryWaitMax:       c.RetryWaitMax.String(),
+			RetryMax:           c.RetryMax,
+			Timeout:            c.HTTPClient.Timeout.String(),
+			ValidateIdleConns:  c.ValidateIdleConns,
+			MaxConnRequests:    c.MaxConnRequests,
+			ReresolveOnFailure: c.ReresolveOnFailure,
+			Policies:           c.Policies != nil,
+			Degradation:        c.Degradation != nil,
+			Breaker:            c.Breaker != nil,
+			DryRun:             c.DryRun != nil,
+		},
+		Hosts:   make(map[string]*HostStats),
+		Buffers: BufferPoolStats(),
+	}
+	if c.MaxConnAge > 0 {
+		stats.Config.MaxConnAge = c.MaxConnAge.String()
+	}
+
+	host := func(name string) *HostStats {
+		h, ok := stats.Hosts[name]
+		if !ok {
+			h = &HostStats{}
+			stats.Hosts[name] = h
+		}
+		return h
+	}
+	c.counters.mu.RLock()
+	for name, hc := range c.counters.hosts {
+		h := host(name)
+		h.Attempts = atomic.LoadInt64(&hc.attempts)
+		h.Retries = atomic.LoadInt64(&hc.retries)
+		h.Failures = atomic.LoadInt64(&hc.failures)
+		h.GiveUps = atomic.LoadInt64(&hc.giveUps)
+		if c.Degradation != nil {
+			if d, ok := c.Degradation.degraded.Load(name); ok {
+				h.Degraded = d.(bool)
+			}
+		}
+		if c.Breaker != nil {
+			h.Circuit = c.Breaker.State(name).String()
+		}
+	}
+	for name, lc := range c.counters.labels {
+		if stats.Labels == nil {
+			stats.Labels = make(map[string]*LabelStats)
+		}
+		stats.Labels[name] = &LabelStats{
+			Attempts: atomic.LoadInt64(&lc.attempts),
+			Retries:  atomic.LoadInt64(&lc.retries),
+			Failures: atomic.LoadInt64(&lc.failures),
+			GiveUps:  atomic.LoadInt64(&lc.giveUps),
+		}
+	}
+	c.counters.mu.RUnlock()
+	c.limiters.mu.Lock()
+	for name, l := range c.limiters.limiters {
+		if ls, ok := stats.Labels[name]; ok && l.slots != nil {
+			ls.InFlight = len(l.slots)
+		}
+	}
+	c.limiters.mu.Unlock()
+	c.conns.Range(func(key, _ interface{}) bool {
+		host(key.(*managedConn).host).OpenConns++
+		return true
+	})
+	if c.SessionCache != nil {
+		sessions := c.SessionCache.Stats()
+		stats.TLSSessions = &sessions
+	}
+	if c.Throttle != nil && (c.Throttle.Read != nil || c.Throttle.Write != nil) {
+		stats.Throttle = &ClientThrottleStats{}
+		if c.Throttle.Read != nil {
+			read := c.Throttle.Read.Stats()
+			stats.Throttle.Read = &read
+		}
+		if c.Throttle.Write != nil {
+			write := c.Throttle.Write.Stats()
+			stats.Throttle.Write = &write
+		}
+	}
+	if c.TrafficAccounting {
+		traffic := c.Traffic()
+		stats.Traffic = &traffic
+	}
+	if c.Audit != nil {
+		snapshot := c.Audit.Snapshot()
+		stats.Audit = &snapshot
+	}
+	return stats
+}
+
+// DebugHandler returns an http.Handler serving the Stats of c as JSON.
+func (c *Client) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(c.Stats())
+	})
+}
+
+// PublishExpvar exports the Stats of c as the expvar name.
+// Like expvar.Publish, it panics if name is already in use.
+func (c *Client) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return c.Stats()
+	}))
+}
@@ -0,0 +1,36 @@
+package ubernet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestStatsCircuit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.Logger = nil
+	c.RetryMax = 0
+	c.Breaker = &CircuitBreaker{Failures: 1}
+	req, err := NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := c.Do(req); err == nil {
+		resp.Body.Close()
+	}
+
+	u, _ := url.Parse(srv.URL)
+	h := c.Stats().Hosts[u.Host]
+	if h == nil {
+		t.Fatalf("no stats for %s", u.Host)
+	}
+	if h.Circuit != "open" {
+		t.Fatalf("Circuit = %q, want open", h.Circuit)
+	}
+}
@@ -0,0 +1,158 @@
+package ubernet
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DedupeCache remembers the successful responses of POST requests carrying
+// an Idempotency-Key header, so that an application level retry of the same
+// request gets the cached response instead of sending it again.
+type DedupeCache struct {
+	TTL        time.Duration
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// NewDedupeCache returns a DedupeCache keeping at most maxEntries responses for ttl.
+func NewDedupeCache(ttl time.Duration, maxEntries int) *DedupeCache {
+	return &DedupeCache{
+		TTL:        ttl,
+		MaxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+type dedupeEntry struct {
+	key        string
+	expiresAt  time.Time
+	status     string
+	statusCode int
+	proto      string
+	protoMajor int
+	protoMinor int
+	header     http.Header
+	body       []byte
+}
+
+func (d *DedupeCache) get(key string, req *http.Request) *http.Response {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	elem, ok := d.entries[key]
+	if !ok {
+		return nil
+	}
+	e := elem.Value.(*dedupeEntry)
+	if time.Now().After(e.expiresAt) {
+		d.remove(elem)
+		return nil
+	}
+	return &http.Response{
+		Status:        e.status,
+		StatusCode:    e.statusCode,
+		Proto:         e.proto,
+		ProtoMajor:    e.protoMajor,
+		ProtoMinor:    e.protoMinor,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+func (d *DedupeCache) put(key string, resp *http.Response, body []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.entries == nil {
+		d.entries = make(map[string]*list.Element)
+		d.order = list.New()
+	}
+	if elem, ok := d.entries[key]; ok {
+		d.remove(elem)
+	}
+	d.entries[key] = d.order.PushBack(&dedupeEntry{
+		key:        key,
+		expiresAt:  time.Now().Add(d.TTL),
+		status:     resp.Status,
+		statusCode: resp.StatusCode,
+		proto:      resp.Proto,
+		protoMajor: resp.ProtoMajor,
+		protoMinor: resp.ProtoMinor,
+		header:     resp.Header.Clone(),
+		body:       body,
+	})
+	d.evict()
+}
+
+// evict removes expired entries and the oldest ones above MaxEntries.
+func (d *DedupeCache) evict() {
+	now := time.Now()
+	for elem := d.order.Front(); elem != nil; {
+		next := elem.Next()
+		if e := elem.Value.(*dedupeEntry); now.After(e.expiresAt) || (d.MaxEntries > 0 && d.order.Len() > d.MaxEntries) {
+			d.remove(elem)
+		}
+		elem = next
+	}
+}
+
+func (d *DedupeCache) remove(elem *list.Element) {
+	delete(d.entries, elem.Value.(*dedupeEntry).key)
+	d.order.Remove(elem)
+}
+
+// dedupeKey fingerprints a POST request with an Idempotency-Key header.
+func dedupeKey(req *Request) (string, bool) {
+	idemKey := req.Header.Get("Idempotency-Key")
+	if req.Method != http.MethodPost || idemKey == "" || req.streamed {
+		return "", false
+	}
+	body, err := req.BodyBytes()
+	if err != nil {
+		return "", false
+	}
+	h := sha256.New()
+	for _, part := range []string{req.Method, req.URL.String(), idemKey} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// doDedupe serves req from the Dedupe cache, or performs it and caches a
+// successful response.
+func (c *Client) doDedupe(req *Request) (*http.Response, error) {
+	key, ok := dedupeKey(req)
+	if !ok {
+		return c.do(req)
+	}
+	if resp := c.Dedupe.get(key, req.Request); resp != nil {
+		return resp, nil
+	}
+
+	resp, err := c.do(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.Dedupe.put(key, resp, body)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
@@ -0,0 +1,184 @@
+package ubernet
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthBuckets = 10
+
+	defaultDegradationWindow      = time.Minute
+	defaultDegradationThreshold   = 0.5
+	defaultDegradationMinRequests = 10
+)
+
+// healthWindow counts the outcomes of requests over a sliding window.
+type healthWindow struct {
+	mu       sync.Mutex
+	width    time.Duration
+	buckets  [healthBuckets]struct{ total, failed int }
+	current  int
+	rotateAt time.Time
+}
+
+func newHealthWindow(window time.Duration) *healthWindow {
+	return &healthWindow{width: window / healthBuckets}
+}
+
+// rotate drops the buckets which slid out of the window. h.mu must be held.
+func (h *healthWindow) rotate(now time.Time) {
+	if h.rotateAt.IsZero() {
+		h.rotateAt = now.Add(h.width)
+		return
+	}
+	for i := 0; i < healthBuckets && !now.Before(h.rotateAt); i++ {
+		h.current = (h.current + 1) % healthBuckets
+		h.buckets[h.current] = struct{ total, failed int }{}
+		h.rotateAt = h.rotateAt.Add(h.width)
+	}
+	if !now.Before(h.rotateAt) {
+		h.rotateAt = now.Add(h.width)
+	}
+}
+
+func (h *healthWindow) record(failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rotate(time.Now())
+	h.buckets[h.current].total++
+	if failed {
+		h.buckets[h.current].failed++
+	}
+}
+
+// failureRate returns the failure rate and the number of requests of the window.
+func (h *healthWindow) failureRate() (float64, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rotate(time.Now())
+	var total, failed int
+	for _, b := range h.buckets {
+		total += b.total
+		failed += b.failed
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(failed) / float64(total), total
+}
+
+// Degradation makes the Client fail fast to hosts whose recent failure
+// rate exceeds Threshold, by reducing retries and tightening timeouts,
+// until their health recovers. It keeps the number of pending requests,
+// and thus goroutines, bounded during incidents.
+type Degradation struct {
+	// Window is the period over which the failure rate is computed, 1
+	// minute by default.
+	Window time.Duration
+	// Threshold is the failure rate, between 0 and 1, from which a host
+	// is degraded, 0.5 by default.
+	Threshold float64
+	// MinRequests is the number of requests of the window needed to
+	// degrade a host, 10 by default.
+	MinRequests int
+
+	// RetryMax and Timeout replace the Client settings for degraded hosts
+	// when they are lower.
+	RetryMax int
+	Timeout  time.Duration
+
+	hosts    sync.Map
+	degraded sync.Map
+}
+
+func (d *Degradation) window(host string) *healthWindow {
+	if w, ok := d.hosts.Load(host); ok {
+		return w.(*healthWindow)
+	}
+	width := d.Window
+	if width <= 0 {
+		width = defaultDegradationWindow
+	}
+	w, _ := d.hosts.LoadOrStore(host, newHealthWindow(width))
+	return w.(*healthWindow)
+}
+
+func (d *Degradation) record(host string, failed bool) {
+	d.window(host).record(failed)
+}
+
+// update computes whether host is degraded, and whether it changed since
+// the previous update.
+func (d *Degradation) update(host string) (degraded, changed bool) {
+	threshold, minRequests := d.Threshold, d.MinRequests
+	if threshold <= 0 {
+		threshold = defaultDegradationThreshold
+	}
+	if minRequests <= 0 {
+		minRequests = defaultDegradationMinRequests
+	}
+	rate, total := d.window(host).failureRate()
+	degraded = total > 0 && total >= minRequests && rate >= threshold
+	prev, _ := d.degraded.Swap(host, degraded)
+	return degraded, prev != nil && prev.(bool) != degraded
+}
+
+// isDegraded reports whether host was degraded by the last update.
+func (d *Degradation) isDegraded(host string) bool {
+	degraded, _ := d.degraded.Load(host)
+	return degraded != nil && degraded.(bool)
+}
+
+// updateDegradation updates whether the host of req is degraded, once per
+// attempt, logging the transitions.
+func (c *Client) updateDegradation(req *Request) {
+	if c.Degradation == nil || req.URL == nil {
+		return
+	}
+	degraded, changed := c.Degradation.update(req.URL.Host)
+	if changed && c.Logger != nil {
+		if degraded {
+			c.Logger.Printf("WARNING %s: failure rate above threshold, degrading", req.URL.Host)
+		} else {
+			c.Logger.Printf("INFO %s: recovered, restoring settings", req.URL.Host)
+		}
+	}
+}
+
+// degradeRetryMax returns retryMax reduced if the host of req is degraded.
+func (c *Client) degradeRetryMax(req *Request, retryMax int) int {
+	if c.Degradation == nil || req.URL == nil {
+		return retryMax
+	}
+	if c.Degradation.isDegraded(req.URL.Host) && c.Degradation.RetryMax < retryMax {
+		return c.Degradation.RetryMax
+	}
+	return retryMax
+}
+
+// degradeHTTPClient returns hc with a tighter timeout if the host of req is degraded.
+func (c *Client) degradeHTTPClient(req *Request, hc *http.Client) *http.Client {
+	if c.Degradation == nil || c.Degradation.Timeout <= 0 || req.URL == nil || req.streamingResponse {
+		return hc
+	}
+	if !c.Degradation.isDegraded(req.URL.Host) {
+		return hc
+	}
+	if hc.Timeout > 0 && hc.Timeout <= c.Degradation.Timeout {
+		return hc
+	}
+	degradedClient := *hc
+	degradedClient.Timeout = c.Degradation.Timeout
+	return &degradedClient
+}
+
+// recordOutcome feeds the failure rate of the host of req.
+func (c *Client) recordOutcome(req *Request, resp *http.Response, err error) {
+	if c.Degradation == nil || req.URL == nil {
+		return
+	}
+	failed := err != nil || resp == nil || resp.StatusCode >= 500
+	c.Degradation.record(req.URL.Host, failed)
+}
@@ -0,0 +1,54 @@
+package ubernet
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDegradationZeroValue(t *testing.T) {
+	d := &Degradation{}
+	if degraded, _ := d.update("idle.example"); degraded {
+		t.Fatal("host without requests degraded")
+	}
+	for i := 0; i < defaultDegradationMinRequests-1; i++ {
+		d.record("busy.example", true)
+	}
+	if degraded, _ := d.update("busy.example"); degraded {
+		t.Fatal("host degraded below MinRequests")
+	}
+	d.record("busy.example", true)
+	if degraded, _ := d.update("busy.example"); !degraded {
+		t.Fatal("host failing every request not degraded, the window lost its requests")
+	}
+}
+
+func TestDegradationLogsTransition(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	c := NewClient()
+	c.Logger = log.New(&logs, "", 0)
+	c.RetryMax = 3
+	c.RetryWaitMin = time.Millisecond
+	c.RetryWaitMax = time.Millisecond
+	c.Degradation = &Degradation{MinRequests: 2, Timeout: time.Second}
+	req, err := NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if n := strings.Count(logs.String(), "degrading"); n != 1 {
+		t.Fatalf("%d degradation logs, want 1:\n%s", n, logs.String())
+	}
+}
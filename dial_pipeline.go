@@ -0,0 +1,228 @@
+package ubernet
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultAttemptInterval = 250 * time.Millisecond
+
+// CandidateTiming describes the connection attempt to a candidate address
+// of DialPipelined.
+type CandidateTiming struct {
+	Addr string
+	// Resolved is the time from the start of the dial until the address
+	// was resolved.
+	Resolved time.Duration
+	// Started is the time from the start of the dial until the attempt started.
+	Started time.Duration
+	// Duration is the time the attempt took, zero if it was abandoned
+	// because another candidate won.
+	Duration time.Duration
+	Err      error
+}
+
+type resolvedIP struct {
+	ip       net.IP
+	resolved time.Duration
+}
+
+type candidateResult struct {
+	index int
+	conn  net.Conn
+	err   error
+}
+
+// DialPipelined connects to address ("host:port") over TCP, pipelining
+// DNS resolution and connection establishment: IPv4 and IPv6 addresses
+// are resolved concurrently, and a connection attempt to the next
+// candidate, alternating address families, starts every interval or as
+// soon as the previous attempts failed, without waiting for the whole
+// resolution. The first established connection wins, the others are
+// closed. interval defaults to 250ms.
+// The timing of every candidate is returned, even on error.
+func (d *Dialer) DialPipelined(ctx context.Context, address string, interval time.Duration) (net.Conn, []CandidateTiming, error) {
+	if interval <= 0 {
+		interval = defaultAttemptInterval
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	start := time.Now()
+
+	var ips <-chan resolvedIP
+	if addrs, ok := lookupHostAlias(d.HostAlias, address); ok {
+		ips = aliasedIPs(addrs)
+	} else {
+		ips = d.resolvePipelined(ctx, host, start)
+	}
+	results := make(chan candidateResult)
+	nd := d.netDialer()
+
+	var (
+		timings    []CandidateTiming
+		queues     [2][]resolvedIP
+		lastFamily = 1
+		inflight   int
+		timer      *time.Timer
+		timerC     <-chan time.Time
+		canStart   = true
+		firstErr   error
+	)
+	next := func() (resolvedIP, bool) {
+		for i := 1; i <= 2; i++ {
+			family := (lastFamily + i) % 2
+			if len(queues[family]) > 0 {
+				ip := queues[family][0]
+				queues[family] = queues[family][1:]
+				lastFamily = family
+				return ip, true
+			}
+		}
+		return resolvedIP{}, false
+	}
+
+	for {
+		if canStart || inflight == 0 {
+			if ip, ok := next(); ok {
+				addr := net.JoinHostPort(ip.ip.String(), port)
+				timings = append(timings, CandidateTiming{Addr: addr, Resolved: ip.resolved, Started: time.Since(start)})
+				inflight++
+				go func(index int, addr string) {
+					conn, err := nd.DialContext(ctx, "tcp", addr)
+					results <- candidateResult{index, conn, err}
+				}(len(timings)-1, addr)
+
+				canStart = false
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.NewTimer(interval)
+				timerC = timer.C
+			}
+		}
+		if ips == nil && inflight == 0 && len(queues[0])+len(queues[1]) == 0 {
+			if firstErr == nil {
+				firstErr = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+			}
+			return nil, timings, firstErr
+		}
+
+		select {
+		case ip, ok := <-ips:
+			if !ok {
+				ips = nil
+				continue
+			}
+			family := 0
+			if ip.ip.To4() == nil {
+				family = 1
+			}
+			queues[family] = append(queues[family], ip)
+		case <-timerC:
+			canStart = true
+		case res := <-results:
+			inflight--
+			t := &timings[res.index]
+			t.Duration = time.Since(start) - t.Started
+			t.Err = res.err
+			if res.err != nil {
+				if firstErr == nil {
+					firstErr = res.err
+				}
+				continue
+			}
+			cancel()
+			go closeLosers(results, inflight)
+			conn, err := d.established("tcp", res.conn)
+			return conn, timings, err
+		case <-ctx.Done():
+			go closeLosers(results, inflight)
+			return nil, timings, ctx.Err()
+		}
+	}
+}
+
+// resolvePipelined sends the addresses of host as soon as they are resolved.
+func (d *Dialer) resolvePipelined(ctx context.Context, host string, start time.Time) <-chan resolvedIP {
+	out := make(chan resolvedIP)
+	if ip := net.ParseIP(host); ip != nil {
+		go func() {
+			out <- resolvedIP{ip, 0}
+			close(out)
+		}()
+		return out
+	}
+
+	if d.Resolvers != nil {
+		go func() {
+			defer close(out)
+			ips, err := resolveWithTimeout(ctx, d.Resolvers, "tcp", host, d.ResolveTimeout)
+			if err != nil {
+				return
+			}
+			resolved := time.Since(start)
+			for _, ip := range ips {
+				select {
+				case out <- resolvedIP{ip, resolved}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out
+	}
+
+	var wg sync.WaitGroup
+	for _, network := range []string{"ip4", "ip6"} {
+		wg.Add(1)
+		go func(network string) {
+			defer wg.Done()
+			ips, err := d.resolver().LookupIP(ctx, network, host)
+			if err != nil {
+				// The other family may still resolve.
+				return
+			}
+			resolved := time.Since(start)
+			for _, ip := range ips {
+				select {
+				case out <- resolvedIP{ip, resolved}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(network)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// aliasedIPs sends the IP addresses of addrs, mapped by a host alias.
+func aliasedIPs(addrs []string) <-chan resolvedIP {
+	out := make(chan resolvedIP, len(addrs))
+	for _, addr := range addrs {
+		host, _, _ := net.SplitHostPort(addr)
+		if ip := net.ParseIP(host); ip != nil {
+			out <- resolvedIP{ip, 0}
+		}
+	}
+	close(out)
+	return out
+}
+
+func closeLosers(results <-chan candidateResult, n int) {
+	for i := 0; i < n; i++ {
+		if res := <-results; res.conn != nil {
+			res.conn.Close()
+		}
+	}
+}
@@ -22,6 +22,33 @@ type Dialer struct {
 	Resolver      *net.Resolver
 	Cancel        <-chan struct{}
 	Control       func(network, address string, c syscall.RawConn) error
+
+	// ProxyHeader, if set, is sent right after connecting.
+	ProxyHeader *ProxyHeader
+
+	// Interface binds the socket to a network interface (SO_BINDTODEVICE),
+	// and RoutingMark sets its fwmark (SO_MARK) to select a routing table
+	// with policy routing. Both let probes take an alternate path without
+	// touching the global routing table, and require CAP_NET_RAW and
+	// CAP_NET_ADMIN respectively. They are only supported on Linux.
+	Interface   string
+	RoutingMark int
+
+	// ResolveTimeout limits the resolution of host names, which then fails
+	// with ErrResolveTimeout rather than consuming the whole Timeout.
+	ResolveTimeout time.Duration
+
+	// Resolvers, if set, resolves host names in place of Resolver, failing
+	// over from one resolver to the next.
+	Resolvers *ResolverChain
+
+	// HostAlias maps host names, or "host:port", to the IP addresses to
+	// connect to in their place, bypassing DNS like curl --resolve.
+	HostAlias map[string][]string
+
+	// HTTPSRecords, if set, looks up the HTTPS DNS records of the hosts
+	// dialed by DialTLS, whose alternative endpoints are dialed first.
+	HTTPSRecords HTTPSLookup
 }
 
 func (d *Dialer) resolver() *net.Resolver {
@@ -31,17 +58,76 @@ func (d *Dialer) resolver() *net.Resolver {
 	return net.DefaultResolver
 }
 
+func (d *Dialer) hostResolver() HostResolver {
+	if d.Resolvers != nil {
+		return d.Resolvers
+	}
+	return d.resolver()
+}
+
+// control sets the routing options on the socket before connecting.
+func (d *Dialer) control(network, address string, c syscall.RawConn) error {
+	if d.Interface != "" || d.RoutingMark != 0 {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = bindSocket(fd, d.Interface, d.RoutingMark)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return sockErr
+		}
+	}
+	if d.Control != nil {
+		return d.Control(network, address, c)
+	}
+	return nil
+}
+
 // DialTCP ..
 func (d *Dialer) DialTCP(ctx context.Context, network, address string) (net.Conn, error) {
+	dial := d.netDialer().DialContext
+	if d.ResolveTimeout > 0 || d.Resolvers != nil {
+		// Timeout covers the resolution and the connection as a whole.
+		if d.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+			defer cancel()
+		}
+		dial = resolveTimeoutDialContext(dial, d.hostResolver(), d.ResolveTimeout, d.FallbackDelay)
+	}
+	if len(d.HostAlias) > 0 {
+		dial = hostAliasDialContext(dial, d.HostAlias)
+	}
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return d.established(network, conn)
+}
 
-	// addrs, err := d.resolver().resolveAddrList(ctx, "dial", network, address, d.LocalAddr)
-	// if err != nil {
-	// 	return nil, &OpError{Op: "dial", Net: network, Source: nil, Addr: nil, Err: err}
-	// }
+func (d *Dialer) netDialer() *net.Dialer {
+	nd := &net.Dialer{
+		Timeout:       d.Timeout,
+		Deadline:      d.Deadline,
+		LocalAddr:     d.LocalAddr,
+		FallbackDelay: d.FallbackDelay,
+		KeepAlive:     d.KeepAlive,
+		Resolver:      d.resolver(),
+		Cancel:        d.Cancel,
+		Control:       d.control,
+	}
+	return nd
+}
 
-	// _, err := createSocket(ctx, network, d.LocalAddr, syscall.SOCK_STREAM, 0)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	return nil, nil
+// established prepares a newly established connection for use.
+func (d *Dialer) established(network string, conn net.Conn) (net.Conn, error) {
+	if d.ProxyHeader != nil {
+		if err := d.ProxyHeader.Send(conn); err != nil {
+			conn.Close()
+			return nil, &net.OpError{Op: "dial", Net: network, Source: conn.LocalAddr(), Addr: conn.RemoteAddr(), Err: err}
+		}
+	}
+	return conn, nil
 }
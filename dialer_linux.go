@@ -0,0 +1,25 @@
+//go:build linux
+
+package ubernet
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindSocket binds the socket fd to the network interface iface, if set,
+// and sets its routing mark, if not zero.
+func bindSocket(fd uintptr, iface string, mark int) error {
+	if iface != "" {
+		if err := unix.BindToDevice(int(fd), iface); err != nil {
+			return os.NewSyscallError("setsockopt SO_BINDTODEVICE", err)
+		}
+	}
+	if mark != 0 {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, mark); err != nil {
+			return os.NewSyscallError("setsockopt SO_MARK", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package ubernet
+
+import "errors"
+
+// bindSocket fails, binding to an interface and routing marks are only
+// supported on Linux.
+func bindSocket(fd uintptr, iface string, mark int) error {
+	return errors.New("binding to an interface or setting a routing mark is only supported on linux")
+}
@@ -0,0 +1,76 @@
+package ubernet
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+const defaultWatchDNSInterval = 30 * time.Second
+
+// WatchDNS resolves WatchDNSHosts every WatchDNSInterval, and drops the
+// pooled connections to addresses which disappeared from DNS, so that
+// traffic follows DNS changes instead of riding old keep-alives.
+// Idle connections are closed right away, busy ones are not reused.
+// NOTE: this function blocks until ctx got canceled.
+func (c *Client) WatchDNS(ctx context.Context) error {
+	interval := c.WatchDNSInterval
+	if interval <= 0 {
+		interval = defaultWatchDNSInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.checkDNS(ctx)
+		}
+	}
+}
+
+func (c *Client) checkDNS(ctx context.Context) {
+	dropped := false
+	for _, host := range c.WatchDNSHosts {
+		ips, err := freshResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			// Keep the connections if the host can not be resolved for now.
+			if c.Logger != nil {
+				c.Logger.Printf("WARNING error resolving %s: %v", host, err)
+			}
+			continue
+		}
+		current := make(map[string]bool, len(ips))
+		for _, ip := range ips {
+			current[ip.IP.String()] = true
+		}
+
+		c.conns.Range(func(key, _ interface{}) bool {
+			mc := key.(*managedConn)
+			if mc.host != host {
+				return true
+			}
+			ip, _, err := net.SplitHostPort(mc.RemoteAddr().String())
+			if err == nil && !current[ip] {
+				mc.reject(ErrStaleConn)
+				dropped = true
+			}
+			return true
+		})
+	}
+	if dropped {
+		c.closeIdleConnections()
+	}
+}
+
+// closeIdleConnections closes the idle connections of every transport of the Client.
+func (c *Client) closeIdleConnections() {
+	c.HTTPClient.CloseIdleConnections()
+	c.httpClients.Range(func(_, hc interface{}) bool {
+		hc.(*http.Client).CloseIdleConnections()
+		return true
+	})
+}
@@ -0,0 +1,115 @@
+package ubernet
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DryRun, set as Client.DryRun, records the requests of a Client instead of
+// sending them, answering synthetic responses, to validate the traffic of
+// generated clients or migrations in CI. Requests go through the
+// middleware and authorization as usual, so that what is recorded is what
+// would have been sent. Sensitive headers and query parameters are redacted
+// like in logs.
+type DryRun struct {
+	// Respond, if set, returns the response to r, e.g. to exercise the
+	// handling of errors. The responses are empty 200 OK by default.
+	Respond func(r *http.Request) (*http.Response, error)
+	// Writer, if set, receives every request recorded as a line of JSON.
+	Writer io.Writer
+
+	mu       sync.Mutex
+	requests []DryRunRequest
+}
+
+// DryRunRequest is a request recorded by a DryRun.
+type DryRunRequest struct {
+	Time   time.Time   `json:"time"`
+	ID     string      `json:"id,omitempty"`
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	// BodySize and BodyDigest, the SHA-256 of the body formatted like
+	// Content-Digest, are empty for requests without body.
+	BodySize   int64  `json:"body_size,omitempty"`
+	BodyDigest string `json:"body_digest,omitempty"`
+}
+
+// Requests returns the requests recorded, in order.
+func (d *DryRun) Requests() []DryRunRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DryRunRequest(nil), d.requests...)
+}
+
+// Reset discards the requests recorded.
+func (d *DryRun) Reset() {
+	d.mu.Lock()
+	d.requests = nil
+	d.mu.Unlock()
+}
+
+func (d *DryRun) add(r DryRunRequest) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests = append(d.requests, r)
+	if d.Writer == nil {
+		return nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = d.Writer.Write(append(data, '\n'))
+	return err
+}
+
+// sendDryRun records req in place of sending it, consuming its body.
+func (c *Client) sendDryRun(req *Request) (*http.Response, error) {
+	r := req.Request
+	if err := r.Context().Err(); err != nil {
+		return nil, err
+	}
+	rec := DryRunRequest{
+		Time:   time.Now(),
+		ID:     req.id,
+		Method: r.Method,
+		URL:    c.redactURL(r.URL),
+		Header: c.redactHeader(r.Header).Clone(),
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		h := sha256.New()
+		n, err := io.Copy(h, r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		rec.BodySize = n
+		rec.BodyDigest = "sha-256=:" + base64.StdEncoding.EncodeToString(h.Sum(nil)) + ":"
+	}
+	if c.Logger != nil {
+		c.Logger.Printf("DEBUG %s: dry run, body of %d bytes", c.describe(req), rec.BodySize)
+	}
+	if err := c.DryRun.add(rec); err != nil {
+		return nil, err
+	}
+
+	if c.DryRun.Respond != nil {
+		return c.DryRun.Respond(r)
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    r,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package ubernet
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// ECHConfigLookup looks up the ECHConfigList a host publishes in its HTTPS
+// DNS record, nil if it publishes none.
+type ECHConfigLookup interface {
+	LookupECHConfig(ctx context.Context, host string) ([]byte, error)
+}
+
+// ECHOptions enables Encrypted Client Hello, hiding the server name of the
+// TLS handshakes from on-path observers.
+type ECHOptions struct {
+	// Lookup fetches the ECH configurations, preferably over an encrypted
+	// channel such as a DoHResolver, lest the local network strips them.
+	Lookup ECHConfigLookup
+	// Required fails the connections to hosts publishing no configuration,
+	// rather than connecting without ECH.
+	Required bool
+}
+
+// dialTLS connects to addr with dial and performs a TLS handshake with
+// config, encrypting the Client Hello when the host supports it. A server
+// rejecting the configuration may send others, which are tried once.
+func (o *ECHOptions) dialTLS(ctx context.Context, dial dialContextFunc, config *tls.Config, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	echConfig, err := o.Lookup.LookupECHConfig(ctx, host)
+	if err != nil && o.Required {
+		return nil, err
+	}
+	if echConfig == nil && o.Required {
+		return nil, &ErrECHUnavailable{Host: host}
+	}
+
+	config = tlsConfigFor(config, host)
+	if echConfig != nil {
+		config.EncryptedClientHelloConfigList = echConfig
+		config.MinVersion = tls.VersionTLS13
+	}
+
+	conn, err := tlsHandshake(ctx, dial, config, network, addr)
+	var rejected *tls.ECHRejectionError
+	if errors.As(err, &rejected) && len(rejected.RetryConfigList) > 0 {
+		config.EncryptedClientHelloConfigList = rejected.RetryConfigList
+		conn, err = tlsHandshake(ctx, dial, config, network, addr)
+	}
+	if errors.As(err, &rejected) {
+		return nil, &ErrECHRejected{Host: host, RetryConfigs: rejected.RetryConfigList, Err: err}
+	}
+	return conn, err
+}
+
+func tlsHandshake(ctx context.Context, dial dialContextFunc, config *tls.Config, network, addr string) (net.Conn, error) {
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
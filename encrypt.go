@@ -0,0 +1,114 @@
+package ubernet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// PayloadCipher encrypts the bodies of requests and decrypts the bodies of
+// responses, for partners requiring encryption at the application layer.
+type PayloadCipher interface {
+	// Encrypt returns the ciphertext of the body of req, and may set its
+	// headers, e.g. to identify the key.
+	Encrypt(req *http.Request, plaintext []byte) ([]byte, error)
+	// Decrypt returns the plaintext of the body of resp.
+	Decrypt(resp *http.Response, ciphertext []byte) ([]byte, error)
+}
+
+// EncryptionMiddleware returns a Middleware encrypting the request bodies
+// and decrypting the response bodies with c. Every attempt encrypts the
+// replayed body again, streamed bodies being read whole first. Only 2xx
+// responses are decrypted, error pages, e.g. from proxies, are passed
+// through as is, and so are streaming responses.
+func EncryptionMiddleware(c PayloadCipher) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*http.Response, error) {
+			if req.Body != nil && req.Body != http.NoBody {
+				plaintext, err := io.ReadAll(req.Body)
+				req.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				ciphertext, err := c.Encrypt(req.Request, plaintext)
+				if err != nil {
+					return nil, err
+				}
+				req.Body = io.NopCloser(bytes.NewReader(ciphertext))
+				req.GetBody = func() (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(ciphertext)), nil
+				}
+				req.ContentLength = int64(len(ciphertext))
+				req.TransferEncoding = nil
+			}
+
+			resp, err := next(req)
+			if err != nil || req.streamingResponse || resp.Body == nil || resp.Body == http.NoBody || resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return resp, err
+			}
+			ciphertext, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			if len(ciphertext) == 0 {
+				resp.Body = http.NoBody
+				return resp, nil
+			}
+			plaintext, err := c.Decrypt(resp, ciphertext)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(plaintext))
+			resp.ContentLength = int64(len(plaintext))
+			resp.Header.Set("Content-Length", strconv.Itoa(len(plaintext)))
+			return resp, nil
+		}
+	}
+}
+
+// ErrDecrypt indicates a payload could not be decrypted.
+var ErrDecrypt = errors.New("payload decryption failed")
+
+type aesGCMCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMCipher returns a PayloadCipher using AES-GCM with key, of 16,
+// 24 or 32 bytes. Payloads are prefixed with their random nonce.
+func NewAESGCMCipher(key []byte) (PayloadCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesGCMCipher{aead}, nil
+}
+
+func (c *aesGCMCipher) Encrypt(req *http.Request, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c *aesGCMCipher) Decrypt(resp *http.Response, ciphertext []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(ciphertext) < n {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := c.aead.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
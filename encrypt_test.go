@@ -0,0 +1,47 @@
+package ubernet
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEncryptionMiddlewarePassesErrorPages(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, "<html>bad gateway</html>")
+	}))
+	defer srv.Close()
+
+	cipher, err := NewAESGCMCipher(make([]byte, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient()
+	c.Logger = nil
+	c.RetryMax = 1
+	c.RetryWaitMin = time.Millisecond
+	c.RetryWaitMax = time.Millisecond
+	c.ErrorHandler = PassthroughErrorHandler
+	c.Middleware = []Middleware{EncryptionMiddleware(cipher)}
+	req, err := NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusBadGateway || string(body) != "<html>bad gateway</html>" {
+		t.Fatalf("got %d %q, want the error page", resp.StatusCode, body)
+	}
+	if calls != 2 {
+		t.Fatalf("%d attempts, want 2", calls)
+	}
+}
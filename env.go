@@ -0,0 +1,113 @@
+package ubernet
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables read by ConfigFromEnv, each overriding the Config
+// field of the same name:
+//
+//	UBERNET_TIMEOUT          Timeout, e.g. "30s"
+//	UBERNET_RETRY_WAIT_MIN   RetryWaitMin, e.g. "2s"
+//	UBERNET_RETRY_WAIT_MAX   RetryWaitMax, e.g. "10s"
+//	UBERNET_RETRY_MAX        RetryMax, e.g. "2"
+//	UBERNET_RETRY_POLICY     RetryPolicy name
+//	UBERNET_BACKOFF          Backoff name
+//	UBERNET_PROXY            Proxy URL
+//	UBERNET_KEEP_ALIVE       KeepAlive, e.g. "true"
+//	UBERNET_TLS_CA_FILE      TLS.CAFile
+//	UBERNET_TLS_CERT_FILE    TLS.CertFile
+//	UBERNET_TLS_KEY_FILE     TLS.KeyFile
+//	UBERNET_TLS_SKIP_VERIFY  TLS.InsecureSkipVerify, e.g. "true"
+//	UBERNET_RAISE_FD_LIMIT   RaiseFDLimit, e.g. "true"
+const envPrefix = "UBERNET_"
+
+// ConfigFromEnv returns the default Config overridden by the UBERNET_*
+// environment variables.
+func ConfigFromEnv() (*Config, error) {
+	conf := DefaultConfig()
+	if err := conf.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// NewClientFromEnv returns a Client configured by the UBERNET_*
+// environment variables.
+func NewClientFromEnv() (*Client, error) {
+	conf, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewClientFromConfig(conf)
+}
+
+func (conf *Config) loadEnv() error {
+	durations := map[string]*Duration{
+		"TIMEOUT":        &conf.Timeout,
+		"RETRY_WAIT_MIN": &conf.RetryWaitMin,
+		"RETRY_WAIT_MAX": &conf.RetryWaitMax,
+	}
+	for name, d := range durations {
+		if v, ok := lookupEnv(name); ok {
+			if err := d.UnmarshalText([]byte(v)); err != nil {
+				return envError(name, err)
+			}
+		}
+	}
+
+	if v, ok := lookupEnv("RETRY_MAX"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return envError("RETRY_MAX", err)
+		}
+		conf.RetryMax = n
+	}
+
+	texts := map[string]*string{
+		"RETRY_POLICY":  &conf.RetryPolicy,
+		"BACKOFF":       &conf.Backoff,
+		"PROXY":         &conf.Proxy,
+		"TLS_CA_FILE":   &conf.TLS.CAFile,
+		"TLS_CERT_FILE": &conf.TLS.CertFile,
+		"TLS_KEY_FILE":  &conf.TLS.KeyFile,
+	}
+	for name, s := range texts {
+		if v, ok := lookupEnv(name); ok {
+			*s = v
+		}
+	}
+
+	bools := map[string]*bool{
+		"KEEP_ALIVE":      &conf.KeepAlive,
+		"TLS_SKIP_VERIFY": &conf.TLS.InsecureSkipVerify,
+		"RAISE_FD_LIMIT":  &conf.RaiseFDLimit,
+	}
+	for name, b := range bools {
+		if v, ok := lookupEnv(name); ok {
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return envError(name, err)
+			}
+			*b = parsed
+		}
+	}
+	return nil
+}
+
+func lookupEnv(name string) (string, bool) {
+	v, ok := os.LookupEnv(envPrefix + name)
+	if !ok || v == "" {
+		return "", false
+	}
+	return v, true
+}
+
+func envError(name string, err error) error {
+	return fmt.Errorf("config: invalid %s%s: %w", envPrefix, name, err)
+}
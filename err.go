@@ -2,6 +2,11 @@ package ubernet
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -21,6 +26,9 @@ type ErrConnect struct {
 	error
 }
 
+// Unwrap returns the unix.Errno of the failed connect.
+func (e *ErrConnect) Unwrap() error { return e.error }
+
 // newErrConnect returns a ErrConnect with given error code
 func newErrConnect(errCode int) *ErrConnect {
 	return &ErrConnect{unix.Errno(errCode)}
@@ -28,3 +36,346 @@ func newErrConnect(errCode int) *ErrConnect {
 
 // ErrCheckerAlreadyStarted indicates there is another instance of CheckingLoop running.
 var ErrCheckerAlreadyStarted = errors.New("Checker was already started")
+
+// ErrCheckerNotStarted indicates CheckAddr was called while no CheckingLoop is running.
+var ErrCheckerNotStarted = errors.New("Checker is not started")
+
+// ErrCheckerValidation indicates Checker.Validate found the environment
+// unfit, with a hint on how to fix it.
+type ErrCheckerValidation struct {
+	Check string
+	Err   error
+	Hint  string
+}
+
+func (e *ErrCheckerValidation) Error() string {
+	if e.Hint == "" {
+		return fmt.Sprintf("checker validation: %s: %v", e.Check, e.Err)
+	}
+	return fmt.Sprintf("checker validation: %s: %v (%s)", e.Check, e.Err, e.Hint)
+}
+
+func (e *ErrCheckerValidation) Unwrap() error { return e.Err }
+
+// ErrResolveTimeout indicates the resolution of Host took longer than the
+// resolve timeout of a Dialer or Client, as opposed to a connect timeout.
+type ErrResolveTimeout struct {
+	Host  string
+	After time.Duration
+}
+
+func (e *ErrResolveTimeout) Error() string {
+	return fmt.Sprintf("resolving %s: timed out after %s", e.Host, e.After)
+}
+
+// Timeout reports true, as net.Error.
+func (e *ErrResolveTimeout) Timeout() bool { return true }
+
+// Temporary reports true, as net.Error.
+func (e *ErrResolveTimeout) Temporary() bool { return true }
+
+// ErrMaintenance indicates a request was not retried because Host is in a
+// maintenance Window, Err being the error of its attempts. It should be
+// deferred until the end of the window, e.g. replayed from a ReplayLog.
+type ErrMaintenance struct {
+	Host   string
+	Window MaintenanceWindow
+	Err    error
+}
+
+func (e *ErrMaintenance) Error() string {
+	msg := fmt.Sprintf("%s in maintenance until %s", e.Host, e.Window.End.Format(time.RFC3339))
+	if e.Window.Reason != "" {
+		msg += " (" + e.Window.Reason + ")"
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *ErrMaintenance) Unwrap() error { return e.Err }
+
+// ErrRetryAborted indicates a PreRetryGate aborted a request, Err being
+// the error of its Attempts.
+type ErrRetryAborted struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ErrRetryAborted) Error() string {
+	return fmt.Sprintf("retry aborted after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ErrRetryAborted) Unwrap() error { return e.Err }
+
+// ErrPrepareRetry indicates Client.PrepareRetry failed before retrying a
+// request, after its Attempts.
+type ErrPrepareRetry struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ErrPrepareRetry) Error() string {
+	return fmt.Sprintf("preparing retry after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ErrPrepareRetry) Unwrap() error { return e.Err }
+
+// ErrSchemaViolation indicates a response failed the validation of
+// SchemaMiddleware, Err being the error of the validator.
+type ErrSchemaViolation struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *ErrSchemaViolation) Error() string {
+	return fmt.Sprintf("%s %s: invalid response (status %d): %v", e.Method, e.URL, e.StatusCode, e.Err)
+}
+
+func (e *ErrSchemaViolation) Unwrap() error { return e.Err }
+
+// ErrRetryBudgetExhausted indicates a request was not retried because the
+// RetryBudget of the Client was exhausted, Err being the error of its
+// Attempts.
+type ErrRetryBudgetExhausted struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ErrRetryBudgetExhausted) Error() string {
+	return fmt.Sprintf("retry budget exhausted after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ErrRetryBudgetExhausted) Unwrap() error { return e.Err }
+
+// ErrAttemptTimeout indicates an attempt exceeded Client.AttemptTimeout,
+// After, and may be retried.
+type ErrAttemptTimeout struct {
+	After time.Duration
+	Err   error
+}
+
+func (e *ErrAttemptTimeout) Error() string {
+	return fmt.Sprintf("attempt timed out after %s: %v", e.After, e.Err)
+}
+
+func (e *ErrAttemptTimeout) Unwrap() error { return e.Err }
+
+// Timeout reports true, as net.Error.
+func (e *ErrAttemptTimeout) Timeout() bool { return true }
+
+// ErrTotalTimeout indicates a request exceeded its total timeout After,
+// attempts and backoffs included, Err being the last error.
+type ErrTotalTimeout struct {
+	After    time.Duration
+	Attempts int
+	Err      error
+}
+
+func (e *ErrTotalTimeout) Error() string {
+	return fmt.Sprintf("total timeout of %s exceeded after %d attempts: %v", e.After, e.Attempts, e.Err)
+}
+
+func (e *ErrTotalTimeout) Unwrap() error { return e.Err }
+
+// Timeout reports true, as net.Error.
+func (e *ErrTotalTimeout) Timeout() bool { return true }
+
+// ErrPreflight indicates the pre-flight check of Addr failed, Cached
+// reporting whether it was remembered from a previous dial.
+type ErrPreflight struct {
+	Addr   string
+	Cached bool
+	Err    error
+}
+
+func (e *ErrPreflight) Error() string {
+	if e.Cached {
+		return "preflight " + e.Addr + " (cached): " + e.Err.Error()
+	}
+	return "preflight " + e.Addr + ": " + e.Err.Error()
+}
+
+func (e *ErrPreflight) Unwrap() error { return e.Err }
+
+// ErrProtocolNotAccepted indicates the server negotiated none of the
+// accepted ALPN protocols, Protocol being empty if it negotiated none at all.
+type ErrProtocolNotAccepted struct {
+	Protocol string
+	Accepted []string
+}
+
+func (e *ErrProtocolNotAccepted) Error() string {
+	return fmt.Sprintf("ALPN protocol %q not accepted, expected one of %s", e.Protocol, strings.Join(e.Accepted, ", "))
+}
+
+// ErrECHUnavailable indicates ECH is required but Host publishes no
+// configuration.
+type ErrECHUnavailable struct {
+	Host string
+}
+
+func (e *ErrECHUnavailable) Error() string {
+	return fmt.Sprintf("%s publishes no ECH configuration", e.Host)
+}
+
+// ErrECHRejected indicates Host rejected the ECH configurations. Without
+// RetryConfigs the server likely does not support ECH, or a middlebox
+// terminated the handshake.
+type ErrECHRejected struct {
+	Host         string
+	RetryConfigs []byte
+	Err          error
+}
+
+func (e *ErrECHRejected) Error() string {
+	if len(e.RetryConfigs) == 0 {
+		return fmt.Sprintf("ECH rejected by %s without retry configurations: %v", e.Host, e.Err)
+	}
+	return fmt.Sprintf("ECH rejected by %s, retry configurations rejected too: %v", e.Host, e.Err)
+}
+
+func (e *ErrECHRejected) Unwrap() error { return e.Err }
+
+// ErrCircuitOpen indicates the circuit of Host is open until Until, or
+// half-open with all its probes in flight.
+type ErrCircuitOpen struct {
+	Host     string
+	Until    time.Time
+	HalfOpen bool
+}
+
+func (e *ErrCircuitOpen) Error() string {
+	if e.HalfOpen {
+		return fmt.Sprintf("circuit of %s half-open, probing", e.Host)
+	}
+	return fmt.Sprintf("circuit of %s open until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// ErrURLTooLong indicates the request URL exceeds Client.MaxURLLength.
+type ErrURLTooLong struct {
+	Length int
+	Limit  int
+}
+
+func (e *ErrURLTooLong) Error() string {
+	return fmt.Sprintf("URL length %d exceeds limit of %d", e.Length, e.Limit)
+}
+
+// ErrRequestBodyTooLarge indicates the request body exceeds Client.MaxRequestBodySize.
+type ErrRequestBodyTooLarge struct {
+	Limit int64
+}
+
+func (e *ErrRequestBodyTooLarge) Error() string {
+	return fmt.Sprintf("request body exceeds limit of %d bytes", e.Limit)
+}
+
+// ErrResponseBodyTooLarge indicates the response body exceeds Client.MaxResponseBodySize.
+type ErrResponseBodyTooLarge struct {
+	Limit int64
+}
+
+func (e *ErrResponseBodyTooLarge) Error() string {
+	return fmt.Sprintf("response body exceeds limit of %d bytes", e.Limit)
+}
+
+// ErrAsyncQueueFull indicates Client.DoAsync could not queue a request.
+var ErrAsyncQueueFull = errors.New("async request queue is full")
+
+// ErrAsyncClosed indicates Client.DoAsync was called after Client.CloseAsync.
+var ErrAsyncClosed = errors.New("async requests are closed")
+
+// ErrCanceledByCaller indicates the request was aborted with Request.Cancel.
+var ErrCanceledByCaller = errors.New("request canceled by caller")
+
+// ErrChecksumMismatch indicates a checksum echoed by the server does not
+// match the request body. Checksums are base64 encoded.
+type ErrChecksumMismatch struct {
+	Header   string
+	Expected string
+	Got      string
+}
+
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("checksum mismatch in %s: expected %s, got %s", e.Header, e.Expected, e.Got)
+}
+
+// ErrBodyNotReplayable indicates a streamed request body was already sent.
+var ErrBodyNotReplayable = errors.New("streamed request body can not be replayed")
+
+// ErrStaleConn is returned by the first write on a pooled connection which
+// must not be reused, being dead or past its lifetime. Since nothing was
+// written, the request is sent again on a new connection.
+var ErrStaleConn = errors.New("pooled connection is stale")
+
+// wrappedError annotates an error like github.com/pkg/errors.Wrap did, and
+// still has a Cause method for callers using errors.Cause.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func wrapError(err error, msg string) error {
+	return &wrappedError{msg, err}
+}
+
+func (e *wrappedError) Error() string { return e.msg + ": " + e.err.Error() }
+func (e *wrappedError) Unwrap() error { return e.err }
+
+// Cause returns the wrapped error.
+func (e *wrappedError) Cause() error { return e.err }
+
+// HTTPError is a response with an error status, returned by Client.Do in
+// strict mode. Body holds the start of the response body.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Headers    http.Header
+	Body       []byte
+	URL        string
+	Method     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// IsClientError reports whether err is an HTTPError with a 4xx status.
+func IsClientError(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode >= 400 && httpErr.StatusCode < 500
+}
+
+// IsServerError reports whether err is an HTTPError with a 5xx status.
+func IsServerError(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode >= 500
+}
+
+// IsStatus reports whether err is an HTTPError with the status code.
+func IsStatus(err error, code int) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == code
+}
+
+// httpErrorBodyLimit is the size of the body kept by NewHTTPError.
+const httpErrorBodyLimit = 64 << 10
+
+// NewHTTPError returns an HTTPError built from resp, reading the start of
+// its body and closing it.
+func NewHTTPError(resp *http.Response) *HTTPError {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, httpErrorBodyLimit))
+	e := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Headers:    resp.Header,
+		Body:       body,
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = resp.Request.URL.String()
+	}
+	return e
+}
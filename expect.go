@@ -0,0 +1,44 @@
+package ubernet
+
+import "net/http"
+
+// useExpectContinue reports whether req should be sent with
+// "Expect: 100-continue".
+func (c *Client) useExpectContinue(req *Request) bool {
+	if c.ExpectContinueThreshold <= 0 || req.body == nil || req.ContentLength < c.ExpectContinueThreshold {
+		return false
+	}
+	if req.Header.Get("Expect") != "" {
+		return false
+	}
+	_, rejected := c.noExpectHosts.Load(req.URL.Host)
+	return !rejected
+}
+
+// sendExpectContinue sends large bodies only once the server agreed to
+// receive them. Hosts answering 417 Expectation Failed are remembered, and
+// the request is sent again right away without the expectation.
+// If the server does not answer within ExpectContinueTimeout, the body
+// is sent anyway.
+func (c *Client) sendExpectContinue(req *Request) (*http.Response, error) {
+	if !c.useExpectContinue(req) {
+		return c.send(req)
+	}
+
+	req.Header.Set("Expect", "100-continue")
+	resp, err := c.send(req)
+	req.Header.Del("Expect")
+	if err != nil || resp.StatusCode != http.StatusExpectationFailed {
+		return resp, err
+	}
+
+	c.noExpectHosts.Store(req.URL.Host, true)
+	c.drainBody(resp.Body)
+	if c.Logger != nil {
+		c.Logger.Printf("DEBUG %s: expectation failed, resending without Expect", c.describe(req))
+	}
+	if err := c.rewindBody(req); err != nil {
+		return nil, err
+	}
+	return c.send(req)
+}
@@ -0,0 +1,209 @@
+package ubernet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Resolvers of a DialPlan.
+const (
+	PlanLiteral       = "literal"
+	PlanHostAlias     = "host-alias"
+	PlanResolverChain = "resolver-chain"
+	PlanResolver      = "resolver"
+	PlanSystem        = "system"
+)
+
+// DialPlan is the plan and outcome of a dial by Dialer.Explain.
+type DialPlan struct {
+	Address string
+	// Resolver is how the host was resolved: PlanLiteral for an IP
+	// address, PlanHostAlias, PlanResolverChain, PlanResolver for a custom
+	// Resolver, or PlanSystem.
+	Resolver        string
+	ResolveDuration time.Duration
+	ResolveErr      error
+	// Candidates are the addresses in the order they were tried, those
+	// after the one connected to being left untried.
+	Candidates []CandidateTiming
+	Options    DialOptions
+	// Selected and LocalAddr are the addresses of the established
+	// connection, empty if all the candidates failed.
+	Selected  string
+	LocalAddr string
+	Err       error
+}
+
+// DialOptions are the socket options of a Dialer, as set on its connections.
+type DialOptions struct {
+	Timeout        time.Duration
+	ResolveTimeout time.Duration
+	KeepAlive      time.Duration
+	DualStack      bool
+	FallbackDelay  time.Duration
+	LocalAddr      string
+	Interface      string
+	RoutingMark    int
+	ProxyHeader    bool
+	Control        bool
+}
+
+// Explain dials address ("host:port") over TCP like DialTCP, recording the
+// resolver used, the candidate addresses in order and the result and
+// timing of every connection attempt, for support tooling. Candidates are
+// tried one at a time, primaries then fallbacks unless FallbackDelay is
+// negative, rather than raced. The connection is closed before Explain
+// returns, and no PROXY header is sent.
+func (d *Dialer) Explain(ctx context.Context, address string) *DialPlan {
+	plan := &DialPlan{Address: address, Options: d.dialOptions()}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+
+	addrs, err := d.explainResolve(ctx, plan, address)
+	plan.ResolveDuration = time.Since(start)
+	if err != nil {
+		plan.ResolveErr, plan.Err = err, err
+		return plan
+	}
+	for _, addr := range addrs {
+		plan.Candidates = append(plan.Candidates, CandidateTiming{Addr: addr, Resolved: plan.ResolveDuration})
+	}
+
+	nd := d.netDialer()
+	nd.Timeout = 0
+	for i := range plan.Candidates {
+		candidate := &plan.Candidates[i]
+		candidate.Started = time.Since(start)
+		conn, err := nd.DialContext(ctx, "tcp", candidate.Addr)
+		candidate.Duration = time.Since(start) - candidate.Started
+		if err != nil {
+			candidate.Err = err
+			if plan.Err == nil {
+				plan.Err = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		plan.Selected = conn.RemoteAddr().String()
+		plan.LocalAddr = conn.LocalAddr().String()
+		plan.Err = nil
+		conn.Close()
+		break
+	}
+	return plan
+}
+
+// explainResolve returns the candidate addresses of address, in the order
+// they are dialed, setting the resolver of plan.
+func (d *Dialer) explainResolve(ctx context.Context, plan *DialPlan, address string) ([]string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		plan.Resolver = PlanLiteral
+		return []string{address}, nil
+	}
+	if addrs, ok := lookupHostAlias(d.HostAlias, address); ok {
+		plan.Resolver = PlanHostAlias
+		return addrs, nil
+	}
+	switch {
+	case d.Resolvers != nil:
+		plan.Resolver = PlanResolverChain
+	case d.Resolver != nil:
+		plan.Resolver = PlanResolver
+	default:
+		plan.Resolver = PlanSystem
+	}
+	ips, err := resolveWithTimeout(ctx, d.hostResolver(), "tcp", host, d.ResolveTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+	}
+	if d.FallbackDelay >= 0 {
+		// Like net.Dialer, the family of the first address goes first.
+		primaries, fallbacks := splitFamilies(ips)
+		ips = append(primaries, fallbacks...)
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.JoinHostPort(ip.String(), port)
+	}
+	return addrs, nil
+}
+
+func (d *Dialer) dialOptions() DialOptions {
+	opts := DialOptions{
+		Timeout:        d.Timeout,
+		ResolveTimeout: d.ResolveTimeout,
+		KeepAlive:      d.KeepAlive,
+		DualStack:      d.DualStack,
+		FallbackDelay:  d.FallbackDelay,
+		Interface:      d.Interface,
+		RoutingMark:    d.RoutingMark,
+		ProxyHeader:    d.ProxyHeader != nil,
+		Control:        d.Control != nil,
+	}
+	if d.LocalAddr != nil {
+		opts.LocalAddr = d.LocalAddr.String()
+	}
+	return opts
+}
+
+// String renders the plan as text, one line per step.
+func (p *DialPlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "dial %s\n", p.Address)
+	o := p.Options
+	fmt.Fprintf(&b, "  options: timeout=%s keepalive=%s dualstack=%t", o.Timeout, o.KeepAlive, o.DualStack)
+	if o.ResolveTimeout > 0 {
+		fmt.Fprintf(&b, " resolve-timeout=%s", o.ResolveTimeout)
+	}
+	if o.LocalAddr != "" {
+		fmt.Fprintf(&b, " local=%s", o.LocalAddr)
+	}
+	if o.Interface != "" {
+		fmt.Fprintf(&b, " interface=%s", o.Interface)
+	}
+	if o.RoutingMark != 0 {
+		fmt.Fprintf(&b, " mark=%d", o.RoutingMark)
+	}
+	if o.ProxyHeader {
+		b.WriteString(" proxy-header")
+	}
+	if o.Control {
+		b.WriteString(" control")
+	}
+	b.WriteByte('\n')
+	fmt.Fprintf(&b, "  resolve: %s in %s", p.Resolver, p.ResolveDuration)
+	if p.ResolveErr != nil {
+		fmt.Fprintf(&b, ": %v", p.ResolveErr)
+	}
+	b.WriteByte('\n')
+	for i, c := range p.Candidates {
+		switch {
+		case c.Err != nil:
+			fmt.Fprintf(&b, "  %d. %s at +%s: failed in %s: %v\n", i+1, c.Addr, c.Started, c.Duration, c.Err)
+		case c.Started > 0:
+			fmt.Fprintf(&b, "  %d. %s at +%s: connected in %s from %s\n", i+1, c.Addr, c.Started, c.Duration, p.LocalAddr)
+		default:
+			fmt.Fprintf(&b, "  %d. %s: not tried\n", i+1, c.Addr)
+		}
+	}
+	if p.Err != nil {
+		fmt.Fprintf(&b, "  error: %v\n", p.Err)
+	}
+	return b.String()
+}
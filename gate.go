@@ -0,0 +1,46 @@
+package ubernet
+
+import (
+	"context"
+	"net/http"
+)
+
+// RetryDecision is the decision of a PreRetryGate.
+type RetryDecision int
+
+// Decisions of a PreRetryGate.
+const (
+	// RetryProceed retries the request after the backoff, as usual.
+	RetryProceed RetryDecision = iota
+	// RetrySkip stops retrying, Do returning the response or error of the
+	// last attempt like when the policy does not retry.
+	RetrySkip
+	// RetryAbort fails the request with ErrRetryAborted.
+	RetryAbort
+)
+
+// PreRetryGate is called before every retry of req, attempt being the
+// number of the failed attempt and resp, err its result; resp may be read
+// but not closed. It may block, e.g. to wait for an operator confirmation
+// or a feature flag, until ctx is done. An error aborts the request with
+// it.
+type PreRetryGate func(ctx context.Context, req *Request, attempt int, resp *http.Response, err error) (RetryDecision, error)
+
+// gateRetry asks the PreRetryGate of c whether to retry req, returning
+// whether to retry, and otherwise the result of Do.
+func (c *Client) gateRetry(req *Request, attempt int, resp *http.Response, err error, attemptErrs AttemptErrors) (bool, *http.Response, error) {
+	decision, gateErr := c.PreRetryGate(req.Context(), req, attempt, resp, err)
+	switch {
+	case gateErr == nil && decision == RetryProceed:
+		return true, nil, nil
+	case gateErr == nil && decision == RetrySkip:
+		return false, resp, err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if gateErr != nil {
+		return false, nil, gateErr
+	}
+	return false, nil, &ErrRetryAborted{Attempts: attempt, Err: attemptErrs}
+}
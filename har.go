@@ -0,0 +1,278 @@
+package ubernet
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultHARMaxBodySize = 64 << 10
+	defaultHARMaxEntries  = 1000
+)
+
+// HARRecorder records the attempts of the requests of a Client, to be
+// exported as an HTTP Archive (HAR 1.2) for browser devtools. Sensitive
+// headers and query parameters are redacted like in logs. Recording can be
+// toggled at any time.
+type HARRecorder struct {
+	// MaxBodySize caps the bytes of every body kept, 64KiB by default.
+	// Negative values keep no body at all.
+	MaxBodySize int64
+	// MaxEntries caps the entries kept, the oldest being dropped, 1000 by
+	// default.
+	MaxEntries int
+
+	enabled int32
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// NewHARRecorder returns an enabled HARRecorder.
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{enabled: 1}
+}
+
+// Enable resumes the recording.
+func (h *HARRecorder) Enable() { atomic.StoreInt32(&h.enabled, 1) }
+
+// Disable pauses the recording, keeping the entries recorded so far.
+func (h *HARRecorder) Disable() { atomic.StoreInt32(&h.enabled, 0) }
+
+// Enabled reports whether h is recording.
+func (h *HARRecorder) Enabled() bool { return h != nil && atomic.LoadInt32(&h.enabled) == 1 }
+
+// Reset drops the entries recorded so far.
+func (h *HARRecorder) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = nil
+}
+
+// Len returns the number of entries recorded.
+func (h *HARRecorder) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+func (h *HARRecorder) maxBodySize() int64 {
+	if h.MaxBodySize == 0 {
+		return defaultHARMaxBodySize
+	}
+	return h.MaxBodySize
+}
+
+func (h *HARRecorder) add(e harEntry) {
+	max := h.MaxEntries
+	if max <= 0 {
+		max = defaultHARMaxEntries
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) >= max {
+		h.entries = append(h.entries[:0], h.entries[len(h.entries)-max+1:]...)
+	}
+	h.entries = append(h.entries, e)
+}
+
+// WriteTo writes the recorded entries as a HAR file to w.
+func (h *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	h.mu.Lock()
+	entries := append([]harEntry(nil), h.entries...)
+	h.mu.Unlock()
+
+	var doc harDocument
+	doc.Log.Version = "1.2"
+	doc.Log.Creator = harCreator{Name: "ubernet", Version: "1"}
+	doc.Log.Entries = entries
+	if doc.Log.Entries == nil {
+		doc.Log.Entries = []harEntry{}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&doc); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+type harDocument struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	out := make([]harNameValue, 0, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			out = append(out, harNameValue{name, v})
+		}
+	}
+	return out
+}
+
+// harText returns data as HAR text, base64 encoded if it is not UTF-8.
+func harText(data []byte) (text, encoding string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+// recordHAR records an attempt of req to the HARRecorder of c, capturing
+// the head of the body of resp without consuming it.
+func (c *Client) recordHAR(req *Request, resp *http.Response, err error, start time.Time) {
+	elapsed := float64(time.Since(start)) / float64(time.Millisecond)
+	redactedReq := c.redactRequest(req.Request)
+	limit := c.HAR.maxBodySize()
+
+	entry := harEntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Time:            elapsed,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         redactedReq.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(redactedReq.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+		Timings: harTimings{Wait: elapsed},
+	}
+	for name, values := range redactedReq.URL.Query() {
+		for _, v := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{name, v})
+		}
+	}
+	if req.body != nil && !req.streamed && limit > 0 {
+		if data, err := req.BodyBytes(); err == nil {
+			postData := &harPostData{MimeType: req.Header.Get("Content-Type")}
+			if int64(len(data)) > limit {
+				data = data[:limit]
+				postData.Comment = "truncated"
+			}
+			postData.Text, _ = harText(data)
+			entry.Request.PostData = postData
+		}
+	}
+
+	if err != nil {
+		entry.Response = harResponse{
+			Cookies: []harNameValue{}, Headers: []harNameValue{},
+			HeadersSize: -1, BodySize: -1,
+			Comment: c.redactError(err).Error(),
+		}
+		c.HAR.add(entry)
+		return
+	}
+
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(c.redactHeader(resp.Header)),
+		Content:     harContent{Size: resp.ContentLength, MimeType: resp.Header.Get("Content-Type")},
+		HeadersSize: -1,
+		BodySize:    resp.ContentLength,
+	}
+	if limit > 0 && !req.streamingResponse && resp.Body != nil && resp.Body != http.NoBody {
+		var head bytes.Buffer
+		n, readErr := io.CopyN(&head, resp.Body, limit+1)
+		// The head is read again by the caller.
+		resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(head.Bytes()), resp.Body), Closer: resp.Body}
+		data := head.Bytes()
+		if n > limit {
+			data = data[:limit]
+			entry.Response.Content.Comment = "truncated"
+		} else if readErr == io.EOF {
+			entry.Response.Content.Size = n
+		}
+		entry.Response.Content.Text, entry.Response.Content.Encoding = harText(data)
+	}
+	c.HAR.add(entry)
+}
+
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,173 @@
+package ubernet
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultHedgeDelay = 100 * time.Millisecond
+
+// HedgeOptions configures HedgeMiddleware.
+type HedgeOptions struct {
+	// Delay is how long an attempt waits for a response before a hedge is
+	// sent in parallel, 100ms by default. It should be about the 95th
+	// percentile latency of the backend.
+	Delay time.Duration
+	// MaxHedges is the number of hedges sent per attempt, 1 by default.
+	MaxHedges int
+	// NonIdempotent hedges the requests which are not idempotent too, the
+	// backend then possibly handling them more than once. Only the
+	// idempotent methods and the requests with an Idempotency-Key are
+	// hedged by default.
+	NonIdempotent bool
+}
+
+// HedgeMiddleware sends hedges of the attempts still waiting for a response
+// after Delay: clones of the request racing it, the first successful
+// response winning and the others being canceled. A failed request or
+// hedge fires the next hedge right away. It trades extra load for a lower
+// tail latency against flaky backends.
+//
+// Every attempt, the first one included, is sent from a clone of the
+// request, its body replayed from a private copy, so requests with
+// streamed bodies are not hedged.
+func HedgeMiddleware(opts HedgeOptions) Middleware {
+	if opts.Delay <= 0 {
+		opts.Delay = defaultHedgeDelay
+	}
+	if opts.MaxHedges <= 0 {
+		opts.MaxHedges = 1
+	}
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*http.Response, error) {
+			if req.streamed || req.streamingResponse || (!opts.NonIdempotent && !isIdempotent(req.Request)) {
+				return next(req)
+			}
+			return hedge(next, req, opts)
+		}
+	}
+}
+
+type hedgeResult struct {
+	i    int
+	resp *http.Response
+	err  error
+}
+
+// hedge sends copies of req through next, returning the first successful
+// response, or the last failure if none succeeded. req itself is only read
+// before any copy is sent, so that the attempts in flight neither share its
+// body nor race with it. The losers are canceled and waited for, so that
+// req can be retried afterwards.
+func hedge(next RoundTripFunc, req *Request, opts HedgeOptions) (*http.Response, error) {
+	ctx := req.Context()
+	base, err := req.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make(chan hedgeResult, opts.MaxHedges+1)
+	var cancels []context.CancelFunc
+	var clones []*Request
+	defer func() {
+		base.Close()
+		for _, clone := range clones {
+			clone.Close()
+		}
+	}()
+	launch := func() error {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		clone, err := base.Clone(attemptCtx)
+		if err == nil {
+			clones = append(clones, clone)
+			err = clone.rewindBody()
+		}
+		if err != nil {
+			cancel()
+			return err
+		}
+		i := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := next(clone)
+			results <- hedgeResult{i, resp, err}
+		}()
+		return nil
+	}
+	if err := launch(); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(opts.Delay)
+	defer timer.Stop()
+	winner, last := -1, hedgeResult{i: -1}
+	hedgeNow := func() {
+		if winner >= 0 || len(cancels) > opts.MaxHedges || ctx.Err() != nil {
+			return
+		}
+		if launch() == nil {
+			timer.Reset(opts.Delay)
+		}
+	}
+
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			before := len(cancels)
+			hedgeNow()
+			pending += len(cancels) - before
+		case r := <-results:
+			pending--
+			switch {
+			case winner >= 0:
+				if r.resp != nil {
+					r.resp.Body.Close()
+				}
+				cancels[r.i]()
+			case r.err == nil && r.resp.StatusCode < 500:
+				winner = r.i
+				for i, cancel := range cancels {
+					if i != r.i {
+						cancel()
+					}
+				}
+				if last.resp != nil {
+					last.resp.Body.Close()
+				}
+				last = r
+			default:
+				// Keep the latest failure, in case none succeeds.
+				if last.resp != nil {
+					last.resp.Body.Close()
+				}
+				if last.i >= 0 {
+					cancels[last.i]()
+				}
+				last = r
+				before := len(cancels)
+				hedgeNow()
+				pending += len(cancels) - before
+			}
+		}
+	}
+
+	if last.resp != nil {
+		last.resp.Body = &cancelOnClose{ReadCloser: last.resp.Body, cancel: cancels[last.i]}
+	} else {
+		cancels[last.i]()
+	}
+	return last.resp, last.err
+}
+
+// cancelOnClose cancels the context of a response once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
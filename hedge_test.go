@@ -0,0 +1,63 @@
+package ubernet
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeMiddlewareBody(t *testing.T) {
+	const payload = "hedged request body"
+	bodies := map[string]func() interface{}{
+		"ReadSeeker": func() interface{} { return strings.NewReader(payload) },
+		"Reader":     func() interface{} { return io.MultiReader(strings.NewReader(payload)) },
+		"Bytes":      func() interface{} { return []byte(payload) },
+		"Buffer":     func() interface{} { return bytes.NewBufferString(payload) },
+	}
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, err := io.ReadAll(r.Body)
+				if err != nil || string(got) != payload {
+					t.Errorf("server got body %q, %v; want %q", got, err, payload)
+				}
+				if atomic.AddInt32(&calls, 1) == 1 {
+					// Slow first attempt, so that a hedge is sent.
+					select {
+					case <-r.Context().Done():
+					case <-time.After(time.Second):
+					}
+				}
+			}))
+			defer srv.Close()
+
+			c := NewClient()
+			c.Logger = nil
+			c.Use(HedgeMiddleware(HedgeOptions{Delay: 20 * time.Millisecond, NonIdempotent: true}))
+			for _, method := range []string{"PUT", "POST"} {
+				atomic.StoreInt32(&calls, 0)
+				req, err := NewRequest(method, srv.URL, body())
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := c.Do(req)
+				if err != nil {
+					t.Fatalf("%s: %v", method, err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("%s: status %d", method, resp.StatusCode)
+				}
+				if n := atomic.LoadInt32(&calls); n < 2 {
+					t.Fatalf("%s: %d requests, want a hedge", method, n)
+				}
+			}
+		})
+	}
+}
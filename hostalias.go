@@ -0,0 +1,59 @@
+package ubernet
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// lookupHostAlias returns the addresses aliases maps address ("host:port")
+// to, looking up "host:port" and then "host", like curl --resolve.
+func lookupHostAlias(aliases map[string][]string, address string) ([]string, bool) {
+	if len(aliases) == 0 {
+		return nil, false
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, false
+	}
+	ips, ok := aliases[address]
+	if !ok {
+		ips, ok = aliases[strings.ToLower(host)]
+	}
+	if !ok || len(ips) == 0 {
+		return nil, false
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.JoinHostPort(ip, port)
+	}
+	return addrs, true
+}
+
+// hostAliasDialContext dials the addresses aliases maps a host to in turn,
+// bypassing DNS, and other hosts with dial. The host name is left for TLS.
+func hostAliasDialContext(dial dialContextFunc, aliases map[string][]string) dialContextFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		addrs, ok := lookupHostAlias(aliases, address)
+		if !ok {
+			return dial(ctx, network, address)
+		}
+		var firstErr error
+		for _, addr := range addrs {
+			conn, err := dial(ctx, network, addr)
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, firstErr
+	}
+}
@@ -0,0 +1,102 @@
+package ubernet
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// InboundOptions configures ReadInbound. Their zero values match the
+// defaults of a Client.
+type InboundOptions struct {
+	RequestID RequestIDOptions
+	Deadline  DeadlineOptions
+}
+
+// InboundRequest is a request received by a server, with the metadata
+// sent by retrying clients such as Client.
+type InboundRequest struct {
+	// Request wraps the received request, its body replayable, e.g. to be
+	// mirrored, forwarded or logged for audit.
+	*Request
+	// RequestID is the ID sent by the client, empty if none.
+	RequestID string
+	// Attempt is the 1-based number of the attempt sent by the client,
+	// zero if unknown.
+	Attempt int
+	// IdempotencyKey is the Idempotency-Key or X-Idempotency-Key header.
+	IdempotencyKey string
+	// Deadline is the deadline sent by the client, zero if none. The
+	// context of Request is bounded by it.
+	Deadline time.Time
+
+	cancel context.CancelFunc
+}
+
+// ReadInbound reads the body and the retry metadata of r, received by a
+// server. r.Body is read ahead like the body of FromRequest, and can be
+// read again by the handler. The InboundRequest must be closed once done,
+// unless it is sent by a Client.
+func ReadInbound(r *http.Request, opts InboundOptions) (*InboundRequest, error) {
+	orig := r
+	in := &InboundRequest{
+		RequestID: r.Header.Get(opts.RequestID.header()),
+		cancel:    func() {},
+	}
+	if attempt, err := strconv.Atoi(r.Header.Get(opts.RequestID.attemptHeader())); err == nil && attempt > 0 {
+		in.Attempt = attempt
+	}
+	in.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	if in.IdempotencyKey == "" {
+		in.IdempotencyKey = r.Header.Get("X-Idempotency-Key")
+	}
+	if deadline, ok := opts.Deadline.Deadline(r.Header, time.Now()); ok {
+		var ctx context.Context
+		ctx, in.cancel = context.WithDeadline(r.Context(), deadline)
+		r = r.WithContext(ctx)
+		in.Deadline = deadline
+	}
+
+	req, err := FromRequest(r)
+	if err != nil {
+		in.cancel()
+		return nil, err
+	}
+	if err := req.rewindBody(); err != nil {
+		in.cancel()
+		req.Close()
+		return nil, err
+	}
+	orig.Body = req.Body
+	in.Request = req
+	return in, nil
+}
+
+// Retried reports whether the client retried the request, which may then
+// have been handled already.
+func (in *InboundRequest) Retried() bool {
+	return in.Attempt > 1
+}
+
+// NewBody returns a new reader of the body, nil if it has none.
+func (in *InboundRequest) NewBody() (io.ReadCloser, error) {
+	if in.body == nil {
+		return nil, nil
+	}
+	body, err := in.body()
+	if err != nil {
+		return nil, err
+	}
+	if rc, ok := body.(io.ReadCloser); ok {
+		return rc, nil
+	}
+	return io.NopCloser(body), nil
+}
+
+// Close releases the body and the deadline of in.
+func (in *InboundRequest) Close() error {
+	in.cancel()
+	return in.Request.Close()
+}
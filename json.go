@@ -0,0 +1,74 @@
+package ubernet
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// GetJSON sends a GET request to url, decoding the JSON response into out.
+func GetJSON(url string, out interface{}) error {
+	return defaultClient.GetJSON(url, out)
+}
+
+// GetJSON sends a GET request to url, decoding the JSON response into out.
+func (c *Client) GetJSON(url string, out interface{}) error {
+	req, err := NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	return c.DoJSON(req, out)
+}
+
+// PostJSON sends in encoded in JSON in a POST request to url, decoding the
+// JSON response into out.
+func PostJSON(url string, in, out interface{}) error {
+	return defaultClient.PostJSON(url, in, out)
+}
+
+// PostJSON sends in encoded in JSON in a POST request to url, decoding the
+// JSON response into out.
+func (c *Client) PostJSON(url string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequestWithBody("POST", url, "application/json", data)
+	if err != nil {
+		return err
+	}
+	return c.DoJSON(req, out)
+}
+
+// DoJSON sends req like Do, decoding the JSON response into out, unless out
+// is nil or the response has no body. Responses with a status other than
+// 2xx fail with an *HTTPError holding the start of their body.
+func (c *Client) DoJSON(req *Request, out interface{}) error {
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return c.newHTTPError(req, resp)
+	}
+	defer c.drainBody(resp.Body)
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return wrapError(err, "decoding "+c.describe(req))
+	}
+	return nil
+}
+
+// newHTTPError returns the HTTPError of resp to req, closing its body.
+func (c *Client) newHTTPError(req *Request, resp *http.Response) *HTTPError {
+	httpErr := NewHTTPError(resp)
+	httpErr.Method = req.Method
+	httpErr.URL = c.redactURL(req.URL)
+	return httpErr
+}
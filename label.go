@@ -0,0 +1,74 @@
+package ubernet
+
+import (
+	"context"
+	"sync"
+)
+
+// LabelLimit limits the requests of a label, see Request.SetLabel.
+type LabelLimit struct {
+	// MaxConcurrent caps the requests of the label in progress in Do,
+	// further ones waiting for a slot.
+	MaxConcurrent int
+	// Rate caps the requests of the label per second, with bursts of
+	// Burst requests, Rate by default.
+	Rate  int64
+	Burst int64
+}
+
+// labelLimiter enforces the LabelLimit of a label.
+type labelLimiter struct {
+	slots chan struct{}
+	rate  *Throttle
+}
+
+// labelLimiters are the limiters of a Client, by label.
+type labelLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*labelLimiter
+}
+
+func (c *Client) labelLimiter(label string) *labelLimiter {
+	limit, ok := c.LabelLimits[label]
+	if !ok {
+		return nil
+	}
+	c.limiters.mu.Lock()
+	defer c.limiters.mu.Unlock()
+	if l, ok := c.limiters.limiters[label]; ok {
+		return l
+	}
+	if c.limiters.limiters == nil {
+		c.limiters.limiters = make(map[string]*labelLimiter)
+	}
+	l := &labelLimiter{}
+	if limit.MaxConcurrent > 0 {
+		l.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	if limit.Rate > 0 {
+		l.rate = NewThrottle(limit.Rate, limit.Burst)
+	}
+	c.limiters.limiters[label] = l
+	return l
+}
+
+// acquireLabel waits until the limits of the label of req let it go,
+// returning the function releasing its slot.
+func (c *Client) acquireLabel(ctx context.Context, req *Request) (func(), error) {
+	l := c.labelLimiter(req.label)
+	if l == nil {
+		return func() {}, nil
+	}
+	if err := l.rate.WaitN(ctx, 1); err != nil {
+		return nil, err
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
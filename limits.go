@@ -0,0 +1,86 @@
+package ubernet
+
+import (
+	"io"
+	"net/http"
+)
+
+// checkRequestLimits rejects requests whose URL or known body length
+// exceeds the limits of the Client.
+func (c *Client) checkRequestLimits(req *Request) error {
+	if c.MaxURLLength > 0 {
+		if n := len(req.URL.String()); n > c.MaxURLLength {
+			return &ErrURLTooLong{Length: n, Limit: c.MaxURLLength}
+		}
+	}
+	if c.MaxRequestBodySize > 0 && req.ContentLength > c.MaxRequestBodySize {
+		return &ErrRequestBodyTooLarge{Limit: c.MaxRequestBodySize}
+	}
+	return nil
+}
+
+// rewindBody rewinds the request body, limiting it to MaxRequestBodySize.
+func (c *Client) rewindBody(req *Request) error {
+	if err := req.rewindBody(); err != nil {
+		return err
+	}
+	if c.MaxRequestBodySize > 0 && req.Body != nil {
+		req.Body = &limitedReadCloser{
+			ReadCloser: req.Body,
+			remain:     c.MaxRequestBodySize,
+			err:        &ErrRequestBodyTooLarge{Limit: c.MaxRequestBodySize},
+		}
+	}
+	if req.body != nil && !req.streamed {
+		// Lets the transport send the request again on another connection.
+		req.GetBody = func() (io.ReadCloser, error) {
+			if err := c.rewindBody(req); err != nil {
+				return nil, err
+			}
+			return req.Body, nil
+		}
+	}
+	return nil
+}
+
+// limitResponse limits the body of resp to MaxResponseBodySize.
+// Responses announcing a larger body are closed right away.
+func (c *Client) limitResponse(resp *http.Response) (*http.Response, error) {
+	if c.MaxResponseBodySize <= 0 || resp == nil {
+		return resp, nil
+	}
+	if resp.ContentLength > c.MaxResponseBodySize {
+		resp.Body.Close()
+		return nil, &ErrResponseBodyTooLarge{Limit: c.MaxResponseBodySize}
+	}
+	resp.Body = &limitedReadCloser{
+		ReadCloser: resp.Body,
+		remain:     c.MaxResponseBodySize,
+		err:        &ErrResponseBodyTooLarge{Limit: c.MaxResponseBodySize},
+	}
+	return resp, nil
+}
+
+// limitedReadCloser reads at most remain bytes, and fails with err
+// instead of io.EOF if the underlying reader has more data.
+type limitedReadCloser struct {
+	io.ReadCloser
+	remain int64
+	err    error
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.remain < 0 {
+		return 0, l.err
+	}
+	// Read one byte past the limit to detect an oversized body.
+	if int64(len(p)) > l.remain+1 {
+		p = p[:l.remain+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remain -= int64(n)
+	if l.remain < 0 {
+		return n + int(l.remain), l.err
+	}
+	return n, err
+}
@@ -0,0 +1,120 @@
+package loadgen
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Values below linearMax are counted exactly, above they share buckets of
+// subBuckets per power of two, giving a relative error below 1.6%, like
+// an HDR histogram with two significant digits.
+const (
+	linearMax  = 128
+	subBuckets = 64
+	bucketsLen = linearMax + 57*subBuckets
+)
+
+// Histogram records latencies with microsecond resolution and bounded
+// relative error, in constant memory.
+type Histogram struct {
+	mu     sync.Mutex
+	counts [bucketsLen]uint64
+	total  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func bucketOf(us uint64) int {
+	if us < linearMax {
+		return int(us)
+	}
+	exp := bits.Len64(us) - 7
+	return linearMax + (exp-1)*subBuckets + int(us>>uint(exp)) - subBuckets
+}
+
+// valueOf returns the highest value of bucket i.
+func valueOf(i int) uint64 {
+	if i < linearMax {
+		return uint64(i)
+	}
+	exp := (i-linearMax)/subBuckets + 1
+	sub := uint64((i-linearMax)%subBuckets + subBuckets)
+	return (sub+1)<<uint(exp) - 1
+}
+
+// Record adds d to h.
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[bucketOf(uint64(d/time.Microsecond))]++
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+	h.sum += d
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+// Min returns the lowest recorded value.
+func (h *Histogram) Min() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.min
+}
+
+// Max returns the highest recorded value.
+func (h *Histogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+// Mean returns the mean of the recorded values.
+func (h *Histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Quantile returns the value below which a fraction q of the recorded
+// values fall, e.g. 0.99 for the 99th percentile.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.total) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			v := time.Duration(valueOf(i)) * time.Microsecond
+			if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
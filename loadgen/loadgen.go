@@ -0,0 +1,217 @@
+// Package loadgen generates request load with the ubernet Client and
+// Dialer, and reports latency histograms, error breakdowns and throughput.
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"ubernet"
+)
+
+// ReuseMode tells whether connections are reused across requests.
+type ReuseMode int
+
+// Available reuse modes.
+const (
+	// ReusePooled keeps connections alive and reuses them.
+	ReusePooled ReuseMode = iota
+	// ReuseNone opens a new connection for every request.
+	ReuseNone
+)
+
+// Config describes the load to generate.
+type Config struct {
+	// RPS is the target rate of requests per second.
+	RPS float64
+	// Ramp is the time taken to raise the rate linearly from zero to RPS.
+	Ramp time.Duration
+	// Duration is the total duration of the run, ramp included.
+	Duration time.Duration
+	// Concurrency caps the requests in flight. Requests due while the
+	// cap is reached are skipped and counted as such, 100 by default.
+	Concurrency int
+}
+
+// Target performs a single request of the load.
+type Target func(ctx context.Context) error
+
+// NewClient returns a Client without retries, reusing connections or not.
+func NewClient(mode ReuseMode) *ubernet.Client {
+	c := ubernet.NewClient()
+	if mode == ReusePooled {
+		c.HTTPClient = ubernet.DefaultPooledClient()
+	}
+	c.RetryMax = 0
+	c.Logger = nil
+	return c
+}
+
+// StatusError is returned by HTTPTarget for responses with status 500 or above.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d", e.StatusCode)
+}
+
+// HTTPTarget performs the requests returned by newRequest with c, reading
+// the whole response body.
+func HTTPTarget(c *ubernet.Client, newRequest func() (*ubernet.Request, error)) Target {
+	return func(ctx context.Context) error {
+		req, err := newRequest()
+		if err != nil {
+			return err
+		}
+		resp, err := c.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+			return err
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &StatusError{resp.StatusCode}
+		}
+		return nil
+	}
+}
+
+// DialTarget connects to address with d, then closes the connection.
+func DialTarget(d *ubernet.Dialer, address string) Target {
+	return func(ctx context.Context) error {
+		conn, err := d.DialTCP(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Requests  uint64
+	Succeeded uint64
+	// Skipped counts the requests not sent because Concurrency was reached.
+	Skipped uint64
+	// Errors counts failed requests by kind.
+	Errors   map[string]uint64
+	Duration time.Duration
+	// Latency holds the latency of every sent request, failed ones included.
+	Latency *Histogram
+}
+
+// Throughput returns the rate of successful requests per second.
+func (r *Report) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Succeeded) / r.Duration.Seconds()
+}
+
+// String formats r for humans.
+func (r *Report) String() string {
+	s := fmt.Sprintf("%d requests in %s, %.1f succeeded/s, %d skipped\n", r.Requests, r.Duration, r.Throughput(), r.Skipped)
+	s += fmt.Sprintf("latency: min %s, mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		r.Latency.Min(), r.Latency.Mean(), r.Latency.Quantile(0.5), r.Latency.Quantile(0.9), r.Latency.Quantile(0.99), r.Latency.Max())
+	for kind, n := range r.Errors {
+		s += fmt.Sprintf("  %s: %d\n", kind, n)
+	}
+	return s
+}
+
+// classify returns the kind of err for the error breakdown.
+func classify(err error) string {
+	var statusErr *StatusError
+	var connectErr *ubernet.ErrConnect
+	switch {
+	case errors.As(err, &statusErr):
+		return statusErr.Error()
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ubernet.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &connectErr):
+		return "connect"
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// Run generates the load described by conf on target until its Duration
+// elapsed or ctx is done, and waits for the requests in flight.
+func Run(ctx context.Context, conf Config, target Target) *Report {
+	concurrency := conf.Concurrency
+	if concurrency <= 0 {
+		concurrency = 100
+	}
+	report := &Report{Errors: make(map[string]uint64), Latency: &Histogram{}}
+
+	ctx, cancel := context.WithTimeout(ctx, conf.Duration)
+	defer cancel()
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	start := time.Now()
+	next := start
+	for {
+		elapsed := next.Sub(start)
+		rate := conf.RPS
+		if conf.Ramp > 0 && elapsed < conf.Ramp {
+			rate = conf.RPS * float64(elapsed) / float64(conf.Ramp)
+		}
+		// Start slowly rather than not at all at the beginning of the ramp.
+		if min := conf.RPS / 100; rate < min {
+			rate = min
+		}
+		if rate <= 0 {
+			break
+		}
+		next = next.Add(time.Duration(float64(time.Second) / rate))
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Until(next)):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			mu.Lock()
+			report.Skipped++
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			began := time.Now()
+			err := target(ctx)
+			report.Latency.Record(time.Since(began))
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Requests++
+			if err != nil {
+				report.Errors[classify(err)]++
+			} else {
+				report.Succeeded++
+			}
+		}()
+	}
+	wg.Wait()
+	report.Duration = time.Since(start)
+	return report
+}
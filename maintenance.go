@@ -0,0 +1,104 @@
+package ubernet
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaintenanceWindow is a period during which a host is down for
+// maintenance.
+type MaintenanceWindow struct {
+	Start  time.Time
+	End    time.Time
+	Reason string
+}
+
+// MaintenanceCalendar tells whether a host is in a maintenance window, e.g.
+// from the schedule published by a partner.
+type MaintenanceCalendar interface {
+	// Maintenance returns the window host is in at t, if any.
+	Maintenance(host string, t time.Time) (MaintenanceWindow, bool)
+}
+
+// MaintenanceCalendarFunc adapts a function to MaintenanceCalendar.
+type MaintenanceCalendarFunc func(host string, t time.Time) (MaintenanceWindow, bool)
+
+// Maintenance calls f(host, t).
+func (f MaintenanceCalendarFunc) Maintenance(host string, t time.Time) (MaintenanceWindow, bool) {
+	return f(host, t)
+}
+
+// MaintenanceSchedule is a MaintenanceCalendar of declared windows, safe for
+// concurrent use, e.g. to be updated from a feed.
+type MaintenanceSchedule struct {
+	mu      sync.RWMutex
+	windows map[string][]MaintenanceWindow
+}
+
+// Add declares a maintenance window of host, without port, "*" for every host.
+func (s *MaintenanceSchedule) Add(host string, w MaintenanceWindow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.windows == nil {
+		s.windows = make(map[string][]MaintenanceWindow)
+	}
+	host = strings.ToLower(host)
+	s.windows[host] = append(s.windows[host], w)
+}
+
+// Prune forgets the windows which ended before t.
+func (s *MaintenanceSchedule) Prune(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for host, windows := range s.windows {
+		kept := windows[:0]
+		for _, w := range windows {
+			if w.End.After(t) {
+				kept = append(kept, w)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.windows, host)
+		} else {
+			s.windows[host] = kept
+		}
+	}
+}
+
+// Maintenance implements MaintenanceCalendar.
+func (s *MaintenanceSchedule) Maintenance(host string, t time.Time) (MaintenanceWindow, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range [...]string{strings.ToLower(host), "*"} {
+		for _, w := range s.windows[key] {
+			if !t.Before(w.Start) && t.Before(w.End) {
+				return w, true
+			}
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// maintenanceWindow returns the window the host of req is in, if a retry
+// of an attempt ending with status code should be deferred.
+func (c *Client) maintenanceWindow(req *Request, code int) (MaintenanceWindow, bool) {
+	if req.URL == nil {
+		return MaintenanceWindow{}, false
+	}
+	codes := c.MaintenanceStatusCodes
+	if codes == nil {
+		codes = []int{503}
+	}
+	deferred := false
+	for _, s := range codes {
+		if s == code {
+			deferred = true
+			break
+		}
+	}
+	if !deferred {
+		return MaintenanceWindow{}, false
+	}
+	return c.Maintenance.Maintenance(req.URL.Hostname(), time.Now())
+}
@@ -0,0 +1,226 @@
+package ubernet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics records the requests of a Client, e.g. as Prometheus collectors.
+// Unlike RequestLogHook and ResponseLogHook, it sees every attempt with its
+// outcome and latency, the backoffs and the calls to Do as a whole.
+type Metrics interface {
+	// ObserveAttempt records an attempt of req, resp being nil if it failed
+	// with err.
+	ObserveAttempt(req *Request, resp *http.Response, err error, took time.Duration)
+	// ObserveBackoff records a wait before retrying req.
+	ObserveBackoff(req *Request, wait time.Duration)
+	// ObserveRequest records a call to Do, retries included.
+	ObserveRequest(req *Request, resp *http.Response, err error, took time.Duration)
+}
+
+// DefaultMetricsBuckets are the upper bounds of the latency histograms of
+// PrometheusMetrics, in seconds.
+var DefaultMetricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// PrometheusMetrics is a Metrics exposing its series in the Prometheus text
+// format, without depending on the Prometheus client library:
+//
+//	metrics := ubernet.NewPrometheusMetrics("myapp")
+//	client.Metrics = metrics
+//	http.Handle("/metrics", metrics)
+//
+// Codes are the status codes, or "error" when the attempt failed.
+type PrometheusMetrics struct {
+	namespace string
+	buckets   []float64
+
+	mu       sync.Mutex
+	requests map[metricKey]float64
+	attempts map[metricKey]float64
+	retries  map[metricKey]float64
+	backoff  map[metricKey]float64
+	reqTime  map[metricKey]*histogram
+	tryTime  map[metricKey]*histogram
+}
+
+type metricKey struct {
+	method, host, code string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheusMetrics returns a PrometheusMetrics naming its series after
+// namespace, "ubernet" if empty, with the latency histograms bucketed by
+// buckets, DefaultMetricsBuckets if none.
+func NewPrometheusMetrics(namespace string, buckets ...float64) *PrometheusMetrics {
+	if namespace == "" {
+		namespace = "ubernet"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		namespace: namespace,
+		buckets:   buckets,
+		requests:  make(map[metricKey]float64),
+		attempts:  make(map[metricKey]float64),
+		retries:   make(map[metricKey]float64),
+		backoff:   make(map[metricKey]float64),
+		reqTime:   make(map[metricKey]*histogram),
+		tryTime:   make(map[metricKey]*histogram),
+	}
+}
+
+func metricCode(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode)
+}
+
+// ObserveAttempt implements Metrics.
+func (m *PrometheusMetrics) ObserveAttempt(req *Request, resp *http.Response, err error, took time.Duration) {
+	key := metricKey{req.Method, req.URL.Host, metricCode(resp, err)}
+	m.mu.Lock()
+	m.attempts[key]++
+	m.observe(m.tryTime, metricKey{method: key.method, host: key.host}, took)
+	m.mu.Unlock()
+}
+
+// ObserveBackoff implements Metrics.
+func (m *PrometheusMetrics) ObserveBackoff(req *Request, wait time.Duration) {
+	key := metricKey{method: req.Method, host: req.URL.Host}
+	m.mu.Lock()
+	m.retries[key]++
+	m.backoff[key] += wait.Seconds()
+	m.mu.Unlock()
+}
+
+// ObserveRequest implements Metrics.
+func (m *PrometheusMetrics) ObserveRequest(req *Request, resp *http.Response, err error, took time.Duration) {
+	key := metricKey{req.Method, req.URL.Host, metricCode(resp, err)}
+	m.mu.Lock()
+	m.requests[key]++
+	m.observe(m.reqTime, metricKey{method: key.method, host: key.host}, took)
+	m.mu.Unlock()
+}
+
+func (m *PrometheusMetrics) observe(hs map[metricKey]*histogram, key metricKey, took time.Duration) {
+	h, ok := hs[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		hs[key] = h
+	}
+	s := took.Seconds()
+	for i, le := range m.buckets {
+		if s <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+// ServeHTTP serves the series in the Prometheus text format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the series to w in the Prometheus text format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	m.mu.Lock()
+	m.writeCounter(&buf, "requests_total", "Requests by method, host and code, retries included.", m.requests, true)
+	m.writeCounter(&buf, "attempts_total", "Attempts by method, host and code.", m.attempts, true)
+	m.writeCounter(&buf, "retries_total", "Retries by method and host.", m.retries, false)
+	m.writeCounter(&buf, "backoff_seconds_total", "Time spent waiting before retrying, by method and host.", m.backoff, false)
+	m.writeHistogram(&buf, "request_duration_seconds", "Latency of the requests, retries included.", m.reqTime)
+	m.writeHistogram(&buf, "attempt_duration_seconds", "Latency of the attempts.", m.tryTime)
+	m.mu.Unlock()
+	return buf.WriteTo(w)
+}
+
+func (m *PrometheusMetrics) writeCounter(w *bytes.Buffer, name, help string, series map[metricKey]float64, code bool) {
+	name = m.namespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]metricKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	for _, key := range sortKeys(keys) {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, key.labels(code), formatFloat(series[key]))
+	}
+}
+
+func (m *PrometheusMetrics) writeHistogram(w *bytes.Buffer, name, help string, series map[metricKey]*histogram) {
+	name = m.namespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	keys := make([]metricKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	for _, key := range sortKeys(keys) {
+		h, labels := series[key], key.labels(false)
+		for i, le := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(le), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+func (k metricKey) labels(code bool) string {
+	labels := fmt.Sprintf("method=%q,host=%q", escapeLabel(k.method), escapeLabel(k.host))
+	if code {
+		labels += fmt.Sprintf(",code=%q", k.code)
+	}
+	return labels
+}
+
+// escapeLabel escapes v so that %q leaves a valid label value, which
+// Prometheus only lets escape backslashes, quotes and newlines.
+func escapeLabel(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortKeys(keys []metricKey) []metricKey {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		return a.code < b.code
+	})
+	return keys
+}
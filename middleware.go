@@ -0,0 +1,29 @@
+package ubernet
+
+import "net/http"
+
+// RoundTripFunc performs a single attempt of a request.
+type RoundTripFunc func(*Request) (*http.Response, error)
+
+// Middleware wraps every attempt of a Client, e.g. to alter the request
+// before it is sent or to check the response.
+// The body of the request can be read again from its ReaderFunc.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use appends mw to the middleware of the Client.
+// The first middleware is the outermost one.
+func (c *Client) Use(mw ...Middleware) {
+	c.Middleware = append(c.Middleware, mw...)
+}
+
+// roundTrip sends a single attempt through the middleware chain.
+func (c *Client) roundTrip(req *Request) (*http.Response, error) {
+	if len(c.Middleware) == 0 {
+		return c.sendExpectContinue(req)
+	}
+	next := RoundTripFunc(c.sendExpectContinue)
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		next = c.Middleware[i](next)
+	}
+	return next(req)
+}
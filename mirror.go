@@ -0,0 +1,121 @@
+package ubernet
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMirrorTimeout     = 30 * time.Second
+	defaultMirrorMaxInFlight = 64
+)
+
+// MirrorOptions configures MirrorMiddleware.
+type MirrorOptions struct {
+	// BaseURL replaces the scheme and host of mirrored requests, and is
+	// prepended to their path.
+	BaseURL string
+	// Percent is the percentage of requests mirrored, from 0 to 100.
+	Percent float64
+	// Client sends the mirrored requests, a Client without retries nor
+	// logging by default.
+	Client *Client
+	// Timeout limits every mirrored request, 30s by default.
+	Timeout time.Duration
+	// MaxInFlight caps the mirrored requests in progress, further ones are
+	// dropped, 64 by default.
+	MaxInFlight int
+	// OnError is called when a mirrored request fails or is dropped, e.g.
+	// to log or meter it.
+	OnError func(req *http.Request, err error)
+}
+
+// MirrorMiddleware sends a copy of a percentage of the requests to another
+// base URL, e.g. a new backend version being tested with production
+// traffic. Copies are sent asynchronously once the request got its first
+// response, their responses are discarded, and they never affect the
+// request. Retries are not mirrored.
+func MirrorMiddleware(opts MirrorOptions) (Middleware, error) {
+	base, err := url.Parse(opts.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	client := opts.Client
+	if client == nil {
+		client = NewClient()
+		client.RetryMax = 0
+		client.Logger = nil
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultMirrorTimeout
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = defaultMirrorMaxInFlight
+	}
+	inFlight := make(chan struct{}, opts.MaxInFlight)
+
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*http.Response, error) {
+			if req.lastAttempt.Attempts > 1 || rand.Float64()*100 >= opts.Percent {
+				return next(req)
+			}
+			// The copy is taken before the request is sent, from a reader
+			// of its own, as the transport may still be reading the body
+			// once the response came.
+			mirror, cloneErr := req.Clone(context.Background())
+			resp, err := next(req)
+			if cloneErr != nil {
+				opts.onError(req.Request, cloneErr)
+				return resp, err
+			}
+			mirror.URL = mirrorURL(base, mirror.URL)
+			mirror.Host = ""
+
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				opts.onError(mirror.Request, ErrAsyncQueueFull)
+				mirror.Close()
+				return resp, err
+			}
+			go func() {
+				defer func() { <-inFlight }()
+				ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+				defer cancel()
+				mirrorResp, err := client.Do(mirror.WithContext(ctx))
+				if err != nil {
+					opts.onError(mirror.Request, err)
+					return
+				}
+				io.Copy(io.Discard, mirrorResp.Body)
+				mirrorResp.Body.Close()
+			}()
+			return resp, err
+		}
+	}, nil
+}
+
+func (opts *MirrorOptions) onError(req *http.Request, err error) {
+	if opts.OnError != nil {
+		opts.OnError(req, err)
+	}
+}
+
+// mirrorURL returns u with the scheme and host of base, and the path of
+// base prepended to its path.
+func mirrorURL(base, u *url.URL) *url.URL {
+	mirrored := *u
+	mirrored.Scheme = base.Scheme
+	mirrored.Host = base.Host
+	mirrored.User = base.User
+	if base.Path != "" && base.Path != "/" {
+		mirrored.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+		mirrored.RawPath = ""
+	}
+	return &mirrored
+}
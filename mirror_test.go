@@ -0,0 +1,53 @@
+package ubernet
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirrorMiddlewareReadSeekerBody(t *testing.T) {
+	const payload = "mirrored body"
+	handler := func(got chan<- string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			got <- string(body)
+		}
+	}
+	primaryGot, mirrorGot := make(chan string, 1), make(chan string, 1)
+	primary := httptest.NewServer(handler(primaryGot))
+	defer primary.Close()
+	shadow := httptest.NewServer(handler(mirrorGot))
+	defer shadow.Close()
+
+	mw, err := MirrorMiddleware(MirrorOptions{BaseURL: shadow.URL, Percent: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient()
+	c.Logger = nil
+	c.Middleware = []Middleware{mw}
+	req, err := NewRequest("POST", primary.URL, seekOnly{strings.NewReader(payload)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for name, got := range map[string]chan string{"primary": primaryGot, "mirror": mirrorGot} {
+		select {
+		case body := <-got:
+			if body != payload {
+				t.Errorf("%s got body %q, want %q", name, body, payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s got no request", name)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package ubernet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// API binds the operations of an OpenAPI 3 document to a Client,
+// so they can be called by operationId.
+//
+// Retries follow the spec: operations with an idempotent method, or marked
+// with "x-idempotent: true", are retried according to the Client settings,
+// or "x-retry-max" when set. Other operations are never retried.
+type API struct {
+	client     *Client
+	baseURL    string
+	operations map[string]*Operation
+}
+
+// Operation is an operation of an OpenAPI document.
+type Operation struct {
+	ID         string
+	Method     string
+	Path       string
+	Idempotent bool
+	// RetryMax is the retry hint of the operation, -1 if the Client
+	// settings apply.
+	RetryMax   int
+	Parameters []Parameter
+}
+
+// Parameter is a parameter of an Operation.
+type Parameter struct {
+	Name     string
+	In       string
+	Required bool
+}
+
+type openAPIDocument struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+type openAPIParameter struct {
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+}
+
+type openAPIOperation struct {
+	OperationID string             `json:"operationId"`
+	Parameters  []openAPIParameter `json:"parameters"`
+	Idempotent  *bool              `json:"x-idempotent"`
+	RetryMax    *int               `json:"x-retry-max"`
+}
+
+// LoadAPI reads an OpenAPI 3 document in JSON format from spec.
+// If baseURL is empty, the first server of the document is used.
+func LoadAPI(client *Client, spec io.Reader, baseURL string) (*API, error) {
+	var doc openAPIDocument
+	if err := json.NewDecoder(spec).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error decoding OpenAPI document: %w", err)
+	}
+	if baseURL == "" {
+		if len(doc.Servers) == 0 {
+			return nil, fmt.Errorf("OpenAPI document has no server and no base URL was given")
+		}
+		baseURL = doc.Servers[0].URL
+	}
+
+	api := &API{
+		client:     client,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		operations: make(map[string]*Operation),
+	}
+	for path, item := range doc.Paths {
+		var shared []openAPIParameter
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("error decoding parameters of %s: %w", path, err)
+			}
+		}
+		for method, raw := range item {
+			method = strings.ToUpper(method)
+			if !isHTTPMethod(method) {
+				continue
+			}
+			var op openAPIOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("error decoding %s %s: %w", method, path, err)
+			}
+			if op.OperationID == "" {
+				continue
+			}
+			api.operations[op.OperationID] = newOperation(method, path, &op, shared)
+		}
+	}
+	return api, nil
+}
+
+func isHTTPMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func newOperation(method, path string, op *openAPIOperation, shared []openAPIParameter) *Operation {
+	o := &Operation{
+		ID:       op.OperationID,
+		Method:   method,
+		Path:     path,
+		RetryMax: -1,
+	}
+	o.Idempotent = isIdempotent(&http.Request{Method: method})
+	if op.Idempotent != nil {
+		o.Idempotent = *op.Idempotent
+	}
+	if op.RetryMax != nil {
+		o.RetryMax = *op.RetryMax
+	}
+	for _, p := range append(shared, op.Parameters...) {
+		o.Parameters = append(o.Parameters, Parameter(p))
+	}
+	return o
+}
+
+// Operation returns the operation with given operationId.
+func (a *API) Operation(id string) (*Operation, bool) {
+	op, ok := a.operations[id]
+	return op, ok
+}
+
+// Operations returns the operationIds of the document, sorted.
+func (a *API) Operations() []string {
+	ids := make([]string, 0, len(a.operations))
+	for id := range a.operations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Call performs the operation with given operationId.
+// params holds the path, query and header parameters of the operation by
+// name, body is handled like in NewRequest.
+func (a *API) Call(ctx context.Context, id string, params map[string]string, body interface{}) (*http.Response, error) {
+	req, err := a.NewRequest(id, params, body)
+	if err != nil {
+		return nil, err
+	}
+	return a.client.Do(req.WithContext(ctx))
+}
+
+// NewRequest builds the request of the operation with given operationId.
+func (a *API) NewRequest(id string, params map[string]string, body interface{}) (*Request, error) {
+	op, ok := a.operations[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown operation %q", id)
+	}
+
+	path := op.Path
+	query := url.Values{}
+	header := http.Header{}
+	for _, p := range op.Parameters {
+		value, ok := params[p.Name]
+		if !ok {
+			if p.Required {
+				return nil, fmt.Errorf("operation %s: missing required %s parameter %q", id, p.In, p.Name)
+			}
+			continue
+		}
+		switch p.In {
+		case "path":
+			path = strings.Replace(path, "{"+p.Name+"}", url.PathEscape(value), -1)
+		case "query":
+			query.Set(p.Name, value)
+		case "header":
+			header.Set(p.Name, value)
+		}
+	}
+
+	rawURL := a.baseURL + path
+	if len(query) > 0 {
+		rawURL += "?" + query.Encode()
+	}
+	req, err := NewRequest(op.Method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	switch {
+	case !op.Idempotent:
+		req.retryMax = new(int)
+	case op.RetryMax >= 0:
+		retryMax := op.RetryMax
+		req.retryMax = &retryMax
+	}
+	return req, nil
+}
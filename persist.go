@@ -0,0 +1,241 @@
+package ubernet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PersistentJar is an http.CookieJar saving its persistent cookies, those
+// with an expiry, to a SecretStore, so that sessions survive restarts.
+type PersistentJar struct {
+	jar   *cookiejar.Jar
+	store SecretStore
+	name  string
+
+	mu      sync.Mutex
+	cookies map[string]storedCookie
+}
+
+// storedCookie is a cookie with the URL it was set from.
+type storedCookie struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// NewPersistentJar returns a PersistentJar saving its cookies as the secret
+// name of store, loading the cookies saved earlier. opts is passed to
+// cookiejar.New, and should set a PublicSuffixList.
+func NewPersistentJar(store SecretStore, name string, opts *cookiejar.Options) (*PersistentJar, error) {
+	jar, err := cookiejar.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	j := &PersistentJar{jar: jar, store: store, name: name, cookies: make(map[string]storedCookie)}
+
+	data, err := store.Load(name)
+	if errors.Is(err, ErrSecretNotFound) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []storedCookie
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("loading cookies: %w", err)
+	}
+	now := time.Now()
+	for _, sc := range saved {
+		u, err := url.Parse(sc.URL)
+		if err != nil || sc.Cookie == nil || !sc.Cookie.Expires.After(now) {
+			continue
+		}
+		j.jar.SetCookies(u, []*http.Cookie{sc.Cookie})
+		j.cookies[cookieKey(u, sc.Cookie)] = sc
+	}
+	return j, nil
+}
+
+func cookieKey(u *url.URL, c *http.Cookie) string {
+	domain := c.Domain
+	if domain == "" {
+		domain = u.Hostname()
+	}
+	return strings.ToLower(domain) + ";" + c.Path + ";" + c.Name
+}
+
+// SetCookies implements http.CookieJar, saving the jar when persistent
+// cookies changed. Errors saving are ignored, see Save.
+func (j *PersistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	changed := false
+	j.mu.Lock()
+	for _, c := range cookies {
+		key := cookieKey(u, c)
+		switch {
+		case c.MaxAge < 0 || (!c.Expires.IsZero() && !c.Expires.After(now)):
+			if _, ok := j.cookies[key]; ok {
+				delete(j.cookies, key)
+				changed = true
+			}
+		case c.MaxAge > 0 || !c.Expires.IsZero():
+			saved := *c
+			if c.MaxAge > 0 {
+				saved.Expires, saved.MaxAge = now.Add(time.Duration(c.MaxAge)*time.Second), 0
+			}
+			saved.Raw, saved.Unparsed = "", nil
+			j.cookies[key] = storedCookie{URL: u.Scheme + "://" + u.Host + "/", Cookie: &saved}
+			changed = true
+		}
+	}
+	j.mu.Unlock()
+	if changed {
+		j.Save()
+	}
+}
+
+// Cookies implements http.CookieJar.
+func (j *PersistentJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// Save saves the persistent cookies of j to its store.
+func (j *PersistentJar) Save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	saved := make([]storedCookie, 0, len(j.cookies))
+	for key, sc := range j.cookies {
+		if !sc.Cookie.Expires.After(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		saved = append(saved, sc)
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return j.store.Save(j.name, data)
+}
+
+// Token is an OAuth-style access token.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// tokenExpiryDelta treats tokens as expired slightly early, so that they
+// do not expire in flight.
+const tokenExpiryDelta = 10 * time.Second
+
+// Valid reports whether t has an access token which did not expire.
+func (t *Token) Valid() bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.Expiry))
+}
+
+// TokenAuth is an AuthProvider sending a Token saved as the secret Name of
+// Store, refreshing it with Refresh when it expired or the server answers
+// 401 Unauthorized, and saving the refreshed token.
+type TokenAuth struct {
+	Store SecretStore
+	Name  string
+	// Refresh, if set, returns a new token from t, which may be nil or
+	// without access token if none was saved, e.g. to log in.
+	Refresh func(ctx context.Context, t *Token) (*Token, error)
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// Token returns the current token, loading it from the store, and
+// refreshing it if it expired.
+func (a *TokenAuth) Token(ctx context.Context) (*Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == nil {
+		data, err := a.Store.Load(a.Name)
+		switch {
+		case err == nil:
+			var t Token
+			if err := json.Unmarshal(data, &t); err != nil {
+				return nil, fmt.Errorf("loading token: %w", err)
+			}
+			a.token = &t
+		case !errors.Is(err, ErrSecretNotFound) || a.Refresh == nil:
+			return nil, err
+		}
+	}
+	if !a.token.Valid() && a.Refresh != nil {
+		if err := a.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return a.token, nil
+}
+
+// SetToken replaces the token, saving it to the store.
+func (a *TokenAuth) SetToken(t *Token) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.save(t)
+}
+
+// refresh gets and saves a new token. a.mu must be held.
+func (a *TokenAuth) refresh(ctx context.Context) error {
+	t, err := a.Refresh(ctx, a.token)
+	if err != nil {
+		return fmt.Errorf("refreshing token: %w", err)
+	}
+	return a.save(t)
+}
+
+func (a *TokenAuth) save(t *Token) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := a.Store.Save(a.Name, data); err != nil {
+		return err
+	}
+	a.token = t
+	return nil
+}
+
+// Authorize implements AuthProvider.
+func (a *TokenAuth) Authorize(req *http.Request) error {
+	t, err := a.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	req.Header.Set("Authorization", tokenType+" "+t.AccessToken)
+	return nil
+}
+
+// Challenge implements AuthProvider, refreshing the token once.
+func (a *TokenAuth) Challenge(req *http.Request, resp *http.Response) (bool, error) {
+	if a.Refresh == nil {
+		return false, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.refresh(req.Context()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
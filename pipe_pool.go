@@ -1,6 +1,9 @@
 package ubernet
 
-type pipePool interface {
-	getPipe() chan error
-	putBackPipe(chan error)
+// PipePool provides the pipes on which a Checker receives connect results.
+// A pipe is a channel with a buffer of one, put back empty or not.
+// Implementations must be safe for concurrent use.
+type PipePool interface {
+	GetPipe() chan error
+	PutBackPipe(chan error)
 }
@@ -0,0 +1,35 @@
+package ubernet
+
+type pipePoolChan struct {
+	pipes chan chan error
+}
+
+// NewChanPipePool returns a PipePool keeping size preallocated pipes for
+// reuse, and allocating more when they are all in use.
+func NewChanPipePool(size int) PipePool {
+	p := &pipePoolChan{make(chan chan error, size)}
+	for i := 0; i < size; i++ {
+		p.pipes <- make(chan error, 1)
+	}
+	return p
+}
+
+func (p *pipePoolChan) GetPipe() chan error {
+	select {
+	case pipe := <-p.pipes:
+		return pipe
+	default:
+		return make(chan error, 1)
+	}
+}
+
+func (p *pipePoolChan) PutBackPipe(pipe chan error) {
+	select {
+	case <-pipe:
+	default:
+	}
+	select {
+	case p.pipes <- pipe:
+	default:
+	}
+}
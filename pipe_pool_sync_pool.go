@@ -6,7 +6,8 @@ type pipePoolSyncPool struct {
 	pool sync.Pool
 }
 
-func newPipePoolSyncPool() *pipePoolSyncPool {
+// NewSyncPoolPipePool returns a PipePool backed by a sync.Pool, the default.
+func NewSyncPoolPipePool() PipePool {
 	return &pipePoolSyncPool{sync.Pool{
 		New: func() interface{} {
 			return make(chan error, 1)
@@ -14,11 +15,11 @@ func newPipePoolSyncPool() *pipePoolSyncPool {
 	}
 }
 
-func (p *pipePoolSyncPool) getPipe() chan error {
+func (p *pipePoolSyncPool) GetPipe() chan error {
 	return p.pool.Get().(chan error)
 }
 
-func (p *pipePoolSyncPool) putBackPipe(pipe chan error) {
+func (p *pipePoolSyncPool) PutBackPipe(pipe chan error) {
 	p.cleanPipe(pipe)
 	p.pool.Put(pipe)
 }
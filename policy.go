@@ -0,0 +1,323 @@
+package ubernet
+
+import (
+	"crypto/tls"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy overrides the Client settings for the destinations it is registered for.
+// Zero values inherit the settings of the Client.
+type Policy struct {
+	// TLSMinVersion is the minimum TLS version accepted, e.g. tls.VersionTLS12.
+	TLSMinVersion uint16
+	// Protocols restricts the protocols negotiated via ALPN, e.g. "h2", "http/1.1".
+	Protocols []string
+	// RequireProtocol fails the handshake unless the server negotiates one
+	// of Protocols, rather than falling back to HTTP/1.1 without ALPN.
+	RequireProtocol bool
+	// DisableResumption disables TLS session resumption, for servers which
+	// mishandle session tickets.
+	DisableResumption bool
+	// InsecureSkipVerify disables certificate verification,
+	// for legacy appliances with self-signed certificates.
+	InsecureSkipVerify bool
+
+	// Timeout limits a single attempt, including reading the response body.
+	Timeout time.Duration
+	// ResponseHeaderTimeout limits the wait for the response headers.
+	ResponseHeaderTimeout time.Duration
+
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+	RetryMax     int
+	// NoRetry disables retries regardless of RetryMax.
+	NoRetry bool
+}
+
+func (p *Policy) needsTransport() bool {
+	return p.TLSMinVersion != 0 || p.Protocols != nil || p.InsecureSkipVerify || p.DisableResumption || p.ResponseHeaderTimeout > 0
+}
+
+// PolicyRegistry maps host patterns to policies.
+// A pattern is either an exact host name, a wildcard like "*.example.com"
+// matching any subdomain, or "*" matching every host.
+// Exact patterns win over wildcards, and longer wildcards over shorter ones.
+type PolicyRegistry struct {
+	mu       sync.RWMutex
+	policies map[string]*Policy
+}
+
+// NewPolicyRegistry returns an empty PolicyRegistry.
+func NewPolicyRegistry() *PolicyRegistry {
+	return &PolicyRegistry{policies: make(map[string]*Policy)}
+}
+
+// Register sets the policy of hosts matching pattern, replacing any previous one.
+func (r *PolicyRegistry) Register(pattern string, p Policy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.policies == nil {
+		r.policies = make(map[string]*Policy)
+	}
+	r.policies[strings.ToLower(pattern)] = &p
+}
+
+// registered reports whether p is the policy of a pattern.
+func (r *PolicyRegistry) registered(p *Policy) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, q := range r.policies {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the policy matching host, which must not contain a port.
+func (r *PolicyRegistry) Lookup(host string) (*Policy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	host = strings.ToLower(host)
+	if p, ok := r.policies[host]; ok {
+		return p, true
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if p, ok := r.policies["*."+host]; ok {
+			return p, true
+		}
+	}
+	p, ok := r.policies["*"]
+	return p, ok
+}
+
+// policyFor returns the policy of the request destination, if any.
+func (c *Client) policyFor(req *Request) *Policy {
+	if c.Policies == nil || req.URL == nil {
+		return nil
+	}
+	p, _ := c.Policies.Lookup(req.URL.Hostname())
+	return p
+}
+
+// retrySettings returns the retry settings of the client overridden by p.
+func (c *Client) retrySettings(p *Policy) (waitMin, waitMax time.Duration, retryMax int) {
+	waitMin, waitMax, retryMax = c.RetryWaitMin, c.RetryWaitMax, c.RetryMax
+	if p == nil {
+		return
+	}
+	if p.RetryWaitMin > 0 {
+		waitMin = p.RetryWaitMin
+	}
+	if p.RetryWaitMax > 0 {
+		waitMax = p.RetryWaitMax
+	}
+	if p.RetryMax > 0 {
+		retryMax = p.RetryMax
+	}
+	if p.NoRetry {
+		retryMax = 0
+	}
+	return
+}
+
+// httpClientFor returns the http.Client to send req with.
+// Clients derived from HTTPClient are cached per policy and settings of the
+// Client they are built from, so that changing these settings, or
+// registering a policy again, derives new clients. The stale ones are
+// dropped, and their idle connections closed, when a new one is cached.
+func (c *Client) httpClientFor(req *Request) *http.Client {
+	p := c.policyFor(req)
+	if req.transport != nil {
+		hc := *c.HTTPClient
+		hc.Transport = req.transport
+		if p != nil && p.Timeout > 0 {
+			hc.Timeout = p.Timeout
+		}
+		if req.streamingResponse {
+			hc.Timeout = 0
+		}
+		return &hc
+	}
+	customTransport := c.ReresolveOnFailure || c.ExpectContinueTimeout > 0 || c.ResolveTimeout > 0 || len(c.HostAlias) > 0 || c.SessionCache != nil || c.ECH != nil || c.HTTPSRecords != nil || c.Throttle != nil || c.managesConns() || (p != nil && p.needsTransport()) || req.streamingResponse
+	if !customTransport && (p == nil || p.Timeout <= 0) {
+		return c.HTTPClient
+	}
+	key := httpClientKey{p, req.streamingResponse, c.transportConfig()}
+	if hc, ok := c.httpClients.Load(key); ok {
+		return hc.(*http.Client)
+	}
+	c.dropStaleHTTPClients(key.config)
+
+	hc := *c.HTTPClient
+	if p != nil && p.Timeout > 0 {
+		hc.Timeout = p.Timeout
+	}
+	if req.streamingResponse {
+		// The timeout of the client limits the whole exchange, body included.
+		hc.Timeout = 0
+	}
+	if customTransport {
+		if base, ok := hc.Transport.(*http.Transport); ok || hc.Transport == nil {
+			var t *http.Transport
+			if base != nil {
+				t = base.Clone()
+			} else {
+				t = defaultTransport()
+			}
+			if c.SessionCache != nil {
+				if t.TLSClientConfig == nil {
+					t.TLSClientConfig = &tls.Config{}
+				}
+				t.TLSClientConfig.ClientSessionCache = c.SessionCache
+			}
+			if p != nil && p.needsTransport() {
+				applyPolicyTransport(t, p)
+			}
+			if c.ExpectContinueTimeout > 0 {
+				t.ExpectContinueTimeout = c.ExpectContinueTimeout
+			}
+			if c.ResolveTimeout > 0 {
+				t.DialContext = resolveTimeoutDialContext(t.DialContext, nil, c.ResolveTimeout, 0)
+			}
+			if c.ReresolveOnFailure {
+				t.DialContext = reresolvingDialContext(t.DialContext)
+			}
+			if len(c.HostAlias) > 0 {
+				t.DialContext = hostAliasDialContext(t.DialContext, c.HostAlias)
+			}
+			if c.Throttle != nil {
+				t.DialContext = c.Throttle.throttledDialContext(t.DialContext)
+			}
+			if c.managesConns() {
+				t.DialContext = c.managedDialContext(t.DialContext)
+			}
+			if c.ECH != nil || c.HTTPSRecords != nil {
+				t.DialTLSContext = c.dialTLSContext(t)
+			}
+			if req.streamingResponse {
+				t.ResponseHeaderTimeout = 0
+				t.IdleConnTimeout = 0
+			}
+			hc.Transport = t
+		} else if c.Logger != nil {
+			c.Logger.Printf("WARNING transport %T is not an *http.Transport, the transport settings of the Client and its policies are ignored", hc.Transport)
+		}
+	}
+	actual, _ := c.httpClients.LoadOrStore(key, &hc)
+	return actual.(*http.Client)
+}
+
+// httpClientKey identifies the clients derived by httpClientFor.
+type httpClientKey struct {
+	policy            *Policy
+	streamingResponse bool
+	config            transportConfig
+}
+
+// transportConfig are the settings of the Client the clients derived by
+// httpClientFor are built from. Maps, funcs and interfaces are compared by
+// identity, so the map of HostAlias must be replaced, not modified, for
+// the change to be seen.
+type transportConfig struct {
+	httpClient            *http.Client
+	transport             uintptr
+	timeout               time.Duration
+	checkRedirect         uintptr
+	jar                   uintptr
+	reresolve             bool
+	expectContinueTimeout time.Duration
+	resolveTimeout        time.Duration
+	hostAlias             uintptr
+	sessionCache          *TLSSessionCache
+	ech                   *ECHOptions
+	httpsRecords          uintptr
+	throttle              *ThrottleOptions
+	managesConns          bool
+}
+
+func (c *Client) transportConfig() transportConfig {
+	return transportConfig{
+		httpClient:            c.HTTPClient,
+		transport:             identity(c.HTTPClient.Transport),
+		timeout:               c.HTTPClient.Timeout,
+		checkRedirect:         identity(c.HTTPClient.CheckRedirect),
+		jar:                   identity(c.HTTPClient.Jar),
+		reresolve:             c.ReresolveOnFailure,
+		expectContinueTimeout: c.ExpectContinueTimeout,
+		resolveTimeout:        c.ResolveTimeout,
+		hostAlias:             identity(c.HostAlias),
+		sessionCache:          c.SessionCache,
+		ech:                   c.ECH,
+		httpsRecords:          identity(c.HTTPSRecords),
+		throttle:              c.Throttle,
+		managesConns:          c.managesConns(),
+	}
+}
+
+// identity returns the address v refers to, zero for other values.
+func identity(v interface{}) uintptr {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Func, reflect.Map, reflect.Chan, reflect.Slice, reflect.UnsafePointer:
+		return rv.Pointer()
+	}
+	return 0
+}
+
+// dropStaleHTTPClients drops the derived clients built from other settings
+// than config, or for policies no longer registered.
+func (c *Client) dropStaleHTTPClients(config transportConfig) {
+	c.httpClients.Range(func(k, hc interface{}) bool {
+		key := k.(httpClientKey)
+		if key.config != config || (key.policy != nil && (c.Policies == nil || !c.Policies.registered(key.policy))) {
+			c.httpClients.Delete(k)
+			hc.(*http.Client).CloseIdleConnections()
+		}
+		return true
+	})
+}
+
+func applyPolicyTransport(t *http.Transport, p *Policy) {
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	if p.TLSMinVersion != 0 {
+		t.TLSClientConfig.MinVersion = p.TLSMinVersion
+	}
+	if p.Protocols != nil {
+		t.TLSClientConfig.NextProtos = p.Protocols
+		t.ForceAttemptHTTP2 = false
+		h2 := false
+		for _, proto := range p.Protocols {
+			if proto == "h2" {
+				h2 = true
+			}
+		}
+		if h2 {
+			t.ForceAttemptHTTP2 = true
+		} else {
+			// A non-nil empty map disables the automatic HTTP/2 upgrade.
+			t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		}
+	}
+	if p.RequireProtocol && p.Protocols != nil {
+		RequireProtocol(t.TLSClientConfig, p.Protocols...)
+	}
+	if p.DisableResumption {
+		t.TLSClientConfig.ClientSessionCache = nil
+		t.TLSClientConfig.SessionTicketsDisabled = true
+	}
+	if p.InsecureSkipVerify {
+		t.TLSClientConfig.InsecureSkipVerify = true
+	}
+	if p.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = p.ResponseHeaderTimeout
+	}
+}
@@ -0,0 +1,78 @@
+package ubernet
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientForFollowsSettings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.Logger = nil
+	c.Policies = NewPolicyRegistry()
+	send := func() *http.Client {
+		req, err := NewRequest("GET", srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return c.httpClientFor(req)
+	}
+	entries := func() int {
+		n := 0
+		c.httpClients.Range(func(_, _ interface{}) bool {
+			n++
+			return true
+		})
+		return n
+	}
+
+	c.Policies.Register("*", Policy{Timeout: time.Second})
+	first := send()
+	if first.Timeout != time.Second {
+		t.Fatalf("Timeout = %s, want 1s", first.Timeout)
+	}
+
+	c.Policies.Register("*", Policy{Timeout: 2 * time.Second})
+	if hc := send(); hc.Timeout != 2*time.Second {
+		t.Fatalf("Timeout = %s after registering the policy again, want 2s", hc.Timeout)
+	}
+	if n := entries(); n != 1 {
+		t.Fatalf("%d cached clients, want 1", n)
+	}
+
+	c.ResolveTimeout = time.Second
+	if hc := send(); hc == first || hc.Transport == first.Transport {
+		t.Fatal("the client was not derived again once ResolveTimeout changed")
+	}
+	if n := entries(); n != 1 {
+		t.Fatalf("%d cached clients, want 1", n)
+	}
+}
+
+func TestHTTPClientForLogsUnsupportedTransport(t *testing.T) {
+	var logs bytes.Buffer
+	c := NewClient()
+	c.Logger = log.New(&logs, "", 0)
+	c.HTTPClient = &http.Client{Transport: transportFunc(http.DefaultTransport.RoundTrip)}
+	c.ResolveTimeout = time.Second
+	req, err := NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.httpClientFor(req)
+	if !strings.Contains(logs.String(), "not an *http.Transport") {
+		t.Fatalf("no warning logged: %q", logs.String())
+	}
+}
@@ -0,0 +1,119 @@
+package ubernet
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// poller waits for the connect results of non-blocking sockets.
+type poller interface {
+	register(fd int) error
+	deregister(fd int)
+	wait(timeout time.Duration) ([]event, error)
+	close() error
+}
+
+// PollerBackend selects the system call used by a Checker to wait for
+// connect results.
+type PollerBackend int
+
+// Available poller backends.
+const (
+	// PollerEpoll uses edge-triggered epoll, the default.
+	PollerEpoll PollerBackend = iota
+	// PollerPoll uses poll, which scans every pending socket on each wait,
+	// for kernels or sandboxes where epoll is not available.
+	PollerPoll
+)
+
+func newPoller(backend PollerBackend) (poller, error) {
+	if backend == PollerPoll {
+		return newPollPoller()
+	}
+	return newEpollPoller()
+}
+
+// pollPoller waits for connect results with poll. Registering a socket
+// wakes the pending wait up through an eventfd, so that it is polled too.
+type pollPoller struct {
+	mu     sync.Mutex
+	fds    map[int]struct{}
+	wakeFd int
+}
+
+func newPollPoller() (*pollPoller, error) {
+	wakeFd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("eventfd", err)
+	}
+	return &pollPoller{fds: make(map[int]struct{}), wakeFd: wakeFd}, nil
+}
+
+func (p *pollPoller) register(fd int) error {
+	p.mu.Lock()
+	p.fds[fd] = struct{}{}
+	p.mu.Unlock()
+
+	var one [8]byte
+	binary.LittleEndian.PutUint64(one[:], 1)
+	if _, err := unix.Write(p.wakeFd, one[:]); err != nil && err != unix.EAGAIN {
+		return os.NewSyscallError("write", err)
+	}
+	return nil
+}
+
+func (p *pollPoller) deregister(fd int) {
+	p.mu.Lock()
+	delete(p.fds, fd)
+	p.mu.Unlock()
+}
+
+func (p *pollPoller) wait(timeout time.Duration) ([]event, error) {
+	p.mu.Lock()
+	fds := make([]unix.PollFd, 0, len(p.fds)+1)
+	fds = append(fds, unix.PollFd{Fd: int32(p.wakeFd), Events: unix.POLLIN})
+	for fd := range p.fds {
+		fds = append(fds, unix.PollFd{Fd: int32(fd), Events: unix.POLLOUT | unix.POLLIN})
+	}
+	p.mu.Unlock()
+
+	n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+	if err != nil {
+		if err == unix.EINTR {
+			return nil, nil
+		}
+		return nil, os.NewSyscallError("poll", err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	if fds[0].Revents != 0 {
+		var buf [8]byte
+		unix.Read(p.wakeFd, buf[:])
+	}
+	events := make([]event, 0, n)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pfd := range fds[1:] {
+		fd := int(pfd.Fd)
+		if pfd.Revents == 0 {
+			continue
+		}
+		// Skip sockets deregistered meanwhile, their fd may be reused.
+		if _, ok := p.fds[fd]; !ok {
+			continue
+		}
+		delete(p.fds, fd)
+		events = append(events, socketEvent(fd))
+	}
+	return events, nil
+}
+
+func (p *pollPoller) close() error {
+	return unix.Close(p.wakeFd)
+}
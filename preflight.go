@@ -0,0 +1,137 @@
+package ubernet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPreflightTimeout     = time.Second
+	defaultPreflightNegativeTTL = 5 * time.Second
+	defaultPreflightCacheSize   = 1024
+)
+
+// PreflightOptions configure Checker.PreflightDialContext.
+type PreflightOptions struct {
+	// Timeout limits the check, 1s by default.
+	Timeout time.Duration
+	// NegativeTTL is how long a failed check is remembered, failing the
+	// dials to the address right away, 5s by default.
+	NegativeTTL time.Duration
+	// CacheSize bounds the failed checks remembered, 1024 by default.
+	CacheSize int
+}
+
+// preflightCache remembers the failed checks.
+type preflightCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]preflightEntry
+}
+
+type preflightEntry struct {
+	err   error
+	until time.Time
+}
+
+func (pc *preflightCache) get(addr string, now time.Time) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	e, ok := pc.entries[addr]
+	if !ok {
+		return nil
+	}
+	if now.After(e.until) {
+		delete(pc.entries, addr)
+		return nil
+	}
+	return e.err
+}
+
+func (pc *preflightCache) put(addr string, err error, until time.Time) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if len(pc.entries) >= pc.size {
+		now := time.Now()
+		for a, e := range pc.entries {
+			if now.After(e.until) {
+				delete(pc.entries, a)
+			}
+		}
+		// Still full, make room for the newest failure.
+		for a := range pc.entries {
+			if len(pc.entries) < pc.size {
+				break
+			}
+			delete(pc.entries, a)
+		}
+	}
+	pc.entries[addr] = preflightEntry{err, until}
+}
+
+// PreflightDialContext returns dial preceded by a check of the address by
+// c, so that dials to closed ports or dead hosts fail fast rather than
+// after the whole connect and TLS timeouts. Failed checks are remembered
+// for NegativeTTL. Only TCP over IPv4 is checked, and dials go on unchecked
+// when c is not started.
+func (c *Checker) PreflightDialContext(dial func(ctx context.Context, network, address string) (net.Conn, error), opts PreflightOptions) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultPreflightTimeout
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = defaultPreflightNegativeTTL
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = defaultPreflightCacheSize
+	}
+	cache := &preflightCache{size: opts.CacheSize, entries: make(map[string]preflightEntry)}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if network != "tcp" && network != "tcp4" {
+			return dial(ctx, network, address)
+		}
+		target, ok := preflightTarget(ctx, address)
+		if !ok {
+			return dial(ctx, network, address)
+		}
+		if err := cache.get(target, time.Now()); err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &ErrPreflight{Addr: target, Cached: true, Err: err}}
+		}
+
+		timeout := opts.Timeout
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+			timeout = time.Until(deadline)
+		}
+		err := c.CheckAddr(target, timeout)
+		switch {
+		case err == nil, errors.Is(err, ErrCheckerNotStarted):
+		default:
+			cache.put(target, err, time.Now().Add(opts.NegativeTTL))
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &ErrPreflight{Addr: target, Err: err}}
+		}
+		return dial(ctx, network, address)
+	}
+}
+
+// preflightTarget returns the IPv4 address the Checker can check for
+// address, resolving its host name, ok being false if it has none.
+func preflightTarget(ctx context.Context, address string) (string, bool) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return address, ip.To4() != nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		return "", false
+	}
+	return net.JoinHostPort(ips[0].String(), port), true
+}
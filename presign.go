@@ -0,0 +1,176 @@
+package ubernet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	sigV4TimeFmt   = "20060102T150405Z"
+	// presignMargin is the validity a presigned URL must have left to be sent.
+	presignMargin = 5 * time.Second
+)
+
+// Presigner presigns URLs with AWS Signature Version 4 query parameters,
+// as used by S3 and compatible object stores.
+type Presigner struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	// Service defaults to "s3".
+	Service string
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Presign returns rawURL signed for method, valid for expires.
+func (p *Presigner) Presign(method, rawURL string, expires time.Duration) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return p.presign(method, u, expires).String(), nil
+}
+
+func (p *Presigner) presign(method string, u *url.URL, expires time.Duration) *url.URL {
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+	service := p.Service
+	if service == "" {
+		service = "s3"
+	}
+	t := now().UTC()
+	amzDate := t.Format(sigV4TimeFmt)
+	date := amzDate[:8]
+	scope := strings.Join([]string{date, p.Region, service, "aws4_request"}, "/")
+
+	signed := *u
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", p.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if p.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+	query.Del("X-Amz-Signature")
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		awsURIEncode(path, false),
+		awsCanonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, hex.EncodeToString(hashed[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+p.SecretAccessKey), date)
+	for _, part := range []string{p.Region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	signed.RawPath = awsURIEncode(path, false)
+	signed.RawQuery = awsCanonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return &signed
+}
+
+// NewRequest returns a request to the presigned rawURL, presigned again
+// before any attempt happening when less than a few seconds of validity
+// are left, e.g. a retry after a long backoff.
+func (p *Presigner) NewRequest(method, rawURL string, expires time.Duration, rawBody interface{}) (*Request, error) {
+	unsigned, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := NewRequest(method, rawURL, rawBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signed URL is kept along with its expiry, as Do restores the
+	// URL of the request once done. Clones share it.
+	var (
+		mu         sync.Mutex
+		signed     *url.URL
+		validUntil time.Time
+	)
+	req.prepare = func(r *Request) error {
+		now := time.Now()
+		if p.Now != nil {
+			now = p.Now()
+		}
+		mu.Lock()
+		if signed == nil || !now.Add(presignMargin).Before(validUntil) {
+			signed = p.presign(method, unsigned, expires)
+			validUntil = now.Add(expires)
+		}
+		u := *signed
+		mu.Unlock()
+		r.URL = &u
+		r.Host = ""
+		return nil
+	}
+	return req, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode encodes s as specified by SigV4, keeping slashes unless
+// encodeSlash is set.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '.', ch == '_', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
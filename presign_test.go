@@ -0,0 +1,53 @@
+package ubernet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPresignerRequestResent(t *testing.T) {
+	var signatures []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures = append(signatures, r.URL.Query().Get("X-Amz-Signature"))
+	}))
+	defer srv.Close()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	p := &Presigner{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Region:          "us-east-1",
+		Now:             func() time.Time { return now },
+	}
+	req, err := p.NewRequest("GET", srv.URL+"/bucket/key", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient()
+	c.Logger = nil
+	for _, elapsed := range []time.Duration{0, time.Second, 2 * time.Minute} {
+		now = now.Add(elapsed)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if len(signatures) != 3 {
+		t.Fatalf("%d requests, want 3", len(signatures))
+	}
+	for i, sig := range signatures {
+		if sig == "" {
+			t.Errorf("request #%d is not signed", i+1)
+		}
+	}
+	if signatures[0] != signatures[1] {
+		t.Errorf("request #2 was signed again while the URL was valid")
+	}
+	if signatures[1] == signatures[2] {
+		t.Errorf("request #3 was not signed again once the URL expired")
+	}
+}
@@ -0,0 +1,83 @@
+package ubernet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+var proxyProtoV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyHeader is a HAProxy PROXY protocol header, sent first on a
+// connection to tell the upstream the original source of the traffic.
+// See https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+type ProxyHeader struct {
+	// Version is 1 for the text format, 2 for the binary one.
+	Version int
+	// Source and Destination default to the local and remote addresses
+	// of the connection.
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// Send writes the header on conn.
+func (h *ProxyHeader) Send(conn net.Conn) error {
+	src, dst := h.Source, h.Destination
+	if src == nil {
+		src, _ = conn.LocalAddr().(*net.TCPAddr)
+	}
+	if dst == nil {
+		dst, _ = conn.RemoteAddr().(*net.TCPAddr)
+	}
+
+	var header []byte
+	switch h.Version {
+	case 1:
+		header = proxyHeaderV1(src, dst)
+	case 2:
+		header = proxyHeaderV2(src, dst)
+	default:
+		return fmt.Errorf("unsupported PROXY protocol version %d", h.Version)
+	}
+	_, err := conn.Write(header)
+	return err
+}
+
+func proxyHeaderV1(src, dst *net.TCPAddr) []byte {
+	if src == nil || dst == nil {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	proto := "TCP4"
+	if src.IP.To4() == nil || dst.IP.To4() == nil {
+		proto = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, src.IP, dst.IP, src.Port, dst.Port))
+}
+
+func proxyHeaderV2(src, dst *net.TCPAddr) []byte {
+	var b bytes.Buffer
+	b.Write(proxyProtoV2Signature)
+	if src == nil || dst == nil {
+		// LOCAL command, no address.
+		b.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return b.Bytes()
+	}
+
+	b.WriteByte(0x21) // version 2, PROXY command
+	src4, dst4 := src.IP.To4(), dst.IP.To4()
+	if src4 != nil && dst4 != nil {
+		b.WriteByte(0x11) // TCP over IPv4
+		binary.Write(&b, binary.BigEndian, uint16(12))
+		b.Write(src4)
+		b.Write(dst4)
+	} else {
+		b.WriteByte(0x21) // TCP over IPv6
+		binary.Write(&b, binary.BigEndian, uint16(36))
+		b.Write(src.IP.To16())
+		b.Write(dst.IP.To16())
+	}
+	binary.Write(&b, binary.BigEndian, uint16(src.Port))
+	binary.Write(&b, binary.BigEndian, uint16(dst.Port))
+	return b.Bytes()
+}
@@ -0,0 +1,194 @@
+package ubernet
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// EncodeQuery returns the query parameters of the fields of struct v, or of
+// the struct v points to. Fields are named by their `url` tag, the field
+// name by default, and skipped if the tag is "-". Tag options are:
+//
+//	omitempty  skip the field if it has its zero value
+//	comma      join slice elements with commas instead of repeating the name
+//	unix       encode times as Unix seconds
+//
+// Times are formatted with the layout of the `layout` tag, time.RFC3339 by
+// default. Values implementing encoding.TextMarshaler are encoded with it.
+// Embedded structs are flattened, and nil pointers omitted.
+func EncodeQuery(v interface{}) (url.Values, error) {
+	values := make(url.Values)
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return values, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query: expected a struct, got %T", v)
+	}
+	if err := encodeStruct(values, rv); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// SetQuery sets the query parameters encoded from v by EncodeQuery on the
+// URL of r, replacing the parameters of the same name.
+func (r *Request) SetQuery(v interface{}) error {
+	values, err := EncodeQuery(v)
+	if err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	for name, vs := range values {
+		query[name] = vs
+	}
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
+
+func encodeStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("url")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		fv := rv.Field(i)
+		name, opts := parseQueryTag(tag)
+
+		if field.Anonymous && name == "" {
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+				if err := encodeStruct(values, fv); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if opts.has("omitempty") && fv.IsZero() {
+			continue
+		}
+		for fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Ptr {
+			continue
+		}
+
+		if (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array) && fv.Type().Elem().Kind() != reflect.Uint8 {
+			elems := make([]string, 0, fv.Len())
+			for j := 0; j < fv.Len(); j++ {
+				s, err := formatQueryValue(fv.Index(j), field.Tag, opts)
+				if err != nil {
+					return fmt.Errorf("query: field %s: %w", field.Name, err)
+				}
+				elems = append(elems, s)
+			}
+			if opts.has("comma") {
+				values.Set(name, strings.Join(elems, ","))
+			} else {
+				values[name] = append(values[name], elems...)
+			}
+			continue
+		}
+
+		s, err := formatQueryValue(fv, field.Tag, opts)
+		if err != nil {
+			return fmt.Errorf("query: field %s: %w", field.Name, err)
+		}
+		values.Add(name, s)
+	}
+	return nil
+}
+
+func formatQueryValue(v reflect.Value, tag reflect.StructTag, opts queryTagOptions) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Type() {
+	case timeType:
+		t := v.Interface().(time.Time)
+		if opts.has("unix") {
+			return strconv.FormatInt(t.Unix(), 10), nil
+		}
+		layout := tag.Get("layout")
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return t.Format(layout), nil
+	case durationType:
+		return v.Interface().(time.Duration).String(), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+type queryTagOptions []string
+
+func parseQueryTag(tag string) (string, queryTagOptions) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+func (opts queryTagOptions) has(name string) bool {
+	for _, opt := range opts {
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package ubernet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRangedConcurrency = 4
+	defaultRangedSegmentSize = 8 << 20
+)
+
+// RangedOptions configures Client.DownloadRanged.
+type RangedOptions struct {
+	// Concurrency is the number of segments downloaded at once, 4 by default.
+	Concurrency int
+	// SegmentSize is the size of a segment, 8 MiB by default.
+	SegmentSize int64
+}
+
+type segmentResult struct {
+	data []byte
+	err  error
+}
+
+// DownloadRanged downloads url to w, in parallel segments if the origin
+// supports range requests. Every segment is retried on its own, resuming
+// from where its body stopped, and the segments are written to w in order.
+// At most Concurrency segments are kept in memory.
+// Origins without range support are downloaded with a single request.
+// It returns the number of bytes written.
+func (c *Client) DownloadRanged(ctx context.Context, url string, w io.Writer, opts RangedOptions) (int64, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultRangedConcurrency
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultRangedSegmentSize
+	}
+
+	head, err := NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.Do(head.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	size := resp.ContentLength
+	if resp.StatusCode != http.StatusOK || size <= opts.SegmentSize || !strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return c.downloadWhole(ctx, url, w)
+	}
+	validator := resp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get("Last-Modified")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	count := int((size + opts.SegmentSize - 1) / opts.SegmentSize)
+	results := make([]chan segmentResult, count)
+	for i := range results {
+		results[i] = make(chan segmentResult, 1)
+	}
+	window := make(chan struct{}, opts.Concurrency)
+
+	go func() {
+		for i := 0; i < count; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			start := int64(i) * opts.SegmentSize
+			end := start + opts.SegmentSize - 1
+			if end >= size {
+				end = size - 1
+			}
+			go func(i int, start, end int64) {
+				data, err := c.downloadSegment(ctx, url, validator, start, end)
+				results[i] <- segmentResult{data, err}
+			}(i, start, end)
+		}
+	}()
+
+	var written int64
+	for i := 0; i < count; i++ {
+		var res segmentResult
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			return written, ctx.Err()
+		}
+		if res.err != nil {
+			return written, fmt.Errorf("segment %d: %w", i, res.err)
+		}
+		n, err := w.Write(res.data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		<-window
+	}
+	return written, nil
+}
+
+func (c *Client) downloadWhole(ctx context.Context, url string, w io.Writer) (int64, error) {
+	req, err := NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("GET %s: unexpected status %s", c.redactURL(req.URL), resp.Status)
+	}
+	return io.Copy(w, resp.Body)
+}
+
+// downloadSegment downloads the range start-end of url. Requests are
+// retried by Do, and when reading the body fails or ends early the rest of
+// the range is requested again, up to RetryMax times.
+func (c *Client) downloadSegment(ctx context.Context, url, validator string, start, end int64) ([]byte, error) {
+	data := bytes.NewBuffer(make([]byte, 0, end-start+1))
+	for attempt := 0; ; attempt++ {
+		offset := start + int64(data.Len())
+		resp, err := c.getRange(ctx, url, validator, offset, end)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.CopyN(data, resp.Body, end-offset+1)
+		resp.Body.Close()
+		if err == nil {
+			return data.Bytes(), nil
+		}
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("short range %d-%d: got %d bytes", offset, end, start+int64(data.Len())-offset)
+		}
+		if attempt >= c.RetryMax || ctx.Err() != nil {
+			return nil, err
+		}
+		wait := c.Backoff(c.RetryWaitMin, c.RetryWaitMax, attempt, nil)
+		if c.Logger != nil {
+			c.Logger.Printf("WARNING range %d-%d: %v, resuming at %d in %s", start, end, c.redactError(err), start+int64(data.Len()), wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// getRange requests the range start-end of url.
+func (c *Client) getRange(ctx context.Context, url, validator string, start, end int64) (*http.Response, error) {
+	req, err := NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if validator != "" {
+		// Fails with 200 instead of 206 if the object changed meanwhile.
+		req.Header.Set("If-Range", validator)
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s for range %d-%d", resp.Status, start, end)
+	}
+	// A range other than the one requested would corrupt the download.
+	var first, last int64
+	contentRange := resp.Header.Get("Content-Range")
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &first, &last); err != nil || first != start || last != end {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected Content-Range %q for range %d-%d", contentRange, start, end)
+	}
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package ubernet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadRangedResumesSegment(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 3))
+	var mu sync.Mutex
+	cut := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			t.Errorf("bad Range %q", r.Header.Get("Range"))
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+
+		mu.Lock()
+		fail := start == 10 && !cut
+		cut = cut || fail
+		mu.Unlock()
+		if fail {
+			// Sends the head of the middle segment only.
+			w.Write(content[start : start+4])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(content[start : end+1])
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.Logger = nil
+	c.RetryWaitMin = time.Millisecond
+	c.RetryWaitMax = time.Millisecond
+	var got bytes.Buffer
+	n, err := c.DownloadRanged(context.Background(), srv.URL, &got, RangedOptions{SegmentSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)) || !bytes.Equal(got.Bytes(), content) {
+		t.Fatalf("downloaded %d bytes %q, want %q", n, got.Bytes(), content)
+	}
+	if !cut {
+		t.Fatal("the middle segment was not cut")
+	}
+}
+
+func TestDownloadRangedChecksContentRange(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 3))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			return
+		}
+		// Always sends the first segment, whatever the range asked.
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-9/%d", len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[:10])
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.Logger = nil
+	var got bytes.Buffer
+	if _, err := c.DownloadRanged(context.Background(), srv.URL, &got, RangedOptions{SegmentSize: 10}); err == nil || !strings.Contains(err.Error(), "Content-Range") {
+		t.Fatalf("DownloadRanged error = %v, want a Content-Range mismatch", err)
+	}
+	if got.Len() > 10 {
+		t.Fatalf("wrote %d bytes of wrong ranges", got.Len())
+	}
+}
@@ -0,0 +1,76 @@
+package ubernet
+
+import (
+	"context"
+	"sync"
+)
+
+// RateLimiter paces the attempts of a Client, Wait blocking until the next
+// one may be sent or ctx is done. The *rate.Limiter of
+// golang.org/x/time/rate satisfies it as is, as does Throttle.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// RateLimiterFunc adapts a function to RateLimiter.
+type RateLimiterFunc func(ctx context.Context) error
+
+// Wait calls f(ctx).
+func (f RateLimiterFunc) Wait(ctx context.Context) error { return f(ctx) }
+
+// Wait takes a single token, so that a Throttle created with
+// NewThrottle(qps, burst) limits the attempts per second.
+func (t *Throttle) Wait(ctx context.Context) error {
+	return t.WaitN(ctx, 1)
+}
+
+// HostRateLimiter gives every host its own RateLimiter, created by New on
+// first use, e.g. to enforce per-host QPS limits:
+//
+//	client.HostRateLimiter = ubernet.NewHostRateLimiter(func(host string) ubernet.RateLimiter {
+//		return rate.NewLimiter(10, 1)
+//	})
+type HostRateLimiter struct {
+	// New returns the RateLimiter of host, nil for no limit.
+	New func(host string) RateLimiter
+
+	hosts sync.Map
+}
+
+// NewHostRateLimiter returns a HostRateLimiter creating the limiters with newLimiter.
+func NewHostRateLimiter(newLimiter func(host string) RateLimiter) *HostRateLimiter {
+	return &HostRateLimiter{New: newLimiter}
+}
+
+// Limiter returns the RateLimiter of host, nil if it has none.
+func (h *HostRateLimiter) Limiter(host string) RateLimiter {
+	if l, ok := h.hosts.Load(host); ok {
+		return l.(hostLimiter).RateLimiter
+	}
+	var l RateLimiter
+	if h.New != nil {
+		l = h.New(host)
+	}
+	actual, _ := h.hosts.LoadOrStore(host, hostLimiter{l})
+	return actual.(hostLimiter).RateLimiter
+}
+
+// hostLimiter lets sync.Map hold nil limiters.
+type hostLimiter struct {
+	RateLimiter
+}
+
+// waitRateLimit waits for the rate limiters of c to let an attempt of req go.
+func (c *Client) waitRateLimit(req *Request) error {
+	if c.RateLimiter != nil {
+		if err := c.RateLimiter.Wait(req.Context()); err != nil {
+			return err
+		}
+	}
+	if c.HostRateLimiter != nil && req.URL != nil {
+		if l := c.HostRateLimiter.Limiter(req.URL.Host); l != nil {
+			return l.Wait(req.Context())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package ubernet
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultRedactHeaders lists the headers whose values are hidden from logs,
+// hooks and errors unless Client.RedactHeaders is set.
+// Any header or query parameter named like an api key is redacted as well.
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Auth-Token",
+}
+
+const redacted = "[REDACTED]"
+
+// Redactor returns the value to expose instead of the sensitive value of
+// header or query parameter name.
+type Redactor func(name, value string) string
+
+func (c *Client) shouldRedact(name string) bool {
+	list := c.RedactHeaders
+	if list == nil {
+		list = DefaultRedactHeaders
+	}
+	for _, h := range list {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	normalized := strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+	return strings.Contains(normalized, "apikey")
+}
+
+func (c *Client) redactValue(name, value string) string {
+	if c.Redactor != nil {
+		return c.Redactor(name, value)
+	}
+	return redacted
+}
+
+// redactHeader returns a copy of h with sensitive values redacted.
+func (c *Client) redactHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		if !c.shouldRedact(name) {
+			out[name] = values
+			continue
+		}
+		rv := make([]string, len(values))
+		for i, v := range values {
+			rv[i] = c.redactValue(name, v)
+		}
+		out[name] = rv
+	}
+	return out
+}
+
+// redactURL returns u as a string without password and sensitive query parameters.
+func (c *Client) redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	ru := *u
+	if query := u.Query(); len(query) > 0 {
+		changed := false
+		for name, values := range query {
+			if !c.shouldRedact(name) {
+				continue
+			}
+			for i, v := range values {
+				values[i] = c.redactValue(name, v)
+			}
+			changed = true
+		}
+		if changed {
+			ru.RawQuery = query.Encode()
+		}
+	}
+	return ru.Redacted()
+}
+
+// redactRequest returns a shallow copy of req safe to hand to log hooks.
+func (c *Client) redactRequest(req *http.Request) *http.Request {
+	r := *req
+	r.Header = c.redactHeader(req.Header)
+	if req.URL != nil {
+		u, err := url.Parse(c.redactURL(req.URL))
+		if err == nil {
+			r.URL = u
+		}
+	}
+	return &r
+}
+
+// redactResponse returns a shallow copy of resp safe to hand to log hooks.
+// The body is shared with resp.
+func (c *Client) redactResponse(resp *http.Response) *http.Response {
+	r := *resp
+	r.Header = c.redactHeader(resp.Header)
+	if resp.Request != nil {
+		r.Request = c.redactRequest(resp.Request)
+	}
+	return &r
+}
+
+// redactError hides sensitive parts of the URL embedded in a *url.Error.
+func (c *Client) redactError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		u, perr := url.Parse(ue.URL)
+		if perr != nil {
+			return err
+		}
+		return &url.Error{Op: ue.Op, URL: c.redactURL(u), Err: ue.Err}
+	}
+	return err
+}
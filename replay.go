@@ -0,0 +1,235 @@
+package ubernet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ReplayVersion is the version of the replay file format: JSON lines, one
+// ReplayRecord per line.
+const ReplayVersion = 1
+
+// ReplayRecord is a request saved to be replayed later, or recorded with
+// the shape of its Response by ContractMiddleware.
+type ReplayRecord struct {
+	Version int         `json:"v"`
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Header  http.Header `json:"header,omitempty"`
+	// Body is base64 encoded in JSON.
+	Body  []byte `json:"body,omitempty"`
+	Label string `json:"label,omitempty"`
+
+	FailedAt time.Time `json:"failed_at"`
+	Attempts int       `json:"attempts,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	// Metadata is free for the callers, e.g. to tell the incident.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	Response *ResponseShape `json:"response,omitempty"`
+}
+
+// NewReplayRecord returns the ReplayRecord of req, which failed with err.
+// Streamed bodies, which can not be read again, make it fail.
+func NewReplayRecord(req *Request, err error) (*ReplayRecord, error) {
+	if req.streamed {
+		return nil, ErrBodyNotReplayable
+	}
+	body, bodyErr := req.BodyBytes()
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+	rec := &ReplayRecord{
+		Version:  ReplayVersion,
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Header:   req.Header.Clone(),
+		Body:     body,
+		Label:    req.label,
+		FailedAt: time.Now(),
+		Attempts: req.lastAttempt.Attempts,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	return rec, nil
+}
+
+// Request returns the Request to replay rec.
+func (rec *ReplayRecord) Request(ctx context.Context) (*Request, error) {
+	var body interface{}
+	if rec.Body != nil {
+		body = rec.Body
+	}
+	req, err := NewRequest(rec.Method, rec.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range rec.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	req.label = rec.Label
+	return req.WithContext(ctx), nil
+}
+
+// ReplayWriter writes ReplayRecords in the replay file format. It is safe
+// for concurrent use.
+type ReplayWriter struct {
+	// KeepCredentials keeps the headers redacted from logs, which are
+	// dropped by default: the Client replaying the records has to
+	// authenticate them again, e.g. with its Auth.
+	KeepCredentials bool
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewReplayWriter returns a ReplayWriter writing to w.
+func NewReplayWriter(w io.Writer) *ReplayWriter {
+	return &ReplayWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes rec.
+func (w *ReplayWriter) Write(rec *ReplayRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(rec)
+}
+
+// logReplay writes the failed req to ReplayLog.
+func (c *Client) logReplay(req *Request, err error) {
+	rec, recErr := NewReplayRecord(req, err)
+	if recErr == nil {
+		if !c.ReplayLog.KeepCredentials {
+			for name := range rec.Header {
+				if c.shouldRedact(name) {
+					delete(rec.Header, name)
+				}
+			}
+		}
+		recErr = c.ReplayLog.Write(rec)
+	}
+	if recErr != nil && c.Logger != nil {
+		c.Logger.Printf("ERROR %s can not be saved for replay: %v", c.describe(req), recErr)
+	}
+}
+
+// ReplayReader reads ReplayRecords in the replay file format.
+type ReplayReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// maxReplayLine bounds the size of a record, body included.
+const maxReplayLine = 64 << 20
+
+// NewReplayReader returns a ReplayReader reading from r.
+func NewReplayReader(r io.Reader) *ReplayReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxReplayLine)
+	return &ReplayReader{scanner: scanner}
+}
+
+// Next returns the next record, io.EOF at the end of the file.
+func (r *ReplayReader) Next() (*ReplayRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		if len(r.scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec ReplayRecord
+		if err := json.Unmarshal(r.scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("replay record at line %d: %w", r.line, err)
+		}
+		if rec.Version > ReplayVersion {
+			return nil, fmt.Errorf("replay record at line %d: unsupported version %d", r.line, rec.Version)
+		}
+		return &rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Replayer sends the requests of replay files again through a Client.
+type Replayer struct {
+	Client *Client
+	// Failed, if set, receives the records failing again, to be replayed
+	// in a later pass.
+	Failed *ReplayWriter
+	// OnResult, if set, is called with the outcome of every record. The
+	// body of resp is closed once it returns.
+	OnResult func(rec *ReplayRecord, resp *http.Response, err error)
+}
+
+// ReplayReport sums up a replay.
+type ReplayReport struct {
+	Replayed  int
+	Succeeded int
+	Failed    int
+}
+
+// Replay replays the records read from r in order, until the end of the
+// file or ctx is done. Requests failing again do not stop the replay.
+func (rp *Replayer) Replay(ctx context.Context, r io.Reader) (ReplayReport, error) {
+	var report ReplayReport
+	client := rp.Client
+	if client == nil {
+		client = defaultClient
+	}
+	records := NewReplayReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		rec, err := records.Next()
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Replayed++
+		resp, err := rp.replay(ctx, client, rec)
+		if rp.OnResult != nil {
+			rp.OnResult(rec, resp, err)
+		}
+		if resp != nil {
+			client.drainBody(resp.Body)
+		}
+		if err != nil {
+			report.Failed++
+			if rp.Failed != nil {
+				again := *rec
+				again.FailedAt = time.Now()
+				again.Error = err.Error()
+				if err := rp.Failed.Write(&again); err != nil {
+					return report, err
+				}
+			}
+			continue
+		}
+		report.Succeeded++
+	}
+}
+
+func (rp *Replayer) replay(ctx context.Context, client *Client, rec *ReplayRecord) (*http.Response, error) {
+	req, err := rec.Request(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err == nil && resp.StatusCode >= 500 {
+		err = fmt.Errorf("status %s", resp.Status)
+	}
+	return resp, err
+}
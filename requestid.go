@@ -0,0 +1,80 @@
+package ubernet
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+)
+
+// RequestIDOptions configures the request IDs of a Client.
+type RequestIDOptions struct {
+	// Header carries the ID, "X-Request-ID" by default.
+	Header string
+	// AttemptHeader carries the 1-based number of the attempt, sent along
+	// the ID, "X-Request-Attempt" by default.
+	AttemptHeader string
+	// Generate returns a new ID, a random UUID by default.
+	Generate func() string
+}
+
+func (opts *RequestIDOptions) header() string {
+	if opts.Header != "" {
+		return opts.Header
+	}
+	return "X-Request-ID"
+}
+
+func (opts *RequestIDOptions) attemptHeader() string {
+	if opts.AttemptHeader != "" {
+		return opts.AttemptHeader
+	}
+	return "X-Request-Attempt"
+}
+
+// NewRequestID returns a random (version 4) UUID.
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// RequestID returns the ID of r, set by a Client with RequestID options,
+// empty until then.
+func (r *Request) RequestID() string {
+	return r.id
+}
+
+// assignRequestID sets the ID of req, keeping the one it already carries,
+// e.g. taken from an inbound request by FromRequest, and generating one
+// otherwise. All its attempts carry the same ID.
+func (c *Client) assignRequestID(req *Request) {
+	header := c.RequestID.header()
+	if id := req.Header.Get(header); id != "" {
+		req.id = id
+		return
+	}
+	if c.RequestID.Generate != nil {
+		req.id = c.RequestID.Generate()
+	} else {
+		req.id = NewRequestID()
+	}
+	req.Header.Set(header, req.id)
+}
+
+// setAttemptHeader numbers the attempt of req.
+func (c *Client) setAttemptHeader(req *Request, attempt int) {
+	req.Header.Set(c.RequestID.attemptHeader(), strconv.Itoa(attempt))
+}
+
+// describe returns the method and redacted URL of req for logs, followed
+// by its ID if it has one.
+func (c *Client) describe(req *Request) string {
+	if req.id != "" {
+		return req.Method + " " + c.redactURL(req.URL) + " [" + req.id + "]"
+	}
+	return req.Method + " " + c.redactURL(req.URL)
+}
@@ -0,0 +1,162 @@
+package ubernet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"syscall"
+)
+
+type reresolveKey struct{}
+
+// reresolveState tracks the addresses which failed during a Client.Do call.
+// Once active, dialing bypasses the transport and OS caches by resolving
+// the host again, and tries the addresses which did not fail first.
+type reresolveState struct {
+	mu       sync.Mutex
+	enabled  bool
+	lastAddr string
+	failed   map[string]bool
+}
+
+func (s *reresolveState) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				s.fail(addr)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.lastAddr = info.Conn.RemoteAddr().String()
+		},
+	}
+}
+
+func (s *reresolveState) fail(addr string) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed == nil {
+		s.failed = make(map[string]bool)
+	}
+	s.failed[host] = true
+}
+
+// activate marks the last used address as failed and makes the next
+// dial resolve the host again.
+func (s *reresolveState) activate() {
+	s.mu.Lock()
+	last := s.lastAddr
+	s.enabled = true
+	s.mu.Unlock()
+	if last != "" {
+		s.fail(last)
+	}
+}
+
+func (s *reresolveState) active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enabled
+}
+
+// order returns ips with the failed ones moved to the end.
+func (s *reresolveState) order(ips []net.IPAddr) []net.IPAddr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ordered := make([]net.IPAddr, 0, len(ips))
+	var failed []net.IPAddr
+	for _, ip := range ips {
+		if s.failed[ip.IP.String()] {
+			failed = append(failed, ip)
+		} else {
+			ordered = append(ordered, ip)
+		}
+	}
+	return append(ordered, failed...)
+}
+
+// withReresolve attaches a reresolveState to the context of req.
+func withReresolve(req *Request) *reresolveState {
+	state := &reresolveState{}
+	ctx := context.WithValue(req.Context(), reresolveKey{}, state)
+	req.Request = req.Request.WithContext(httptrace.WithClientTrace(ctx, state.clientTrace()))
+	return state
+}
+
+type dialContextFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// freshResolver uses the pure Go resolver, which keeps no cache.
+var freshResolver = &net.Resolver{PreferGo: true}
+
+func reresolvingDialContext(dial dialContextFunc) dialContextFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		state, _ := ctx.Value(reresolveKey{}).(*reresolveState)
+		if state == nil || !state.active() {
+			return dial(ctx, network, address)
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+
+		ips, err := freshResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var firstErr error
+		for _, ip := range state.order(ips) {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			state.fail(ip.IP.String())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr == nil {
+			firstErr = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return nil, firstErr
+	}
+}
+
+// isConnectionError reports whether err happened at the connection level,
+// before a response could be read.
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) ||
+		errors.As(err, &dnsErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// prepareReresolve makes the next attempt resolve the destination again
+// after a connection level failure.
+func (c *Client) prepareReresolve(state *reresolveState, req *Request, err error) {
+	if state == nil || err == nil || !isConnectionError(err) {
+		return
+	}
+	state.activate()
+	// Make sure the next attempt dials instead of picking a pooled
+	// connection to the host, keeping those to the other hosts.
+	host := req.URL.Hostname()
+	c.conns.Range(func(key, _ interface{}) bool {
+		if mc := key.(*managedConn); mc.host == host {
+			mc.reject(ErrStaleConn)
+		}
+		return true
+	})
+}
@@ -0,0 +1,40 @@
+package ubernet
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestPrepareReresolveKeepsOtherHosts(t *testing.T) {
+	c := NewClient()
+	c.ReresolveOnFailure = true
+	dial := c.managedDialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, peer := net.Pipe()
+		peer.Close()
+		return conn, nil
+	})
+	failing, err := dial(context.Background(), "tcp", "failing.example:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthy, err := dial(context.Background(), "tcp", "healthy.example:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := NewRequest("GET", "http://failing.example/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connErr := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	c.prepareReresolve(withReresolve(req), req, connErr)
+
+	if failing.(*managedConn).rejectErr != ErrStaleConn {
+		t.Fatal("connection to the failing host not rejected")
+	}
+	if healthy.(*managedConn).rejectErr != nil {
+		t.Fatal("connection to another host rejected")
+	}
+}
@@ -0,0 +1,181 @@
+package ubernet
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// resolveWithTimeout resolves host with r, keeping the addresses of the
+// family of network, and fails with ErrResolveTimeout if it takes longer
+// than a positive timeout.
+func resolveWithTimeout(ctx context.Context, r HostResolver, network, host string, timeout time.Duration) ([]net.IP, error) {
+	lookupCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		lookupCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	addrs, err := r.LookupIPAddr(lookupCtx, host)
+	if err != nil {
+		if timeout > 0 && lookupCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return nil, &ErrResolveTimeout{Host: host, After: timeout}
+		}
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		switch is4 := addr.IP.To4() != nil; {
+		case ipNetwork(network) == "ip4" && !is4, ipNetwork(network) == "ip6" && is4:
+			continue
+		}
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// ipNetwork returns the network to resolve addresses of a dial network.
+func ipNetwork(network string) string {
+	switch network {
+	case "tcp4", "udp4":
+		return "ip4"
+	case "tcp6", "udp6":
+		return "ip6"
+	}
+	return "ip"
+}
+
+// defaultFallbackDelay is the delay before racing the fallback address
+// family, as in net.Dialer.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// resolveTimeoutDialContext resolves host names with r in no longer than a
+// positive timeout, then dials their addresses with dial. Like net.Dialer,
+// the addresses of the other family than the first one are raced after
+// fallbackDelay, 300ms if zero, unless it is negative; the addresses of a
+// family are dialed in turn.
+func resolveTimeoutDialContext(dial dialContextFunc, r HostResolver, timeout, fallbackDelay time.Duration) dialContextFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	if fallbackDelay == 0 {
+		fallbackDelay = defaultFallbackDelay
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+		ips, err := resolveWithTimeout(ctx, r, network, host, timeout)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		if len(ips) == 0 {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}}
+		}
+		primaries, fallbacks := splitFamilies(ips)
+		if fallbackDelay < 0 || len(fallbacks) == 0 {
+			return dialSerial(ctx, dial, network, port, ips)
+		}
+		return dialParallel(ctx, dial, network, port, primaries, fallbacks, fallbackDelay)
+	}
+}
+
+// splitFamilies splits ips into the addresses of the family of the first
+// one and the others.
+func splitFamilies(ips []net.IP) (primaries, fallbacks []net.IP) {
+	first := ips[0].To4() != nil
+	for _, ip := range ips {
+		if (ip.To4() != nil) == first {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	return primaries, fallbacks
+}
+
+// dialSerial dials ips in turn, returning the first connection established.
+func dialSerial(ctx context.Context, dial dialContextFunc, network, port string, ips []net.IP) (net.Conn, error) {
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
+
+// dialParallel races dialing primaries and, after delay or once they
+// failed, fallbacks, returning the first connection established. The error
+// of the primaries is returned if both fail.
+func dialParallel(ctx context.Context, dial dialContextFunc, network, port string, primaries, fallbacks []net.IP, delay time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan dialResult)
+	race := func(ips []net.IP, primary bool) {
+		conn, err := dialSerial(ctx, dial, network, port, ips)
+		results <- dialResult{conn, err, primary}
+	}
+	go race(primaries, true)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	pending, fallbackStarted := 1, false
+	startFallback := func() {
+		if !fallbackStarted {
+			fallbackStarted = true
+			pending++
+			go race(fallbacks, false)
+		}
+	}
+	var primaryErr, fallbackErr error
+	for {
+		select {
+		case <-timer.C:
+			startFallback()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if pending > 0 {
+					// The other racer is canceled, its connection is closed
+					// if it got one nevertheless.
+					go func() {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}()
+				}
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+			} else {
+				fallbackErr = res.err
+			}
+			startFallback()
+			if pending == 0 {
+				if primaryErr != nil {
+					return nil, primaryErr
+				}
+				return nil, fallbackErr
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ubernet
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticResolver []net.IPAddr
+
+func (r staticResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return r, nil
+}
+
+func TestResolveTimeoutDialContextRacesFamilies(t *testing.T) {
+	r := staticResolver{{IP: net.ParseIP("2001:db8::1")}, {IP: net.ParseIP("192.0.2.1")}}
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if strings.HasPrefix(address, "[") {
+			// The IPv6 route is black-holed.
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		conn, peer := net.Pipe()
+		peer.Close()
+		return conn, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	conn, err := resolveTimeoutDialContext(dial, r, time.Second, 10*time.Millisecond)(ctx, "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("connected after %s, the fallback was not raced", elapsed)
+	}
+
+	serialCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := resolveTimeoutDialContext(dial, r, time.Second, -1)(serialCtx, "tcp", "example.com:443"); err == nil {
+		t.Fatal("negative fallback delay raced the fallback")
+	}
+}
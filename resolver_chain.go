@@ -0,0 +1,239 @@
+package ubernet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HostResolver looks up the addresses of a host, as net.Resolver does.
+type HostResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+var _ HostResolver = (*net.Resolver)(nil)
+
+// ResolverChain tries its resolvers in order, skipping the ones which
+// failed FailureThreshold times in a row for Cooldown, unless all of them
+// are unhealthy. A host which does not exist is an answer, not a failure.
+type ResolverChain struct {
+	Resolvers []HostResolver
+
+	// FailureThreshold is 3 and Cooldown 30s by default.
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	mu     sync.Mutex
+	health []resolverHealth
+}
+
+type resolverHealth struct {
+	failures  int
+	downUntil time.Time
+	lastErr   error
+}
+
+// ResolverStatus is the health of a resolver of a ResolverChain.
+type ResolverStatus struct {
+	Healthy   bool
+	Failures  int
+	DownUntil time.Time
+	LastError error
+}
+
+// NewResolverChain returns a ResolverChain of resolvers, in order.
+func NewResolverChain(resolvers ...HostResolver) *ResolverChain {
+	return &ResolverChain{Resolvers: resolvers}
+}
+
+func (rc *ResolverChain) threshold() int {
+	if rc.FailureThreshold > 0 {
+		return rc.FailureThreshold
+	}
+	return 3
+}
+
+func (rc *ResolverChain) cooldown() time.Duration {
+	if rc.Cooldown > 0 {
+		return rc.Cooldown
+	}
+	return 30 * time.Second
+}
+
+// order returns the indexes of the healthy resolvers followed by the
+// unhealthy ones.
+func (rc *ResolverChain) order(now time.Time) []int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.health) != len(rc.Resolvers) {
+		rc.health = make([]resolverHealth, len(rc.Resolvers))
+	}
+	healthy := make([]int, 0, len(rc.Resolvers))
+	var down []int
+	for i, h := range rc.health {
+		if now.Before(h.downUntil) {
+			down = append(down, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (rc *ResolverChain) report(i int, err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if i >= len(rc.health) {
+		return
+	}
+	h := &rc.health[i]
+	if err == nil {
+		*h = resolverHealth{}
+		return
+	}
+	h.failures++
+	h.lastErr = err
+	if h.failures >= rc.threshold() {
+		h.downUntil = time.Now().Add(rc.cooldown())
+	}
+}
+
+// LookupIPAddr looks up host with the first resolver able to answer.
+func (rc *ResolverChain) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if len(rc.Resolvers) == 0 {
+		return net.DefaultResolver.LookupIPAddr(ctx, host)
+	}
+	var firstErr error
+	for _, i := range rc.order(time.Now()) {
+		ips, err := rc.Resolvers[i].LookupIPAddr(ctx, host)
+		var dnsErr *net.DNSError
+		if err == nil || errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			rc.report(i, nil)
+			return ips, err
+		}
+		if ctx.Err() != nil {
+			// The caller gave up, the resolver is not to blame.
+			return nil, err
+		}
+		rc.report(i, err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// Status returns the health of the resolvers, in order.
+func (rc *ResolverChain) Status() []ResolverStatus {
+	now := time.Now()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	status := make([]ResolverStatus, len(rc.Resolvers))
+	for i := range status {
+		status[i].Healthy = true
+		if i < len(rc.health) {
+			h := rc.health[i]
+			status[i] = ResolverStatus{
+				Healthy:   !now.Before(h.downUntil),
+				Failures:  h.failures,
+				DownUntil: h.downUntil,
+				LastError: h.lastErr,
+			}
+		}
+	}
+	return status
+}
+
+// DoHResolver resolves hosts with a DNS over HTTPS server speaking the JSON
+// API, e.g. https://cloudflare-dns.com/dns-query or https://dns.google/resolve.
+type DoHResolver struct {
+	URL string
+	// Client is http.DefaultClient by default.
+	Client *http.Client
+}
+
+type dohAnswer struct {
+	Status int
+	Answer []struct {
+		Type int    `json:"type"`
+		Data string `json:"data"`
+	}
+}
+
+const (
+	dnsTypeA     = 1
+	dnsTypeAAAA  = 28
+	dnsTypeHTTPS = 65
+
+	dnsRcodeNXDomain = 3
+)
+
+// LookupIPAddr looks up the A and AAAA records of host.
+func (r *DoHResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var ips []net.IPAddr
+	for _, qtype := range []int{dnsTypeA, dnsTypeAAAA} {
+		answer, err := r.query(ctx, host, qtype)
+		if err != nil {
+			return nil, err
+		}
+		if answer.Status == dnsRcodeNXDomain {
+			return nil, &net.DNSError{Err: "no such host", Name: host, Server: r.URL, IsNotFound: true}
+		}
+		if answer.Status != 0 {
+			return nil, &net.DNSError{Err: fmt.Sprintf("server failure, rcode %d", answer.Status), Name: host, Server: r.URL, IsTemporary: true}
+		}
+		for _, rr := range answer.Answer {
+			if rr.Type != qtype {
+				// CNAME
+				continue
+			}
+			if ip := net.ParseIP(rr.Data); ip != nil {
+				ips = append(ips, net.IPAddr{IP: ip})
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, Server: r.URL, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+func (r *DoHResolver) query(ctx context.Context, host string, qtype int) (*dohAnswer, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("name", host)
+	q.Set("type", fmt.Sprint(qtype))
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, Server: r.URL, IsTemporary: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &net.DNSError{Err: "unexpected status " + resp.Status, Name: host, Server: r.URL, IsTemporary: true}
+	}
+	var answer dohAnswer
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, &net.DNSError{Err: "invalid answer: " + err.Error(), Name: host, Server: r.URL}
+	}
+	return &answer, nil
+}
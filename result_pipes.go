@@ -1,7 +1,11 @@
 package ubernet
 
-type resultPipes interface {
-	popResultPipe(int) (chan error, bool)
-	deregisterResultPipe(int)
-	registerResultPipe(int, chan error)
+// ResultPipes maps the sockets being checked by a Checker to the pipe
+// waiting for their connect result. Implementations must be safe for
+// concurrent use.
+type ResultPipes interface {
+	// PopResultPipe returns and removes the pipe registered for fd.
+	PopResultPipe(fd int) (chan error, bool)
+	DeregisterResultPipe(fd int)
+	RegisterResultPipe(fd int, pipe chan error)
 }
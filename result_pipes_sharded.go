@@ -0,0 +1,67 @@
+package ubernet
+
+import "sync"
+
+const defaultResultPipesShards = 64
+
+type resultPipesShard struct {
+	sync.Mutex
+	pipes map[int]chan error
+	// Pad shards to their own cache line, they are locked concurrently.
+	_ [40]byte
+}
+
+type resultPipesSharded struct {
+	shards []resultPipesShard
+	mask   int
+}
+
+// NewShardedResultPipes returns ResultPipes spread over shards maps, each
+// with its own lock, which scales better than a sync.Map with frequent
+// registrations. The shard count is rounded up to a power of two, 64 when
+// zero or less.
+func NewShardedResultPipes(shards int) ResultPipes {
+	if shards <= 0 {
+		shards = defaultResultPipesShards
+	}
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	r := &resultPipesSharded{shards: make([]resultPipesShard, n), mask: n - 1}
+	for i := range r.shards {
+		r.shards[i].pipes = make(map[int]chan error)
+	}
+	return r
+}
+
+// shard returns the shard of fd. FDs are allocated lowest first, so
+// consecutive FDs are spread over consecutive shards.
+func (r *resultPipesSharded) shard(fd int) *resultPipesShard {
+	return &r.shards[fd&r.mask]
+}
+
+func (r *resultPipesSharded) PopResultPipe(fd int) (chan error, bool) {
+	s := r.shard(fd)
+	s.Lock()
+	defer s.Unlock()
+	p, exist := s.pipes[fd]
+	if exist {
+		delete(s.pipes, fd)
+	}
+	return p, exist
+}
+
+func (r *resultPipesSharded) DeregisterResultPipe(fd int) {
+	s := r.shard(fd)
+	s.Lock()
+	delete(s.pipes, fd)
+	s.Unlock()
+}
+
+func (r *resultPipesSharded) RegisterResultPipe(fd int, pipe chan error) {
+	s := r.shard(fd)
+	s.Lock()
+	s.pipes[fd] = pipe
+	s.Unlock()
+}
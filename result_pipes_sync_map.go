@@ -6,11 +6,12 @@ type resultPipesSyncMap struct {
 	sync.Map
 }
 
-func newResultPipesSyncMap() *resultPipesSyncMap {
+// NewSyncMapResultPipes returns ResultPipes backed by a sync.Map, the default.
+func NewSyncMapResultPipes() ResultPipes {
 	return &resultPipesSyncMap{}
 }
 
-func (r *resultPipesSyncMap) popResultPipe(fd int) (chan error, bool) {
+func (r *resultPipesSyncMap) PopResultPipe(fd int) (chan error, bool) {
 	p, exist := r.Load(fd)
 	if exist {
 		r.Delete(fd)
@@ -21,11 +22,11 @@ func (r *resultPipesSyncMap) popResultPipe(fd int) (chan error, bool) {
 	return nil, exist
 }
 
-func (r *resultPipesSyncMap) deregisterResultPipe(fd int) {
+func (r *resultPipesSyncMap) DeregisterResultPipe(fd int) {
 	r.Delete(fd)
 }
 
-func (r *resultPipesSyncMap) registerResultPipe(fd int, pipe chan error) {
+func (r *resultPipesSyncMap) RegisterResultPipe(fd int, pipe chan error) {
 	// NOTE: the pipe should have been put back if c.fdResultPipes[fd] exists.
 	r.Store(fd, pipe)
 }
@@ -0,0 +1,75 @@
+package ubernet
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status int
+		value  string
+		wait   time.Duration
+		ok     bool
+	}{
+		{"seconds", http.StatusTooManyRequests, "120", 2 * time.Minute, true},
+		{"zero seconds", http.StatusServiceUnavailable, "0", 0, true},
+		{"negative seconds", http.StatusTooManyRequests, "-1", 0, false},
+		{"HTTP-date", http.StatusServiceUnavailable, now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{"past HTTP-date", http.StatusTooManyRequests, now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"invalid", http.StatusTooManyRequests, "soon", 0, false},
+		{"missing", http.StatusTooManyRequests, "", 0, false},
+		{"other status", http.StatusBadGateway, "120", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.value != "" {
+				resp.Header.Set("Retry-After", tt.value)
+			}
+			wait, ok := retryAfter(resp, now)
+			if wait != tt.wait || ok != tt.ok {
+				t.Fatalf("retryAfter = %s, %v; want %s, %v", wait, ok, tt.wait, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDefaultBackoffRetryAfter(t *testing.T) {
+	min, max := time.Second, 30*time.Second
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"below RetryWaitMax", "5", 5 * time.Second},
+		{"capped at RetryWaitMax", "3600", max},
+		{"past HTTP-date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+		{"invalid", "soon", 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			resp.Header.Set("Retry-After", tt.value)
+			if got := defaultBackoff(min, max, 2, resp); got != tt.want {
+				t.Fatalf("defaultBackoff = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRetryPolicyTooManyRequests(t *testing.T) {
+	for value, want := range map[string]bool{"": false, "soon": false, "10": true} {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		if value != "" {
+			resp.Header.Set("Retry-After", value)
+		}
+		if retry, _ := defaultRetryPolicy(context.Background(), resp, nil); retry != want {
+			t.Errorf("Retry-After %q: retry = %v, want %v", value, retry, want)
+		}
+	}
+}
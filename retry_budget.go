@@ -0,0 +1,85 @@
+package ubernet
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBudgetWindow     = 10 * time.Second
+	defaultRetryBudgetRatio      = 0.2
+	defaultRetryBudgetMinRetries = 10
+)
+
+// RetryBudget caps the retries of a Client, across all the goroutines
+// using it, to a share of its requests, so that a widespread outage does
+// not multiply the load on a recovering backend. Once exhausted, Do fails
+// with ErrRetryBudgetExhausted instead of retrying.
+type RetryBudget struct {
+	// Window is the period over which requests and retries are counted,
+	// 10s by default.
+	Window time.Duration
+	// Ratio is the number of retries allowed per request, 0.2 by default.
+	Ratio float64
+	// MinRetries are allowed per Window regardless of Ratio, so that
+	// clients sending few requests still retry, 10 by default.
+	MinRetries int
+
+	once   sync.Once
+	mu     sync.Mutex
+	window *healthWindow
+}
+
+func (b *RetryBudget) init() {
+	b.once.Do(func() {
+		window := b.Window
+		if window <= 0 {
+			window = defaultRetryBudgetWindow
+		}
+		b.window = newHealthWindow(window)
+	})
+}
+
+// deposit records a request.
+func (b *RetryBudget) deposit() {
+	b.init()
+	b.window.record(false)
+}
+
+// available returns the number of retries the budget allows.
+func (b *RetryBudget) available() float64 {
+	ratio, minRetries := b.Ratio, b.MinRetries
+	if ratio <= 0 {
+		ratio = defaultRetryBudgetRatio
+	}
+	if minRetries <= 0 {
+		minRetries = defaultRetryBudgetMinRetries
+	}
+	// The window counts requests and retries, the latter as failures.
+	rate, total := b.window.failureRate()
+	retries := math.Round(rate * float64(total))
+	requests := float64(total) - retries
+	return ratio*requests + float64(minRetries) - retries
+}
+
+// withdraw records a retry and reports whether the budget allowed it.
+func (b *RetryBudget) withdraw() bool {
+	b.init()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.available() < 1 {
+		return false
+	}
+	b.window.record(true)
+	return true
+}
+
+// Available returns the number of retries the budget currently allows.
+func (b *RetryBudget) Available() int {
+	b.init()
+	if available := b.available(); available > 0 {
+		return int(available)
+	}
+	return 0
+}
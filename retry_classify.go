@@ -0,0 +1,64 @@
+package ubernet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// redirectsErrorRe matches the error of http.Client following too many
+// redirects.
+var redirectsErrorRe = regexp.MustCompile(`stopped after \d+ redirects\z`)
+
+// IsPermanentError reports whether err, the error of an attempt, is bound
+// to happen again if retried: too many redirects, an unsupported scheme, an
+// invalid header, a certificate failing verification, a request over the
+// limits of the Client, or a response failing SchemaMiddleware.
+func IsPermanentError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var (
+		verifyErr   *tls.CertificateVerificationError
+		unknownCA   x509.UnknownAuthorityError
+		invalidCert x509.CertificateInvalidError
+		hostnameErr x509.HostnameError
+		tooLarge    *ErrRequestBodyTooLarge
+		tooLong     *ErrURLTooLong
+		notAccepted *ErrProtocolNotAccepted
+		echMissing  *ErrECHUnavailable
+		violation   *ErrSchemaViolation
+	)
+	switch {
+	case errors.As(err, &verifyErr), errors.As(err, &unknownCA), errors.As(err, &invalidCert), errors.As(err, &hostnameErr):
+		return true
+	case errors.As(err, &tooLarge), errors.As(err, &tooLong), errors.As(err, &notAccepted), errors.As(err, &echMissing), errors.As(err, &violation):
+		return true
+	}
+	if errors.Is(err, ErrBodyNotReplayable) {
+		return true
+	}
+	msg := err.Error()
+	return redirectsErrorRe.MatchString(msg) ||
+		strings.Contains(msg, "unsupported protocol scheme") ||
+		strings.Contains(msg, "invalid header") ||
+		strings.Contains(msg, "certificate is not trusted")
+}
+
+// PermanentErrorRetryPolicy returns policy, DefaultRetryPolicy if nil,
+// except that the permanent errors are not retried, see IsPermanentError.
+func PermanentErrorRetryPolicy(policy RetryPolicy) RetryPolicy {
+	if policy == nil {
+		policy = defaultRetryPolicy
+	}
+	return func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if ctx.Err() == nil && IsPermanentError(err) {
+			return false, err
+		}
+		return policy(ctx, resp, err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package retryablehttp mirrors the API of hashicorp/go-retryablehttp on
+// top of ubernet, so that code written against it can switch by changing
+// its import path, keeping its CheckRetry, Backoff and ErrorHandler
+// functions.
+package retryablehttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"ubernet"
+)
+
+// Types shared with ubernet.
+type (
+	Request         = ubernet.Request
+	ReaderFunc      = ubernet.ReaderFunc
+	LenReader       = ubernet.LenReader
+	Logger          = ubernet.Logger
+	RequestLogHook  = ubernet.RequestLogHook
+	ResponseLogHook = ubernet.ResponseLogHook
+	CheckRetry      = ubernet.RetryPolicy
+	Backoff         = ubernet.Backoff
+	ErrorHandler    = ubernet.ErrorHandler
+	PrepareRetry    = ubernet.PrepareRetry
+)
+
+// LeveledLogger is the structured logger interface of go-retryablehttp.
+type LeveledLogger interface {
+	Error(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Debug(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+}
+
+// leveledLogger adapts a LeveledLogger to Logger.
+type leveledLogger struct {
+	LeveledLogger
+}
+
+func (l leveledLogger) Printf(format string, v ...interface{}) {
+	l.Info(fmt.Sprintf(format, v...))
+}
+
+var (
+	defaultRetryWaitMin = 1 * time.Second
+	defaultRetryWaitMax = 30 * time.Second
+	defaultRetryMax     = 4
+)
+
+// Functions shared with ubernet.
+var (
+	NewRequest              = ubernet.NewRequest
+	FromRequest             = ubernet.FromRequest
+	DefaultRetryPolicy      = ubernet.PermanentErrorRetryPolicy(ubernet.DefaultRetryPolicy)
+	DefaultBackoff          = ubernet.DefaultBackoff
+	LinearJitterBackoff     = ubernet.LinearJitterBackoff
+	PassthroughErrorHandler = ubernet.PassthroughErrorHandler
+)
+
+// ErrorPropagatedRetryPolicy is DefaultRetryPolicy, returning an error
+// describing the unexpected status codes it retries.
+func ErrorPropagatedRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	retry, checkErr := DefaultRetryPolicy(ctx, resp, err)
+	if retry && checkErr == nil && resp != nil {
+		return true, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return retry, checkErr
+}
+
+// Client has the fields of the Client of go-retryablehttp. They are read
+// when it sends its first request, later changes have no effect.
+type Client struct {
+	HTTPClient *http.Client
+	// Logger is either a Logger or a LeveledLogger.
+	Logger interface{}
+
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+	RetryMax     int
+
+	RequestLogHook  RequestLogHook
+	ResponseLogHook ResponseLogHook
+	CheckRetry      CheckRetry
+	Backoff         Backoff
+	ErrorHandler    ErrorHandler
+	PrepareRetry    PrepareRetry
+
+	once   sync.Once
+	client *ubernet.Client
+}
+
+// NewClient returns a Client with the defaults of go-retryablehttp.
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:   ubernet.DefaultPooledClient(),
+		RetryWaitMin: defaultRetryWaitMin,
+		RetryWaitMax: defaultRetryWaitMax,
+		RetryMax:     defaultRetryMax,
+		CheckRetry:   DefaultRetryPolicy,
+		Backoff:      DefaultBackoff,
+	}
+}
+
+// Ubernet returns the ubernet.Client c sends its requests through, to use
+// the features go-retryablehttp lacks.
+func (c *Client) Ubernet() *ubernet.Client {
+	c.once.Do(func() {
+		uc := ubernet.NewClient()
+		if c.HTTPClient != nil {
+			uc.HTTPClient = c.HTTPClient
+		}
+		switch l := c.Logger.(type) {
+		case Logger:
+			uc.Logger = l
+		case LeveledLogger:
+			uc.Logger = leveledLogger{l}
+		default:
+			uc.Logger = nil
+		}
+		uc.RetryWaitMin = c.RetryWaitMin
+		uc.RetryWaitMax = c.RetryWaitMax
+		uc.RetryMax = c.RetryMax
+		uc.RequestLogHook = c.RequestLogHook
+		uc.ResponseLogHook = c.ResponseLogHook
+		if c.CheckRetry != nil {
+			uc.RetryPolicy = c.CheckRetry
+		}
+		if c.Backoff != nil {
+			uc.Backoff = c.Backoff
+		}
+		uc.ErrorHandler = c.ErrorHandler
+		uc.PrepareRetry = c.PrepareRetry
+		c.client = uc
+	})
+	return c.client
+}
+
+// Do sends req, retrying as configured.
+func (c *Client) Do(req *Request) (*http.Response, error) {
+	return c.Ubernet().Do(req)
+}
+
+// Get sends a GET request to url.
+func (c *Client) Get(url string) (*http.Response, error) {
+	return c.Ubernet().Get(url)
+}
+
+// Head sends a HEAD request to url.
+func (c *Client) Head(url string) (*http.Response, error) {
+	return c.Ubernet().Head(url)
+}
+
+// Post sends a POST request to url.
+func (c *Client) Post(url, bodyType string, body interface{}) (*http.Response, error) {
+	return c.Ubernet().Post(url, bodyType, body)
+}
+
+// PostForm sends data URL-encoded in a POST request to url.
+func (c *Client) PostForm(url string, data url.Values) (*http.Response, error) {
+	return c.Ubernet().PostForm(url, data)
+}
+
+// StandardClient returns an *http.Client sending its requests through c.
+func (c *Client) StandardClient() *http.Client {
+	return c.Ubernet().StandardClient()
+}
+
+// RoundTripper is an http.RoundTripper sending requests through Client.
+type RoundTripper struct {
+	// Client is a NewClient if nil.
+	Client *Client
+
+	once sync.Once
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.once.Do(func() {
+		if rt.Client == nil {
+			rt.Client = NewClient()
+		}
+	})
+	return rt.Client.Ubernet().RoundTripper().RoundTrip(req)
+}
+
+var defaultClient = NewClient()
+
+// Get sends a GET request to url with the default Client.
+func Get(url string) (*http.Response, error) {
+	return defaultClient.Get(url)
+}
+
+// Head sends a HEAD request to url with the default Client.
+func Head(url string) (*http.Response, error) {
+	return defaultClient.Head(url)
+}
+
+// Post sends a POST request to url with the default Client.
+func Post(url, bodyType string, body interface{}) (*http.Response, error) {
+	return defaultClient.Post(url, bodyType, body)
+}
+
+// PostForm sends data URL-encoded in a POST request to url with the
+// default Client.
+func PostForm(url string, data url.Values) (*http.Response, error) {
+	return defaultClient.PostForm(url, data)
+}
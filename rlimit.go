@@ -0,0 +1,33 @@
+package ubernet
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// RaiseFDLimit raises the soft RLIMIT_NOFILE to the hard limit, since
+// default limits as low as 1024 FDs cripple both connection pools and
+// checkers. It logs the change to logger, which may be nil, and returns the
+// new soft limit.
+func RaiseFDLimit(logger Logger) (uint64, error) {
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, os.NewSyscallError("getrlimit", err)
+	}
+	if limit.Cur >= limit.Max {
+		return limit.Cur, nil
+	}
+	old := limit.Cur
+	limit.Cur = limit.Max
+	if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &limit); err != nil {
+		if logger != nil {
+			logger.Printf("WARNING could not raise RLIMIT_NOFILE from %d to %d: %v", old, limit.Max, err)
+		}
+		return old, os.NewSyscallError("setrlimit", err)
+	}
+	if logger != nil {
+		logger.Printf("INFO raised RLIMIT_NOFILE from %d to %d", old, limit.Cur)
+	}
+	return limit.Cur, nil
+}
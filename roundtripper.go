@@ -0,0 +1,66 @@
+package ubernet
+
+import (
+	"io"
+	"net/http"
+)
+
+// RoundTripper is an http.RoundTripper sending requests through a Client,
+// so that consumers of the standard library, e.g. third party SDKs, get
+// its retries and backoff.
+type RoundTripper struct {
+	// Client is the default Client if nil.
+	Client *Client
+}
+
+// RoundTrip implements http.RoundTripper. The retries replay the body of
+// req from its GetBody if set, otherwise the body is read once and held.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	client := rt.Client
+	if client == nil {
+		client = defaultClient
+	}
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+		// GetBody returns a fresh copy of the body for every attempt.
+		req.Body.Close()
+		out := *req
+		r := &Request{body: func() (io.Reader, error) { return req.GetBody() }, Request: &out}
+		return rt.do(client, req, r)
+	}
+
+	bodyReader, contentLength, held, err := getBodyReaderAndContentLength(req.Body)
+	if req.Body != nil {
+		// The body was read, it is closed as a transport would.
+		req.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// RoundTrip must not modify req.
+	out := *req
+	if out.ContentLength == 0 && contentLength > 0 {
+		out.ContentLength = contentLength
+	}
+	r := &Request{body: bodyReader, Request: &out}
+	held.holdBy(r)
+	return rt.do(client, req, r)
+}
+
+func (rt *RoundTripper) do(client *Client, req *http.Request, r *Request) (*http.Response, error) {
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// RoundTripper returns an http.RoundTripper sending requests through c.
+func (c *Client) RoundTripper() http.RoundTripper {
+	return &RoundTripper{Client: c}
+}
+
+// StandardClient returns an *http.Client sending its requests through c.
+func (c *Client) StandardClient() *http.Client {
+	return &http.Client{Transport: c.RoundTripper()}
+}
@@ -0,0 +1,666 @@
+package ubernet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultSchemaMaxBodySize = 1 << 20
+
+// ResponseValidator validates the responses of a route, see
+// SchemaMiddleware.
+type ResponseValidator interface {
+	// ValidateResponse validates resp, whose body was read into body.
+	ValidateResponse(resp *http.Response, body []byte) error
+}
+
+// ResponseValidatorFunc is a function implementing ResponseValidator, e.g.
+// unmarshaling the body with a protobuf descriptor.
+type ResponseValidatorFunc func(resp *http.Response, body []byte) error
+
+// ValidateResponse implements ResponseValidator.
+func (f ResponseValidatorFunc) ValidateResponse(resp *http.Response, body []byte) error {
+	return f(resp, body)
+}
+
+// SchemaMode is what SchemaMiddleware does with invalid responses.
+type SchemaMode int
+
+// Modes of SchemaMiddleware.
+const (
+	// SchemaStrict fails the attempts getting an invalid response with an
+	// ErrSchemaViolation, which DefaultRetryPolicy does not retry.
+	SchemaStrict SchemaMode = iota
+	// SchemaWarn only reports the invalid responses to OnViolation.
+	SchemaWarn
+)
+
+// SchemaRoute validates the responses to the requests matching Pattern.
+// A pattern is a path, optionally preceded by a method and a space, e.g.
+// "GET /users/{id}". A "{name}" segment matches any segment, and a last
+// "{name...}" segment the rest of the path.
+type SchemaRoute struct {
+	Pattern   string
+	Validator ResponseValidator
+}
+
+// SchemaOptions configures SchemaMiddleware.
+type SchemaOptions struct {
+	// Routes are tried in order, the first matching route validating the
+	// response.
+	Routes []SchemaRoute
+	Mode   SchemaMode
+	// MaxBodySize caps the bytes of the bodies validated, 1MiB by default.
+	// Larger bodies are not validated.
+	MaxBodySize int64
+	// OnViolation, if set, is called with every invalid response, e.g. to
+	// log or meter it.
+	OnViolation func(req *http.Request, err *ErrSchemaViolation)
+}
+
+// SchemaMiddleware validates the 2xx responses of the routes of opts, so
+// that malformed upstream payloads are caught at the client boundary.
+// Streaming responses are not validated.
+func SchemaMiddleware(opts SchemaOptions) (Middleware, error) {
+	routes := make([]schemaRoute, len(opts.Routes))
+	for i, r := range opts.Routes {
+		route, err := parseSchemaRoute(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		route.validator = r.Validator
+		routes[i] = route
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = defaultSchemaMaxBodySize
+	}
+	redact := &Client{}
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *Request) (*http.Response, error) {
+			resp, err := next(req)
+			if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 || req.streamingResponse {
+				return resp, err
+			}
+			var validator ResponseValidator
+			for i := range routes {
+				if routes[i].match(req.Request) {
+					validator = routes[i].validator
+					break
+				}
+			}
+			if validator == nil {
+				return resp, nil
+			}
+
+			var head bytes.Buffer
+			n, readErr := io.CopyN(&head, resp.Body, opts.MaxBodySize+1)
+			if readErr != nil && !errors.Is(readErr, io.EOF) {
+				resp.Body.Close()
+				return nil, readErr
+			}
+			// The head is read again by the caller.
+			resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(head.Bytes()), resp.Body), Closer: resp.Body}
+			if n > opts.MaxBodySize {
+				return resp, nil
+			}
+			verr := validator.ValidateResponse(resp, head.Bytes())
+			if verr == nil {
+				return resp, nil
+			}
+			violation := &ErrSchemaViolation{Method: req.Method, URL: redact.redactURL(req.URL), StatusCode: resp.StatusCode, Err: verr}
+			if opts.OnViolation != nil {
+				opts.OnViolation(req.Request, violation)
+			}
+			if opts.Mode == SchemaWarn {
+				return resp, nil
+			}
+			resp.Body.Close()
+			return nil, violation
+		}
+	}, nil
+}
+
+type schemaRoute struct {
+	method    string
+	segments  []string
+	rest      bool
+	validator ResponseValidator
+}
+
+func parseSchemaRoute(pattern string) (schemaRoute, error) {
+	var r schemaRoute
+	path := pattern
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		r.method, path = pattern[:i], strings.TrimSpace(pattern[i+1:])
+	}
+	if !strings.HasPrefix(path, "/") {
+		return r, fmt.Errorf("schema route %q: path must start with /", pattern)
+	}
+	r.segments = strings.Split(path[1:], "/")
+	for i, s := range r.segments {
+		if !strings.HasPrefix(s, "{") {
+			continue
+		}
+		if !strings.HasSuffix(s, "}") {
+			return r, fmt.Errorf("schema route %q: bad segment %q", pattern, s)
+		}
+		if strings.HasSuffix(s, "...}") {
+			if i != len(r.segments)-1 {
+				return r, fmt.Errorf("schema route %q: %s must be the last segment", pattern, s)
+			}
+			r.segments, r.rest = r.segments[:i], true
+			break
+		}
+		r.segments[i] = "{}"
+	}
+	return r, nil
+}
+
+func (r *schemaRoute) match(req *http.Request) bool {
+	if r.method != "" && r.method != req.Method {
+		return false
+	}
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	segments := strings.Split(path[1:], "/")
+	if len(segments) < len(r.segments) || (!r.rest && len(segments) != len(r.segments)) {
+		return false
+	}
+	for i, s := range r.segments {
+		if s == "{}" {
+			if segments[i] == "" {
+				return false
+			}
+		} else if s != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// JSONSchema is a ResponseValidator checking JSON bodies against a JSON
+// Schema. It supports the validation keywords of draft 2020-12 most APIs
+// use: type, enum, const, properties, required, additionalProperties,
+// items, minLength, maxLength, minItems, maxItems, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, pattern, allOf, anyOf,
+// oneOf, not, local $ref, and the nullable of OpenAPI 3.0.
+// Unknown keywords, format included, are ignored.
+type JSONSchema struct {
+	root *schemaNode
+}
+
+type schemaNode struct {
+	always     *bool
+	types      []string
+	nullable   bool
+	enum       []interface{}
+	constant   interface{}
+	hasConst   bool
+	ref        *schemaNode
+	allOf      []*schemaNode
+	anyOf      []*schemaNode
+	oneOf      []*schemaNode
+	not        *schemaNode
+	minimum    *float64
+	maximum    *float64
+	exclMin    *float64
+	exclMax    *float64
+	multipleOf float64
+	minLength  *int
+	maxLength  *int
+	pattern    *regexp.Regexp
+	items      *schemaNode
+	minItems   *int
+	maxItems   *int
+
+	properties           map[string]*schemaNode
+	required             []string
+	additionalProperties *schemaNode
+}
+
+// ParseJSONSchema parses the JSON Schema document data.
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing JSON schema: %w", err)
+	}
+	p := &schemaParser{doc: doc, refs: make(map[string]*schemaNode)}
+	root := &schemaNode{}
+	if err := p.parse(doc, root, "#"); err != nil {
+		return nil, fmt.Errorf("parsing JSON schema: %w", err)
+	}
+	return &JSONSchema{root: root}, nil
+}
+
+type schemaParser struct {
+	doc  interface{}
+	refs map[string]*schemaNode
+}
+
+func (p *schemaParser) node(v interface{}, at string) (*schemaNode, error) {
+	n := &schemaNode{}
+	return n, p.parse(v, n, at)
+}
+
+func (p *schemaParser) nodes(v interface{}, at string) ([]*schemaNode, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: not an array", at)
+	}
+	nodes := make([]*schemaNode, len(list))
+	for i, s := range list {
+		var err error
+		if nodes[i], err = p.node(s, at+"/"+strconv.Itoa(i)); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func (p *schemaParser) parse(v interface{}, n *schemaNode, at string) error {
+	if b, ok := v.(bool); ok {
+		n.always = &b
+		return nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: not a schema", at)
+	}
+	var err error
+	for key, value := range m {
+		switch key {
+		case "type":
+			switch t := value.(type) {
+			case string:
+				n.types = []string{t}
+			case []interface{}:
+				for _, s := range t {
+					if s, ok := s.(string); ok {
+						n.types = append(n.types, s)
+					}
+				}
+			}
+		case "nullable":
+			n.nullable, _ = value.(bool)
+		case "enum":
+			n.enum, _ = value.([]interface{})
+		case "const":
+			n.constant, n.hasConst = value, true
+		case "$ref":
+			ref, _ := value.(string)
+			n.ref, err = p.resolve(ref)
+		case "allOf":
+			n.allOf, err = p.nodes(value, at+"/allOf")
+		case "anyOf":
+			n.anyOf, err = p.nodes(value, at+"/anyOf")
+		case "oneOf":
+			n.oneOf, err = p.nodes(value, at+"/oneOf")
+		case "not":
+			n.not, err = p.node(value, at+"/not")
+		case "minimum":
+			n.minimum = schemaFloat(value)
+		case "maximum":
+			n.maximum = schemaFloat(value)
+		case "exclusiveMinimum":
+			n.exclMin = schemaFloat(value)
+		case "exclusiveMaximum":
+			n.exclMax = schemaFloat(value)
+		case "multipleOf":
+			if f := schemaFloat(value); f != nil {
+				n.multipleOf = *f
+			}
+		case "minLength":
+			n.minLength = schemaInt(value)
+		case "maxLength":
+			n.maxLength = schemaInt(value)
+		case "minItems":
+			n.minItems = schemaInt(value)
+		case "maxItems":
+			n.maxItems = schemaInt(value)
+		case "pattern":
+			s, _ := value.(string)
+			n.pattern, err = regexp.Compile(s)
+		case "items":
+			n.items, err = p.node(value, at+"/items")
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s/properties: not an object", at)
+			}
+			n.properties = make(map[string]*schemaNode, len(props))
+			for name, s := range props {
+				if n.properties[name], err = p.node(s, at+"/properties/"+name); err != nil {
+					return err
+				}
+			}
+		case "required":
+			list, _ := value.([]interface{})
+			for _, s := range list {
+				if s, ok := s.(string); ok {
+					n.required = append(n.required, s)
+				}
+			}
+		case "additionalProperties":
+			n.additionalProperties, err = p.node(value, at+"/additionalProperties")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the node of the local reference ref, a JSON pointer in
+// the document, parsed once so that recursive schemas terminate.
+func (p *schemaParser) resolve(ref string) (*schemaNode, error) {
+	if n, ok := p.refs[ref]; ok {
+		return n, nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	target := p.doc
+	if ref != "#" {
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			switch t := target.(type) {
+			case map[string]interface{}:
+				target = t[token]
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(t) {
+					return nil, fmt.Errorf("$ref %q not found", ref)
+				}
+				target = t[i]
+			default:
+				target = nil
+			}
+			if target == nil {
+				return nil, fmt.Errorf("$ref %q not found", ref)
+			}
+		}
+	}
+	n := &schemaNode{}
+	p.refs[ref] = n
+	return n, p.parse(target, n, ref)
+}
+
+func schemaFloat(v interface{}) *float64 {
+	if num, ok := v.(json.Number); ok {
+		if f, err := num.Float64(); err == nil {
+			return &f
+		}
+	}
+	return nil
+}
+
+func schemaInt(v interface{}) *int {
+	if f := schemaFloat(v); f != nil {
+		i := int(*f)
+		return &i
+	}
+	return nil
+}
+
+// SchemaError is a violation of a JSON Schema by the value at Path, e.g.
+// "$.items[2].id".
+type SchemaError struct {
+	Path    string
+	Message string
+}
+
+func (e *SchemaError) Error() string { return e.Path + ": " + e.Message }
+
+// SchemaErrors are the violations of a JSON Schema by a value.
+type SchemaErrors []*SchemaError
+
+func (e SchemaErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// maxSchemaErrors caps the violations reported.
+const maxSchemaErrors = 20
+
+// ValidateResponse implements ResponseValidator, requiring a JSON body.
+func (s *JSONSchema) ValidateResponse(resp *http.Response, body []byte) error {
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !isJSONMediaType(mt) {
+		return fmt.Errorf("content type %q is not JSON", resp.Header.Get("Content-Type"))
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return s.Validate(v)
+}
+
+// Validate validates v, a value decoded by encoding/json, returning
+// SchemaErrors if it violates s.
+func (s *JSONSchema) Validate(v interface{}) error {
+	var errs SchemaErrors
+	s.root.validate(v, "$", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (n *schemaNode) validate(v interface{}, path string, errs *SchemaErrors) {
+	if len(*errs) >= maxSchemaErrors {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, &SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if n.always != nil {
+		if !*n.always {
+			fail("no value allowed")
+		}
+		return
+	}
+	if n.ref != nil {
+		n.ref.validate(v, path, errs)
+	}
+	if v == nil && n.nullable {
+		return
+	}
+	if len(n.types) > 0 && !n.hasType(v) {
+		fail("got %s, want %s", jsonTypeOf(v), strings.Join(n.types, " or "))
+		return
+	}
+	if n.enum != nil && !containsJSON(n.enum, v) {
+		fail("not one of the enumerated values")
+	}
+	if n.hasConst && !equalJSON(n.constant, v) {
+		fail("not the constant value")
+	}
+
+	for _, sub := range n.allOf {
+		sub.validate(v, path, errs)
+	}
+	if n.anyOf != nil && n.matching(n.anyOf, v, path) == 0 {
+		fail("matches none of anyOf")
+	}
+	if n.oneOf != nil {
+		if matched := n.matching(n.oneOf, v, path); matched != 1 {
+			fail("matches %d of oneOf, want 1", matched)
+		}
+	}
+	if n.not != nil && n.matching([]*schemaNode{n.not}, v, path) == 1 {
+		fail("matches not")
+	}
+
+	switch v := v.(type) {
+	case json.Number, float64:
+		n.validateNumber(jsonFloat(v), fail)
+	case string:
+		length := len([]rune(v))
+		if n.minLength != nil && length < *n.minLength {
+			fail("shorter than %d", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			fail("longer than %d", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			fail("does not match %q", n.pattern.String())
+		}
+	case []interface{}:
+		if n.minItems != nil && len(v) < *n.minItems {
+			fail("fewer than %d items", *n.minItems)
+		}
+		if n.maxItems != nil && len(v) > *n.maxItems {
+			fail("more than %d items", *n.maxItems)
+		}
+		if n.items != nil {
+			for i, item := range v {
+				n.items.validate(item, path+"["+strconv.Itoa(i)+"]", errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range n.required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		for _, name := range sortedValueKeys(v) {
+			if prop, ok := n.properties[name]; ok {
+				prop.validate(v[name], path+"."+name, errs)
+			} else if extra := n.additionalProperties; extra != nil {
+				if extra.always != nil && !*extra.always {
+					fail("property %q not allowed", name)
+					continue
+				}
+				extra.validate(v[name], path+"."+name, errs)
+			}
+		}
+	}
+}
+
+func (n *schemaNode) validateNumber(f float64, fail func(string, ...interface{})) {
+	if n.minimum != nil && f < *n.minimum {
+		fail("less than %v", *n.minimum)
+	}
+	if n.maximum != nil && f > *n.maximum {
+		fail("greater than %v", *n.maximum)
+	}
+	if n.exclMin != nil && f <= *n.exclMin {
+		fail("not greater than %v", *n.exclMin)
+	}
+	if n.exclMax != nil && f >= *n.exclMax {
+		fail("not less than %v", *n.exclMax)
+	}
+	if n.multipleOf > 0 {
+		if q := f / n.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("not a multiple of %v", n.multipleOf)
+		}
+	}
+}
+
+// matching returns how many of nodes v matches.
+func (n *schemaNode) matching(nodes []*schemaNode, v interface{}, path string) int {
+	matched := 0
+	for _, sub := range nodes {
+		var errs SchemaErrors
+		sub.validate(v, path, &errs)
+		if len(errs) == 0 {
+			matched++
+		}
+	}
+	return matched
+}
+
+func (n *schemaNode) hasType(v interface{}) bool {
+	got := jsonTypeOf(v)
+	for _, t := range n.types {
+		switch {
+		case t == got:
+			return true
+		case t == "number" && got == "integer":
+			return true
+		}
+	}
+	return v == nil && n.nullable
+}
+
+// jsonTypeOf returns the JSON Schema type of v, "integer" for the numbers
+// without fractional part.
+func jsonTypeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number, float64:
+		if f := jsonFloat(v); f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	}
+	return math.NaN()
+}
+
+func containsJSON(list []interface{}, v interface{}) bool {
+	for _, e := range list {
+		if equalJSON(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON compares decoded JSON values, numbers by value.
+func equalJSON(a, b interface{}) bool {
+	switch jsonTypeOf(a) {
+	case "integer", "number":
+		t := jsonTypeOf(b)
+		return (t == "integer" || t == "number") && jsonFloat(a) == jsonFloat(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func sortedValueKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,188 @@
+package ubernet
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrSecretNotFound indicates a SecretStore has no secret of the name.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore persists secrets such as cookies and tokens across process
+// restarts, e.g. for command line tools built on the Client.
+type SecretStore interface {
+	// Load returns the secret name, or ErrSecretNotFound.
+	Load(name string) ([]byte, error)
+	// Save replaces the secret name.
+	Save(name string, secret []byte) error
+	// Delete removes the secret name, if any.
+	Delete(name string) error
+}
+
+// FileStore is a SecretStore keeping every secret in a file of Dir,
+// readable by its owner only. With a Key, of 16, 24 or 32 bytes, secrets
+// are encrypted at rest with AES-GCM.
+type FileStore struct {
+	Dir string
+	Key []byte
+}
+
+func (s *FileStore) path(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", errors.New("invalid secret name " + name)
+	}
+	return filepath.Join(s.Dir, name), nil
+}
+
+// Load implements SecretStore.
+func (s *FileStore) Load(name string) ([]byte, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSecretNotFound
+	}
+	if err != nil || s.Key == nil {
+		return data, err
+	}
+	c, err := NewAESGCMCipher(s.Key)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decrypt(nil, data)
+}
+
+// Save implements SecretStore, replacing the file atomically.
+func (s *FileStore) Save(name string, secret []byte) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if s.Key != nil {
+		c, err := NewAESGCMCipher(s.Key)
+		if err != nil {
+			return err
+		}
+		if secret, err = c.Encrypt(nil, secret); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.Dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(secret)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Delete implements SecretStore.
+func (s *FileStore) Delete(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// KeyringStore is a SecretStore keeping the secrets in a Linux kernel
+// keyring, as "user" keys described by Prefix followed by their name.
+// Secrets never touch the disk, and last as long as the keyring: the user
+// keyring by default, which outlives processes but not reboots.
+type KeyringStore struct {
+	// Keyring is the ID of the keyring, unix.KEY_SPEC_USER_KEYRING by default.
+	Keyring int
+	// Prefix is prepended to the names, "ubernet:" by default.
+	Prefix string
+}
+
+func (s *KeyringStore) keyring() int {
+	if s.Keyring != 0 {
+		return s.Keyring
+	}
+	return unix.KEY_SPEC_USER_KEYRING
+}
+
+func (s *KeyringStore) description(name string) string {
+	if s.Prefix != "" {
+		return s.Prefix + name
+	}
+	return "ubernet:" + name
+}
+
+func (s *KeyringStore) search(name string) (int, error) {
+	id, err := unix.KeyctlSearch(s.keyring(), "user", s.description(name), 0)
+	if errors.Is(err, unix.ENOKEY) || errors.Is(err, unix.EKEYEXPIRED) || errors.Is(err, unix.EKEYREVOKED) {
+		return 0, ErrSecretNotFound
+	}
+	if err != nil {
+		return 0, os.NewSyscallError("keyctl", err)
+	}
+	return id, nil
+}
+
+// Load implements SecretStore.
+func (s *KeyringStore) Load(name string) ([]byte, error) {
+	id, err := s.search(name)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+		if err != nil {
+			return nil, os.NewSyscallError("keyctl", err)
+		}
+		buf := make([]byte, size)
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			return nil, os.NewSyscallError("keyctl", err)
+		}
+		// The key may have grown in between.
+		if n <= size {
+			return buf[:n], nil
+		}
+	}
+}
+
+// Save implements SecretStore, updating the key if it exists.
+func (s *KeyringStore) Save(name string, secret []byte) error {
+	if _, err := unix.AddKey("user", s.description(name), secret, s.keyring()); err != nil {
+		return os.NewSyscallError("add_key", err)
+	}
+	return nil
+}
+
+// Delete implements SecretStore.
+func (s *KeyringStore) Delete(name string) error {
+	id, err := s.search(name)
+	if errors.Is(err, ErrSecretNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := unix.KeyctlInt(unix.KEYCTL_UNLINK, id, s.keyring(), 0, 0); err != nil {
+		return os.NewSyscallError("keyctl", err)
+	}
+	return nil
+}
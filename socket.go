@@ -1,6 +1,7 @@
 package ubernet
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -10,22 +11,43 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func createSocket() (fd int, err error) {
+func createSocket(profile SocketProfile) (fd int, err error) {
 	fd, err = unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return -1, os.NewSyscallError("socket", err)
+	}
 	unix.CloseOnExec(fd)
-	err = setSockOpts(fd)
+	err = setSockOpts(fd, profile)
 	if err != nil {
+		unix.Close(fd)
 		return -1, err
 	}
 	return
 }
 
-func setSockOpts(fd int) (err error) {
+func setSockOpts(fd int, profile SocketProfile) (err error) {
 	err = unix.SetNonblock(fd, true)
 	if err != nil {
 		return err
 	}
-	return unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_QUICKACK, 0)
+	quickAck := 0
+	if profile.QuickAck {
+		quickAck = 1
+	}
+	if err = unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_QUICKACK, quickAck); err != nil {
+		return err
+	}
+	if profile.ZeroLinger {
+		if err = unix.SetsockoptLinger(fd, unix.SOL_SOCKET, unix.SO_LINGER, &unix.Linger{Onoff: 1, Linger: 0}); err != nil {
+			return err
+		}
+	}
+	if profile.Mark != 0 {
+		if err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_MARK, profile.Mark); err != nil {
+			return os.NewSyscallError("setsockopt SO_MARK", err)
+		}
+	}
+	return nil
 }
 
 func connect(fd int, addr unix.Sockaddr) (success bool, err error) {
@@ -60,31 +82,39 @@ func connect(fd int, addr unix.Sockaddr) (success bool, err error) {
 	return
 }
 
-func createPoller() (fd int, err error) {
-	fd, err = unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+// epollPoller waits for connect results with edge-triggered epoll.
+type epollPoller struct {
+	fd int
+}
+
+func newEpollPoller() (*epollPoller, error) {
+	fd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
 	if err != nil {
-		err = os.NewSyscallError("epoll_create1", err)
+		return nil, os.NewSyscallError("epoll_create1", err)
 	}
-	return
+	return &epollPoller{fd}, nil
 }
 
-func registerEvents(pollerFd, fd int) (err error) {
+func (p *epollPoller) register(fd int) (err error) {
 	var event unix.EpollEvent
 	event.Events = unix.EPOLLOUT | unix.EPOLLIN | unix.EPOLLET
 	event.Fd = int32(fd)
-	if err = unix.EpollCtl(pollerFd, unix.EPOLL_CTL_ADD, fd, &event); err != nil {
-		return os.NewSyscallError(fmt.Sprintf("epoll_ctl(%d, ADD, %d, ...)", pollerFd, fd), err)
+	if err = unix.EpollCtl(p.fd, unix.EPOLL_CTL_ADD, fd, &event); err != nil {
+		return os.NewSyscallError(fmt.Sprintf("epoll_ctl(%d, ADD, %d, ...)", p.fd, fd), err)
 	}
 	return nil
 }
 
+// deregister is a no-op, closing fd removes it from the epoll set.
+func (p *epollPoller) deregister(fd int) {}
+
 const maxEpollEvents = 32
 
-func pollEvents(pollerFd int, timeout time.Duration) (events []event, err error) {
+func (p *epollPoller) wait(timeout time.Duration) (events []event, err error) {
 	var timeoutMS = int(timeout.Seconds() / 2)
 	var epollEvents [maxEpollEvents]unix.EpollEvent
 	// wait  for  an I/O event on an epoll file descriptor
-	nEvents, err := unix.EpollWait(pollerFd, epollEvents[:], timeoutMS)
+	nEvents, err := unix.EpollWait(p.fd, epollEvents[:], timeoutMS)
 	if err != nil {
 		if err == unix.EINTR {
 			return nil, nil
@@ -95,21 +125,48 @@ func pollEvents(pollerFd int, timeout time.Duration) (events []event, err error)
 	events = make([]event, 0, nEvents)
 
 	for i := 0; i < nEvents; i++ {
-		var fd = int(epollEvents[i].Fd)
-		var evt = event{Fd: fd, Err: nil}
-
-		errCode, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ERROR)
-		if err != nil {
-			evt.Err = os.NewSyscallError("getsockopt", err)
-		}
-		if errCode != 0 {
-			evt.Err = newErrConnect(errCode)
-		}
-		events = append(events, evt)
+		events = append(events, socketEvent(int(epollEvents[i].Fd)))
 	}
 	return events, nil
 }
 
+func (p *epollPoller) close() error {
+	return unix.Close(p.fd)
+}
+
+// socketEvent returns the connect result of fd.
+func socketEvent(fd int) event {
+	var evt = event{Fd: fd, Err: nil}
+
+	errCode, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ERROR)
+	if err != nil {
+		evt.Err = os.NewSyscallError("getsockopt", err)
+	}
+	if errCode != 0 {
+		evt.Err = newErrConnect(errCode)
+	}
+	return evt
+}
+
+// resolveAddr replaces the host name of addr by its first IPv4 address,
+// resolved with r before deadline.
+func resolveAddr(r HostResolver, addr string, deadline time.Time) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	ips, err := resolveWithTimeout(ctx, r, "tcp4", host, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", &net.DNSError{Err: "no IPv4 address", Name: host, IsNotFound: true}
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
 // parseSockAddr resolves given addr to unix.Sockaddr
 func parseSockAddr(addr string) (unix.Sockaddr, error) {
 	tAddr, err := net.ResolveTCPAddr("tcp", addr)
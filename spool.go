@@ -0,0 +1,63 @@
+package ubernet
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+)
+
+// SpoolResponse reads the whole body of resp, keeping it in memory up to
+// threshold bytes and in a temporary file of dir beyond, and replaces it
+// by an io.ReadSeekCloser allowing random access and multiple passes.
+// Closing the body removes the temporary file.
+func SpoolResponse(resp *http.Response, threshold int64, dir string) error {
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, resp.Body, threshold+1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if n <= threshold {
+		resp.Body = &memoryBody{bytes.NewReader(buf.Bytes())}
+		return nil
+	}
+
+	f, err := os.CreateTemp(dir, "ubernet-body-")
+	if err != nil {
+		return err
+	}
+	body := &fileBody{f}
+	if _, err := io.Copy(f, io.MultiReader(&buf, resp.Body)); err != nil {
+		body.Close()
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		body.Close()
+		return err
+	}
+	resp.Body = body
+	return nil
+}
+
+type memoryBody struct {
+	*bytes.Reader
+}
+
+func (memoryBody) Close() error { return nil }
+
+type fileBody struct {
+	*os.File
+}
+
+func (f *fileBody) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+var (
+	_ io.ReadSeekCloser = (*memoryBody)(nil)
+	_ io.ReadSeekCloser = (*fileBody)(nil)
+)
@@ -0,0 +1,113 @@
+package ubernet
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// SetChunked forces chunked transfer encoding, even if the body length is
+// known. Chunks are flushed to the connection as soon as they are read
+// from the body.
+func (r *Request) SetChunked() {
+	r.ContentLength = -1
+	r.TransferEncoding = []string{"chunked"}
+}
+
+// StreamWriter is the body of a streamed request, see Request.BodyWriter.
+type StreamWriter struct {
+	pw  *io.PipeWriter
+	buf *bufio.Writer
+
+	// OnFlush, if set, is called with the number of bytes handed to the
+	// transport every time data is flushed.
+	OnFlush func(n int)
+}
+
+// BodyWriter makes the body of r the data written to the returned
+// StreamWriter, sent with chunked encoding while r is performed by
+// Client.Do, which must run concurrently with the writes.
+// If bufSize is zero, every Write is sent right away as its own chunk,
+// otherwise data is buffered until bufSize bytes are written or Flush
+// is called.
+// Close the StreamWriter to end the body. A streamed body can not be
+// replayed, so such requests are never retried.
+func (r *Request) BodyWriter(bufSize int) *StreamWriter {
+	pr, pw := io.Pipe()
+	w := &StreamWriter{pw: pw}
+	if bufSize > 0 {
+		w.buf = bufio.NewWriterSize(flushNotifier{w}, bufSize)
+	}
+
+	var once sync.Once
+	r.body = func() (io.Reader, error) {
+		var body io.Reader = errReader{ErrBodyNotReplayable}
+		once.Do(func() {
+			body = pr
+		})
+		return body, nil
+	}
+	r.SetChunked()
+	r.streamed = true
+	r.retryMax = new(int)
+	return w
+}
+
+// SetStreamingResponse marks r as expecting a long-lived response, e.g.
+// server-sent events, long polling or watches. It is sent without the
+// timeout of the Client, over a transport without response header and idle
+// timeouts, and it is not retried once a response was received.
+func (r *Request) SetStreamingResponse() *Request {
+	r.streamingResponse = true
+	return r
+}
+
+// Write implements io.Writer.
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	if w.buf != nil {
+		return w.buf.Write(p)
+	}
+	return flushNotifier{w}.Write(p)
+}
+
+// Flush sends the buffered data.
+func (w *StreamWriter) Flush() error {
+	if w.buf != nil {
+		return w.buf.Flush()
+	}
+	return nil
+}
+
+// Close flushes the buffered data and ends the body.
+func (w *StreamWriter) Close() error {
+	err := w.Flush()
+	w.pw.Close()
+	return err
+}
+
+// CloseWithError aborts the body, making the request fail with err.
+func (w *StreamWriter) CloseWithError(err error) error {
+	return w.pw.CloseWithError(err)
+}
+
+// flushNotifier writes to the pipe, and calls OnFlush once the data was
+// taken by the transport.
+type flushNotifier struct {
+	w *StreamWriter
+}
+
+func (f flushNotifier) Write(p []byte) (int, error) {
+	n, err := f.w.pw.Write(p)
+	if n > 0 && f.w.OnFlush != nil {
+		f.w.OnFlush(n)
+	}
+	return n, err
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,337 @@
+package ubernet
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HTTPSRecord is an HTTPS (SVCB) DNS record, pointing clients to the
+// alternative endpoints of a service and telling how to connect to them.
+type HTTPSRecord struct {
+	// Priority orders the records, lowest first. Zero stands for the
+	// alias mode, where Target is merely an alias of the service.
+	Priority uint16
+	// Target is the host name of the endpoint, "." standing for the
+	// queried host itself.
+	Target        string
+	ALPN          []string
+	NoDefaultALPN bool
+	// Port overrides the port of the endpoint if non-zero.
+	Port      uint16
+	IPv4Hint  []net.IP
+	IPv6Hint  []net.IP
+	ECHConfig []byte
+}
+
+// HTTPSLookup looks up the HTTPS records of a host, sorted by priority.
+type HTTPSLookup interface {
+	LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error)
+}
+
+// speaksHTTP reports whether the endpoint of r supports HTTP/1.1 or HTTP/2.
+func (r *HTTPSRecord) speaksHTTP() bool {
+	if !r.NoDefaultALPN {
+		return true
+	}
+	for _, proto := range r.ALPN {
+		if proto == "h2" || proto == "http/1.1" {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoints returns the addresses to dial for r, the hints first, given
+// the host and port of the service.
+func (r *HTTPSRecord) endpoints(host, port string) []string {
+	target := strings.TrimSuffix(r.Target, ".")
+	if target == "" {
+		target = host
+	}
+	if r.Port != 0 {
+		port = strconv.Itoa(int(r.Port))
+	}
+	addrs := make([]string, 0, len(r.IPv4Hint)+len(r.IPv6Hint)+1)
+	for _, ip := range r.IPv4Hint {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	for _, ip := range r.IPv6Hint {
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	return append(addrs, net.JoinHostPort(target, port))
+}
+
+// httpsQueryName returns the name of the HTTPS records of a service.
+func httpsQueryName(host, port string) string {
+	if port == "" || port == "443" {
+		return host
+	}
+	return "_" + port + "._https." + host
+}
+
+// httpsRecordDialContext dials the endpoints the HTTPS records of the host
+// point to in turn, falling back to dialing the address itself when the
+// host publishes no usable record or none of its endpoints answers.
+func httpsRecordDialContext(dial dialContextFunc, lookup HTTPSLookup) dialContextFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+		records, err := lookup.LookupHTTPS(ctx, httpsQueryName(host, port))
+		if err != nil {
+			return dial(ctx, network, address)
+		}
+		for _, r := range records {
+			if r.Priority == 0 || !r.speaksHTTP() {
+				continue
+			}
+			for _, addr := range r.endpoints(host, port) {
+				conn, err := dial(ctx, network, addr)
+				if err == nil {
+					return conn, nil
+				}
+				if ctx.Err() != nil {
+					return nil, err
+				}
+			}
+		}
+		return dial(ctx, network, address)
+	}
+}
+
+// maxAliasDepth bounds the alias chains followed by LookupHTTPS.
+const maxAliasDepth = 4
+
+// LookupHTTPS looks up the HTTPS records of host, following the aliases.
+func (r *DoHResolver) LookupHTTPS(ctx context.Context, host string) ([]HTTPSRecord, error) {
+	return r.lookupHTTPS(ctx, host, 0)
+}
+
+func (r *DoHResolver) lookupHTTPS(ctx context.Context, host string, depth int) ([]HTTPSRecord, error) {
+	answer, err := r.query(ctx, host, dnsTypeHTTPS)
+	if err != nil {
+		return nil, err
+	}
+	var records []HTTPSRecord
+	for _, rr := range answer.Answer {
+		if rr.Type != dnsTypeHTTPS {
+			continue
+		}
+		record, err := parseHTTPSRecord(rr.Data)
+		if err != nil {
+			return nil, &net.DNSError{Err: "invalid HTTPS record: " + err.Error(), Name: host, Server: r.URL}
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Priority < records[j].Priority
+	})
+
+	if len(records) > 0 && records[0].Priority == 0 {
+		// Alias mode, the other records are to be ignored.
+		target := strings.TrimSuffix(records[0].Target, ".")
+		if target == "" || depth >= maxAliasDepth {
+			return nil, nil
+		}
+		aliased, err := r.lookupHTTPS(ctx, target, depth+1)
+		if err != nil || len(aliased) == 0 {
+			return []HTTPSRecord{{Priority: 1, Target: target}}, nil
+		}
+		for i := range aliased {
+			// "." stands for the owner of the record, the alias target.
+			if aliased[i].Target == "." {
+				aliased[i].Target = target
+			}
+		}
+		return aliased, nil
+	}
+	return records, nil
+}
+
+// LookupECHConfig looks up the ECHConfigList in the HTTPS records of host.
+func (r *DoHResolver) LookupECHConfig(ctx context.Context, host string) ([]byte, error) {
+	records, err := r.LookupHTTPS(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.ECHConfig != nil {
+			return record.ECHConfig, nil
+		}
+	}
+	return nil, nil
+}
+
+// parseHTTPSRecord parses the data of an HTTPS record, in presentation
+// format or in the generic format of RFC 3597.
+func parseHTTPSRecord(data string) (HTTPSRecord, error) {
+	fields := strings.Fields(data)
+	if len(fields) >= 2 && fields[0] == `\#` {
+		wire, err := hex.DecodeString(strings.Join(fields[2:], ""))
+		if err != nil {
+			return HTTPSRecord{}, err
+		}
+		return parseHTTPSWire(wire)
+	}
+
+	var record HTTPSRecord
+	if len(fields) < 2 {
+		return record, fmt.Errorf("%q: missing priority or target", data)
+	}
+	priority, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return record, err
+	}
+	record.Priority = uint16(priority)
+	record.Target = fields[1]
+	for _, param := range fields[2:] {
+		key, value, _ := strings.Cut(param, "=")
+		value = strings.Trim(value, `"`)
+		switch key {
+		case "alpn":
+			record.ALPN = strings.Split(value, ",")
+		case "no-default-alpn":
+			record.NoDefaultALPN = true
+		case "port":
+			port, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return record, err
+			}
+			record.Port = uint16(port)
+		case "ipv4hint", "ipv6hint":
+			for _, s := range strings.Split(value, ",") {
+				ip := net.ParseIP(s)
+				if ip == nil {
+					return record, fmt.Errorf("invalid %s %q", key, s)
+				}
+				if key == "ipv4hint" {
+					record.IPv4Hint = append(record.IPv4Hint, ip)
+				} else {
+					record.IPv6Hint = append(record.IPv6Hint, ip)
+				}
+			}
+		case "ech":
+			if record.ECHConfig, err = base64.StdEncoding.DecodeString(value); err != nil {
+				return record, err
+			}
+		}
+	}
+	return record, nil
+}
+
+var errShortRecord = errors.New("record too short")
+
+// parseHTTPSWire parses an HTTPS record in wire format (RFC 9460).
+func parseHTTPSWire(b []byte) (HTTPSRecord, error) {
+	var record HTTPSRecord
+	if len(b) < 2 {
+		return record, errShortRecord
+	}
+	record.Priority = binary.BigEndian.Uint16(b)
+	b = b[2:]
+
+	var labels []string
+	for {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return record, errShortRecord
+		}
+		n := int(b[0])
+		label := b[1 : 1+n]
+		b = b[1+n:]
+		if n == 0 {
+			break
+		}
+		labels = append(labels, string(label))
+	}
+	record.Target = strings.Join(labels, ".") + "."
+
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return record, errShortRecord
+		}
+		key, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return record, errShortRecord
+		}
+		value := b[4 : 4+n]
+		b = b[4+n:]
+		switch key {
+		case 1: // alpn
+			for len(value) > 0 {
+				m := int(value[0])
+				if len(value) < 1+m {
+					return record, errShortRecord
+				}
+				record.ALPN = append(record.ALPN, string(value[1:1+m]))
+				value = value[1+m:]
+			}
+		case 2: // no-default-alpn
+			record.NoDefaultALPN = true
+		case 3: // port
+			if len(value) != 2 {
+				return record, errShortRecord
+			}
+			record.Port = binary.BigEndian.Uint16(value)
+		case 4: // ipv4hint
+			for ; len(value) >= net.IPv4len; value = value[net.IPv4len:] {
+				record.IPv4Hint = append(record.IPv4Hint, net.IP(append([]byte(nil), value[:net.IPv4len]...)))
+			}
+		case 5: // ech
+			record.ECHConfig = append([]byte(nil), value...)
+		case 6: // ipv6hint
+			for ; len(value) >= net.IPv6len; value = value[net.IPv6len:] {
+				record.IPv6Hint = append(record.IPv6Hint, net.IP(append([]byte(nil), value[:net.IPv6len]...)))
+			}
+		}
+	}
+	return record, nil
+}
+
+// dialTLSContext returns the DialTLSContext of t, honoring the HTTPS
+// records and ECH options of c.
+func (c *Client) dialTLSContext(t *http.Transport) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dial := t.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		if c.HTTPSRecords != nil {
+			dial = httpsRecordDialContext(dial, c.HTTPSRecords)
+		}
+		// t completes the protocols of its config for HTTP/2 on first use.
+		if c.ECH != nil {
+			return c.ECH.dialTLS(ctx, dial, t.TLSClientConfig, network, addr)
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		return tlsHandshake(ctx, dial, tlsConfigFor(t.TLSClientConfig, host), network, addr)
+	}
+}
+
+// tlsConfigFor returns a copy of config with ServerName defaulting to host.
+func tlsConfigFor(config *tls.Config, host string) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	return config
+}
@@ -0,0 +1,57 @@
+package ubernet
+
+import (
+	"io"
+	"net/http"
+)
+
+// Consumer reads a stream handed over by TeeReader.
+type Consumer func(io.Reader) error
+
+// TeeResponse streams the body of resp to every consumer, then closes it.
+// See TeeReader.
+func TeeResponse(resp *http.Response, consumers ...Consumer) error {
+	defer resp.Body.Close()
+	return TeeReader(resp.Body, consumers...)
+}
+
+// TeeReader streams r to every consumer concurrently, without buffering
+// it: reading r blocks until every consumer took the previous chunk.
+// A consumer returning early without error has the rest of its stream
+// discarded, while an error aborts the other consumers.
+// It returns the first error of a consumer, or of reading r.
+func TeeReader(r io.Reader, consumers ...Consumer) error {
+	writers := make([]*io.PipeWriter, len(consumers))
+	mw := make([]io.Writer, len(consumers))
+	errs := make(chan error, len(consumers))
+
+	for i, consume := range consumers {
+		pr, pw := io.Pipe()
+		writers[i], mw[i] = pw, pw
+		go func(consume Consumer) {
+			err := consume(pr)
+			if err != nil {
+				pr.CloseWithError(err)
+			} else {
+				io.Copy(io.Discard, pr)
+			}
+			errs <- err
+		}(consume)
+	}
+
+	_, copyErr := io.Copy(io.MultiWriter(mw...), r)
+	for _, pw := range writers {
+		pw.CloseWithError(copyErr)
+	}
+
+	var firstErr error
+	for range consumers {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return copyErr
+}
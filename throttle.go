@@ -0,0 +1,198 @@
+package ubernet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Throttle is a token bucket limiting a throughput to Rate bytes per
+// second, with bursts of up to Burst bytes. It may be shared by several
+// connections to limit them as a whole.
+type Throttle struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	bytes  int64
+	waits  int64
+	waited int64
+}
+
+// NewThrottle returns a Throttle of rate bytes per second, with bursts of
+// burst bytes, rate if burst is zero or less.
+func NewThrottle(rate, burst int64) *Throttle {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &Throttle{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Burst returns the size of the bursts, in bytes.
+func (t *Throttle) Burst() int {
+	return int(t.burst)
+}
+
+// reserve takes n tokens, returning how long to wait for them.
+func (t *Throttle) reserve(n int) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	if t.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-t.tokens / t.rate * float64(time.Second))
+}
+
+// WaitN blocks until n bytes may go through, or ctx is done.
+func (t *Throttle) WaitN(ctx context.Context, n int) error {
+	if t == nil || t.rate <= 0 || n <= 0 {
+		return nil
+	}
+	atomic.AddInt64(&t.bytes, int64(n))
+	wait := t.reserve(n)
+	if wait <= 0 {
+		return nil
+	}
+	atomic.AddInt64(&t.waits, 1)
+	atomic.AddInt64(&t.waited, int64(wait))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ThrottleStats are the counters of a Throttle.
+type ThrottleStats struct {
+	Rate  int64 `json:"rate"`
+	Burst int64 `json:"burst"`
+	// Bytes went through the Throttle, Throttled times it had to wait,
+	// for Waited in total.
+	Bytes     int64         `json:"bytes"`
+	Throttled int64         `json:"throttled"`
+	Waited    time.Duration `json:"waited"`
+}
+
+// Stats returns the counters of t.
+func (t *Throttle) Stats() ThrottleStats {
+	return ThrottleStats{
+		Rate:      int64(t.rate),
+		Burst:     int64(t.burst),
+		Bytes:     atomic.LoadInt64(&t.bytes),
+		Throttled: atomic.LoadInt64(&t.waits),
+		Waited:    time.Duration(atomic.LoadInt64(&t.waited)),
+	}
+}
+
+// ThrottleConn limits the reads of conn with the read throttles and its
+// writes with the write throttles, any of which may be nil. A blocked
+// operation is not interrupted by deadlines nor by closing conn.
+func ThrottleConn(conn net.Conn, read, write []*Throttle) net.Conn {
+	return &throttledConn{Conn: conn, read: read, write: write}
+}
+
+type throttledConn struct {
+	net.Conn
+	read, write []*Throttle
+}
+
+// chunk returns the largest size all of throttles allow in a burst.
+func chunk(throttles []*Throttle, n int) int {
+	for _, t := range throttles {
+		if t != nil && t.rate > 0 && t.Burst() < n {
+			n = t.Burst()
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func waitAll(throttles []*Throttle, n int) {
+	for _, t := range throttles {
+		t.WaitN(context.Background(), n)
+	}
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return c.Conn.Read(p)
+	}
+	// The bytes are accounted for once read, the size of the next ones
+	// being unknown.
+	n, err := c.Conn.Read(p[:chunk(c.read, len(p))])
+	waitAll(c.read, n)
+	return n, err
+}
+
+func (c *throttledConn) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		size := chunk(c.write, len(p))
+		waitAll(c.write, size)
+		n, err := c.Conn.Write(p[:size])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[size:]
+	}
+	return written, nil
+}
+
+// SyscallConn lets the liveness checks of idle connections see through.
+func (c *throttledConn) SyscallConn() (syscall.RawConn, error) {
+	if sc, ok := c.Conn.(syscall.Conn); ok {
+		return sc.SyscallConn()
+	}
+	return nil, errors.New("connection does not support SyscallConn")
+}
+
+// ThrottleOptions limit the bandwidth of the connections of a Client.
+type ThrottleOptions struct {
+	// Read and Write, if set, limit all the connections together.
+	Read, Write *Throttle
+	// ConnRead and ConnWrite, if positive, limit every connection to as
+	// many bytes per second, with bursts of ConnBurst bytes, one second
+	// worth of bytes by default.
+	ConnRead, ConnWrite int64
+	ConnBurst           int64
+}
+
+// throttledDialContext throttles the connections dialed by dial.
+func (o *ThrottleOptions) throttledDialContext(dial dialContextFunc) dialContextFunc {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		read, write := []*Throttle{o.Read}, []*Throttle{o.Write}
+		if o.ConnRead > 0 {
+			read = append(read, NewThrottle(o.ConnRead, o.ConnBurst))
+		}
+		if o.ConnWrite > 0 {
+			write = append(write, NewThrottle(o.ConnWrite, o.ConnBurst))
+		}
+		return ThrottleConn(conn, read, write), nil
+	}
+}
@@ -0,0 +1,112 @@
+package ubernet
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// TLSInfo describes the outcome of a TLS handshake.
+type TLSInfo struct {
+	Version     uint16
+	CipherSuite uint16
+	// NegotiatedProtocol is the protocol agreed on via ALPN, empty if none.
+	NegotiatedProtocol string
+	ServerName         string
+	DidResume          bool
+	// ECHAccepted reports whether the Client Hello was encrypted.
+	ECHAccepted bool
+}
+
+// NewTLSInfo returns the TLSInfo of cs, nil if cs is nil.
+func NewTLSInfo(cs *tls.ConnectionState) *TLSInfo {
+	if cs == nil {
+		return nil
+	}
+	return &TLSInfo{
+		Version:            cs.Version,
+		CipherSuite:        cs.CipherSuite,
+		NegotiatedProtocol: cs.NegotiatedProtocol,
+		ServerName:         cs.ServerName,
+		DidResume:          cs.DidResume,
+		ECHAccepted:        cs.ECHAccepted,
+	}
+}
+
+// ResponseTLSInfo returns the TLSInfo of the connection resp was received
+// on, nil if it was not encrypted.
+func ResponseTLSInfo(resp *http.Response) *TLSInfo {
+	if resp == nil {
+		return nil
+	}
+	return NewTLSInfo(resp.TLS)
+}
+
+// VersionName returns the name of the TLS version, e.g. "TLS 1.3".
+func (i *TLSInfo) VersionName() string {
+	return tls.VersionName(i.Version)
+}
+
+// CipherSuiteName returns the name of the cipher suite.
+func (i *TLSInfo) CipherSuiteName() string {
+	return tls.CipherSuiteName(i.CipherSuite)
+}
+
+func (i *TLSInfo) String() string {
+	proto := i.NegotiatedProtocol
+	if proto == "" {
+		proto = "none"
+	}
+	s := fmt.Sprintf("%s %s alpn=%s", i.VersionName(), i.CipherSuiteName(), proto)
+	if i.ECHAccepted {
+		s += " ech"
+	}
+	return s
+}
+
+// DialTLS connects to address like DialTCP, then performs a TLS handshake
+// with config, whose ServerName defaults to the host of address.
+func (d *Dialer) DialTLS(ctx context.Context, network, address string, config *tls.Config) (*tls.Conn, *TLSInfo, error) {
+	dial := dialContextFunc(d.DialTCP)
+	if d.HTTPSRecords != nil {
+		dial = httpsRecordDialContext(dial, d.HTTPSRecords)
+	}
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	host, _, _ := net.SplitHostPort(address)
+	config = tlsConfigFor(config, host)
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, nil, &net.OpError{Op: "dial", Net: network, Source: conn.LocalAddr(), Addr: conn.RemoteAddr(), Err: err}
+	}
+	cs := tlsConn.ConnectionState()
+	return tlsConn, NewTLSInfo(&cs), nil
+}
+
+// RequireProtocol makes config fail the handshake unless the server
+// negotiates one of protocols via ALPN, which are also offered.
+func RequireProtocol(config *tls.Config, protocols ...string) {
+	config.NextProtos = protocols
+	verify := config.VerifyConnection
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		accepted := false
+		for _, proto := range protocols {
+			if cs.NegotiatedProtocol == proto {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return &ErrProtocolNotAccepted{Protocol: cs.NegotiatedProtocol, Accepted: protocols}
+		}
+		if verify != nil {
+			return verify(cs)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package ubernet
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+)
+
+// TLSSessionCache is a size-bounded LRU cache of TLS sessions, shared by
+// the connections of a Client to resume sessions rather than perform full
+// handshakes, and counting how often it could.
+type TLSSessionCache struct {
+	cache tls.ClientSessionCache
+
+	hits   int64
+	misses int64
+	puts   int64
+}
+
+// NewTLSSessionCache returns a TLSSessionCache of capacity sessions, 64 if
+// capacity is zero or less.
+func NewTLSSessionCache(capacity int) *TLSSessionCache {
+	return &TLSSessionCache{cache: tls.NewLRUClientSessionCache(capacity)}
+}
+
+// Get implements tls.ClientSessionCache.
+func (c *TLSSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	session, ok := c.cache.Get(sessionKey)
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+	} else {
+		atomic.AddInt64(&c.misses, 1)
+	}
+	return session, ok
+}
+
+// Put implements tls.ClientSessionCache.
+func (c *TLSSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if cs != nil {
+		atomic.AddInt64(&c.puts, 1)
+	}
+	c.cache.Put(sessionKey, cs)
+}
+
+// TLSSessionStats are the counters of a TLSSessionCache.
+type TLSSessionStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Puts   int64 `json:"puts"`
+	// HitRate is the fraction of the handshakes which could offer a
+	// session to resume.
+	HitRate float64 `json:"hit_rate"`
+}
+
+// Stats returns the counters of c.
+func (c *TLSSessionCache) Stats() TLSSessionStats {
+	stats := TLSSessionStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+		Puts:   atomic.LoadInt64(&c.puts),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+var _ tls.ClientSessionCache = (*TLSSessionCache)(nil)
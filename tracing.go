@@ -0,0 +1,103 @@
+package ubernet
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Tracer starts the spans of the requests of a Client: one per call to Do,
+// parent of one per attempt. It is shaped after OpenTelemetry, e.g.:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) StartRequest(ctx context.Context, req *ubernet.Request) (context.Context, ubernet.Span) {
+//		ctx, span := t.Start(ctx, "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient))
+//		return ctx, otelSpan{span}
+//	}
+type Tracer interface {
+	StartRequest(ctx context.Context, req *Request) (context.Context, Span)
+	StartAttempt(ctx context.Context, req *Request, attempt int) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key-value pair set on a Span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attributes set on the spans, after the OpenTelemetry semantic conventions
+// where they exist.
+const (
+	AttrMethod     = "http.request.method"
+	AttrURL        = "url.full"
+	AttrHost       = "server.address"
+	AttrStatusCode = "http.response.status_code"
+	AttrAttempt    = "ubernet.attempt"
+	AttrAttempts   = "ubernet.attempts"
+	AttrBackoff    = "ubernet.backoff"
+	AttrOutcome    = "ubernet.outcome"
+)
+
+// Outcomes of the requests, the value of AttrOutcome.
+const (
+	OutcomeSuccess = "success"
+	OutcomeStatus  = "status"
+	OutcomeError   = "error"
+)
+
+// traceRequest starts the span of req, returning the function ending it.
+func (c *Client) traceRequest(req *Request) func(*http.Response, error) {
+	ctx, span := c.Tracer.StartRequest(req.Context(), req)
+	req.Request = req.Request.WithContext(ctx)
+	span.SetAttributes(
+		Attribute{AttrMethod, req.Method},
+		Attribute{AttrURL, c.redactURL(req.URL)},
+		Attribute{AttrHost, req.URL.Hostname()},
+	)
+	return func(resp *http.Response, err error) {
+		info := req.lastAttempt
+		span.SetAttributes(
+			Attribute{AttrAttempts, info.Attempts},
+			Attribute{AttrBackoff, info.Backoff.String()},
+		)
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetAttributes(Attribute{AttrOutcome, OutcomeError})
+		case resp.StatusCode >= 400:
+			span.SetAttributes(Attribute{AttrStatusCode, resp.StatusCode}, Attribute{AttrOutcome, OutcomeStatus})
+		default:
+			span.SetAttributes(Attribute{AttrStatusCode, resp.StatusCode}, Attribute{AttrOutcome, OutcomeSuccess})
+		}
+		span.End()
+	}
+}
+
+// traceAttempt starts the span of an attempt of req, which waited backoff
+// before, returning the function ending it.
+func (c *Client) traceAttempt(req *Request, attempt int, backoff time.Duration) func(*http.Response, error) {
+	parent := req.Context()
+	ctx, span := c.Tracer.StartAttempt(parent, req, attempt)
+	req.Request = req.Request.WithContext(ctx)
+	span.SetAttributes(
+		Attribute{AttrAttempt, attempt},
+		Attribute{AttrBackoff, backoff.String()},
+	)
+	return func(resp *http.Response, err error) {
+		req.Request = req.Request.WithContext(parent)
+		if err != nil {
+			span.RecordError(err)
+		} else {
+			span.SetAttributes(Attribute{AttrStatusCode, resp.StatusCode})
+		}
+		span.End()
+	}
+}
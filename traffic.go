@@ -0,0 +1,184 @@
+package ubernet
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// SetLabel sets the label of r, the logical operation it belongs to, by
+// which the Client aggregates its traffic.
+func (r *Request) SetLabel(label string) *Request {
+	r.label = label
+	return r
+}
+
+// Label returns the label of r, see SetLabel.
+func (r *Request) Label() string {
+	return r.label
+}
+
+// trafficCounters count the bytes exchanged with a host or for a label.
+type trafficCounters struct {
+	sent     int64
+	received int64
+}
+
+// clientTraffic are the traffic counters of a Client.
+type clientTraffic struct {
+	mu     sync.RWMutex
+	hosts  map[string]*trafficCounters
+	labels map[string]*trafficCounters
+}
+
+func (ct *clientTraffic) counters(m *map[string]*trafficCounters, key string) *trafficCounters {
+	ct.mu.RLock()
+	tc, ok := (*m)[key]
+	ct.mu.RUnlock()
+	if ok {
+		return tc
+	}
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if tc, ok := (*m)[key]; ok {
+		return tc
+	}
+	if *m == nil {
+		*m = make(map[string]*trafficCounters)
+	}
+	tc = &trafficCounters{}
+	(*m)[key] = tc
+	return tc
+}
+
+// trafficOf returns the counters of the host and label of req, the latter
+// being nil for unlabeled requests.
+func (c *Client) trafficOf(req *Request) (host, label *trafficCounters) {
+	host = c.traffic.counters(&c.traffic.hosts, req.URL.Host)
+	if req.label != "" {
+		label = c.traffic.counters(&c.traffic.labels, req.label)
+	}
+	return host, label
+}
+
+func (tc *trafficCounters) addSent(n int64) {
+	if tc != nil {
+		atomic.AddInt64(&tc.sent, n)
+	}
+}
+
+func (tc *trafficCounters) addReceived(n int64) {
+	if tc != nil {
+		atomic.AddInt64(&tc.received, n)
+	}
+}
+
+// headerSize approximates the size of h on the wire, in HTTP/1.1.
+func headerSize(h http.Header) int64 {
+	var n int64
+	for k, vs := range h {
+		for _, v := range vs {
+			n += int64(len(k) + len(v) + 4)
+		}
+	}
+	return n
+}
+
+// accountRequest counts the headers of an attempt of req, and its body as
+// the transport reads it. The bodies the transport gets again from GetBody,
+// to follow a redirect or to resend the request on another connection,
+// are counted too, to the host and label of req.
+func (c *Client) accountRequest(req *Request) {
+	host, label := c.trafficOf(req)
+	n := int64(len(req.Method)+len(req.URL.RequestURI())+len(req.Host)+20) + headerSize(req.Header)
+	host.addSent(n)
+	label.addSent(n)
+	count := func(n int64) {
+		host.addSent(n)
+		label.addSent(n)
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingReadCloser{ReadCloser: req.Body, count: count}
+	}
+	if getBody := req.GetBody; getBody != nil {
+		var countedGetBody func() (io.ReadCloser, error)
+		countedGetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			// getBody may set a GetBody of its own on the request.
+			req.GetBody = countedGetBody
+			if err != nil || body == nil || body == http.NoBody {
+				return body, err
+			}
+			return &countingReadCloser{ReadCloser: body, count: count}, nil
+		}
+		req.GetBody = countedGetBody
+	}
+}
+
+// accountResponse counts the headers of resp, and its body as it is read.
+func (c *Client) accountResponse(req *Request, resp *http.Response) {
+	host, label := c.trafficOf(req)
+	n := int64(len(resp.Status)+15) + headerSize(resp.Header)
+	host.addReceived(n)
+	label.addReceived(n)
+	if resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &countingReadCloser{ReadCloser: resp.Body, count: func(n int64) {
+			host.addReceived(n)
+			label.addReceived(n)
+		}}
+	}
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	count func(n int64)
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.count(int64(n))
+	}
+	return n, err
+}
+
+// TrafficStats are the bytes sent and received, headers included but not
+// the framing and TLS overhead.
+type TrafficStats struct {
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
+
+// TrafficReport is the traffic of a Client by host and by label.
+type TrafficReport struct {
+	Hosts  map[string]TrafficStats `json:"hosts"`
+	Labels map[string]TrafficStats `json:"labels"`
+}
+
+// Traffic returns the traffic of c by host and by request label, counted
+// when TrafficAccounting is enabled. Retries, and bodies sent again on
+// redirects or on another connection, are counted.
+func (c *Client) Traffic() TrafficReport {
+	report := TrafficReport{
+		Hosts:  make(map[string]TrafficStats),
+		Labels: make(map[string]TrafficStats),
+	}
+	c.traffic.mu.RLock()
+	defer c.traffic.mu.RUnlock()
+	for host, tc := range c.traffic.hosts {
+		report.Hosts[host] = tc.stats()
+	}
+	for label, tc := range c.traffic.labels {
+		report.Labels[label] = tc.stats()
+	}
+	return report
+}
+
+func (tc *trafficCounters) stats() TrafficStats {
+	return TrafficStats{
+		Sent:     atomic.LoadInt64(&tc.sent),
+		Received: atomic.LoadInt64(&tc.received),
+	}
+}
@@ -0,0 +1,45 @@
+package ubernet
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTrafficCountsRedirectedBody(t *testing.T) {
+	const payload = "0123456789"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		if body, _ := io.ReadAll(r.Body); string(body) != payload {
+			t.Errorf("redirected body %q, want %q", body, payload)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	measure := func(path string) int64 {
+		c := NewClient()
+		c.Logger = nil
+		c.TrafficAccounting = true
+		req, err := NewRequest("POST", srv.URL+path, []byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		u, _ := url.Parse(srv.URL)
+		return c.Traffic().Hosts[u.Host].Sent
+	}
+	direct, redirected := measure("/new"), measure("/old")
+	if redirected < direct+int64(len(payload)) {
+		t.Fatalf("sent %d bytes with a redirect, %d without: the redirected body is not counted", redirected, direct)
+	}
+}
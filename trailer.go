@@ -0,0 +1,125 @@
+package ubernet
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Trailer computes the value of a request trailer from the body streamed
+// through it.
+type Trailer interface {
+	io.Writer
+	// Value is called once the whole body was sent.
+	Value() string
+	// Reset is called before the body is sent again by a retry.
+	Reset()
+}
+
+type hashTrailer struct {
+	hash.Hash
+}
+
+func (t hashTrailer) Value() string {
+	return base64.StdEncoding.EncodeToString(t.Sum(nil))
+}
+
+// HashTrailer returns a Trailer holding the base64 digest of the body by h.
+func HashTrailer(h hash.Hash) Trailer {
+	return hashTrailer{h}
+}
+
+// SetTrailer declares the request trailer name, computed by t while the
+// body is streamed. Requests with trailers use chunked transfer encoding.
+func (r *Request) SetTrailer(name string, t Trailer) {
+	if r.trailers == nil {
+		r.trailers = make(map[string]Trailer)
+	}
+	r.trailers[http.CanonicalHeaderKey(name)] = t
+	if r.Trailer == nil {
+		r.Trailer = make(http.Header)
+	}
+	r.Trailer[http.CanonicalHeaderKey(name)] = nil
+	r.ContentLength = -1
+}
+
+// trailerReader feeds the trailers with the body, and sets their values
+// once the body is exhausted.
+type trailerReader struct {
+	io.ReadCloser
+	req *Request
+}
+
+func (r *trailerReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	for _, t := range r.req.trailers {
+		t.Write(p[:n])
+	}
+	if err == io.EOF {
+		for name, t := range r.req.trailers {
+			r.req.Trailer.Set(name, t.Value())
+		}
+	}
+	return n, err
+}
+
+func (r *Request) wrapTrailers() {
+	if len(r.trailers) == 0 || r.Body == nil {
+		return
+	}
+	for _, t := range r.trailers {
+		t.Reset()
+	}
+	r.Body = &trailerReader{r.Body, r}
+}
+
+// GRPCStatusError is a non-OK gRPC status found in the response trailers.
+type GRPCStatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *GRPCStatusError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", e.Code, e.Message)
+}
+
+// TrailerError returns the gRPC status of the trailers of resp as a
+// *GRPCStatusError, or nil if it is OK or missing.
+// Trailers are only available once the body was read until io.EOF.
+func TrailerError(resp *http.Response) error {
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status == "" || status == "0" {
+		return nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("invalid grpc-status %q", status)
+	}
+	msg := resp.Trailer.Get("Grpc-Message")
+	if msg == "" {
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	if unescaped, err := url.PathUnescape(msg); err == nil {
+		msg = unescaped
+	}
+	return &GRPCStatusError{Code: code, Message: msg}
+}
+
+// ReadAllWithTrailer reads and closes the body of resp, and returns it
+// along with the response trailers.
+// The error is a *GRPCStatusError if the trailers hold a non-OK gRPC status.
+func ReadAllWithTrailer(resp *http.Response) ([]byte, http.Header, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return body, resp.Trailer, err
+	}
+	return body, resp.Trailer, TrailerError(resp)
+}
@@ -0,0 +1,78 @@
+package ubernet
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ResponseHook rewrites or augments the final response of a request before
+// it is returned by Client.Do. It returns the response to pass on, or an
+// error returned instead by Client.Do.
+type ResponseHook func(req *Request, resp *http.Response) (*http.Response, error)
+
+// OnResponse appends hooks to the response pipeline of the Client.
+// Hooks run in order, on every response returned by Client.Do.
+func (c *Client) OnResponse(hooks ...ResponseHook) {
+	c.ResponseHooks = append(c.ResponseHooks, hooks...)
+}
+
+// transformResponse runs resp through the response hooks.
+func (c *Client) transformResponse(req *Request, resp *http.Response) (*http.Response, error) {
+	for _, hook := range c.ResponseHooks {
+		next, err := hook(req, resp)
+		if err != nil {
+			if resp != nil && next != resp {
+				resp.Body.Close()
+			}
+			if next != nil {
+				next.Body.Close()
+			}
+			return nil, err
+		}
+		resp = next
+	}
+	return resp, nil
+}
+
+// DefaultJSONPrefix is the anti-hijacking prefix prepended to JSON bodies
+// by some APIs.
+const DefaultJSONPrefix = ")]}'"
+
+// StripJSONPrefix returns a ResponseHook removing prefix, and the line
+// break following it, from the start of JSON response bodies.
+func StripJSONPrefix(prefix string) ResponseHook {
+	return func(req *Request, resp *http.Response) (*http.Response, error) {
+		if !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+			return resp, nil
+		}
+		br := bufio.NewReaderSize(resp.Body, len(prefix)+2)
+		head, err := br.Peek(len(prefix))
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		skipped := 0
+		if bytes.Equal(head, []byte(prefix)) {
+			skipped = len(prefix)
+			br.Discard(skipped)
+			if next, _ := br.Peek(2); bytes.HasPrefix(next, []byte("\r\n")) {
+				skipped += 2
+			} else if bytes.HasPrefix(next, []byte("\n")) {
+				skipped++
+			}
+			br.Discard(skipped - len(prefix))
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{br, resp.Body}
+		if skipped > 0 && resp.ContentLength >= 0 {
+			resp.ContentLength -= int64(skipped)
+			resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,45 @@
+package ubernet
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestConnectAccepts2xx(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		if _, err := http.ReadRequest(br); err != nil {
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 201 Created\r\n\r\n")
+		io.Copy(conn, br)
+	}()
+
+	c := NewClient()
+	tunnel, err := c.Connect(context.Background(), "http://"+ln.Addr().String(), "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+	if _, err := io.WriteString(tunnel, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(tunnel, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read %q, %v through the tunnel, want ping", buf, err)
+	}
+}
@@ -0,0 +1,81 @@
+package ubernet
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Warmup establishes n connections per host into the connection pool, so
+// the first requests after a deploy do not pay for connecting.
+// hosts are base URLs like "https://api.example.com:8443", https being
+// assumed if the scheme is missing; the TLS handshake of https hosts is
+// done as well. The connections are opened by concurrent HEAD requests,
+// whatever their status. At most MaxIdleConnsPerHost connections of the
+// transport are kept, and warming up requires keep-alives to be enabled.
+func (c *Client) Warmup(ctx context.Context, hosts []string, n int) error {
+	if t, ok := c.HTTPClient.Transport.(*http.Transport); ok && t.DisableKeepAlives {
+		return fmt.Errorf("warmup: keep-alives are disabled, use DefaultPooledClient")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(hosts))
+	for _, host := range hosts {
+		if !strings.Contains(host, "://") {
+			host = "https://" + host
+		}
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			if err := c.warmupHost(ctx, host, n); err != nil {
+				errs <- fmt.Errorf("warmup %s: %w", host, err)
+			}
+		}(host)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// warmupHost opens n connections to host. Responses are held until all
+// of them arrived, so that no request reuses the connection of another.
+func (c *Client) warmupHost(ctx context.Context, host string, n int) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		bodies   = make(chan *http.Response, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := NewRequest(http.MethodHead, host, nil)
+			if err != nil {
+				mu.Lock()
+				firstErr = err
+				mu.Unlock()
+				return
+			}
+			req.WithContext(ctx)
+			resp, err := c.httpClientFor(req).Do(req.Request)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = c.redactError(err)
+				}
+				mu.Unlock()
+				return
+			}
+			bodies <- resp
+		}()
+	}
+	wg.Wait()
+	close(bodies)
+	for resp := range bodies {
+		c.drainBody(resp.Body)
+	}
+	return firstErr
+}